@@ -0,0 +1,179 @@
+// Package auth provides a controller that crawls a site behind a form
+// login.
+package auth
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fanyang01/crawler"
+)
+
+// Detector reports whether r, whose body is given, shows that the session
+// has been logged out.
+type Detector func(r *crawler.Response, body []byte) bool
+
+// Pattern detects a logged-out session by a pattern in the body.
+func Pattern(re *regexp.Regexp) Detector {
+	return func(_ *crawler.Response, body []byte) bool {
+		return re.Match(body)
+	}
+}
+
+// RedirectedTo detects a logged-out session by a redirection to a URL
+// whose path begins with prefix, e.g., "/login".
+func RedirectedTo(prefix string) Detector {
+	return func(r *crawler.Response, _ []byte) bool {
+		return r.NewURL.String() != r.URL.String() &&
+			strings.HasPrefix(r.NewURL.Path, prefix)
+	}
+}
+
+// Controller wraps a crawler.Controller and logs in before the first
+// request is made. If a response is detected as logged out, it logs in
+// again and revisits the URL immediately, instead of passing the response
+// to the wrapped controller. The validators of a logged-out response are
+// not stored, so the revisit is not made conditional on them.
+type Controller struct {
+	crawler.Forward
+	Login *Login
+	// Client is used to log in. Its cookie jar must be the one used by
+	// the crawler, e.g., crawler.DefaultHTTPClient, or the jar of Session.
+	Client *http.Client
+	// Session, if not empty, is set as the session of requests.
+	Session string
+	// LoggedOut detects responses of a logged-out session. If it's nil,
+	// only the initial login is performed.
+	LoggedOut Detector
+	// MaxRetries is the maximum number of consecutive revisits of a URL
+	// because of logging out. The URL is then given up with ErrLoggedOut,
+	// which is logged by the crawler, and completed.
+	MaxRetries int
+
+	mu      sync.Mutex
+	last    time.Time // time of the last successful login
+	err     error     // error of the last login
+	retries map[string]int
+	due     map[string]bool
+}
+
+// New creates a controller that logs in using client.
+func New(ctrl crawler.Controller, login *Login, client *http.Client) *Controller {
+	if ctrl == nil {
+		ctrl = crawler.NopController{}
+	}
+	if client == nil {
+		client = crawler.DefaultHTTPClient
+	}
+	return &Controller{
+		Forward:    crawler.Forward{Controller: ctrl},
+		Login:      login,
+		Client:     client,
+		MaxRetries: 3,
+		retries:    make(map[string]int),
+		due:        make(map[string]bool),
+	}
+}
+
+// LogIn performs the login sequence unless a login has succeeded after
+// since. Concurrent calls are serialized.
+func (c *Controller) LogIn(since time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.IsZero() && c.last.After(since) {
+		return nil
+	}
+	if c.err = c.Login.Do(c.Client); c.err == nil {
+		c.last = time.Now()
+	}
+	return c.err
+}
+
+// Err returns the error of the last login.
+func (c *Controller) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Prepare implements crawler.Controller. The first call logs in. If the
+// login fails, requests are made anyway, and the login is retried when a
+// logged-out response is detected.
+func (c *Controller) Prepare(req *crawler.Request) {
+	c.mu.Lock()
+	first := c.last.IsZero() && c.err == nil
+	c.mu.Unlock()
+	if first {
+		c.LogIn(time.Time{})
+	}
+	if c.Session != "" {
+		req.Session = c.Session
+	}
+	c.Controller.Prepare(req)
+}
+
+// Handle implements crawler.Controller. The body is read into memory if
+// LoggedOut is set.
+func (c *Controller) Handle(r *crawler.Response, ch chan<- *url.URL) {
+	c.handle(r, func() { c.Controller.Handle(r, ch) })
+}
+
+// HandleLink implements crawler.LinkHandler. It's like Handle, but calls
+// crawler.HandleLink with the wrapped controller.
+func (c *Controller) HandleLink(r *crawler.Response, ch chan<- *crawler.Link) {
+	c.handle(r, func() { crawler.HandleLink(c.Controller, r, ch) })
+}
+
+func (c *Controller) handle(r *crawler.Response, handle func()) {
+	if c.LoggedOut == nil || r.NotModified {
+		handle()
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	r.Body = bytes.NewReader(body)
+	if err != nil || !c.LoggedOut(r, body) {
+		c.mu.Lock()
+		delete(c.retries, r.URL.String())
+		c.mu.Unlock()
+		handle()
+		return
+	}
+
+	// The validators are those of the login page rather than the page
+	// of URL, so the ones stored for URL are dropped.
+	r.Header.Del("ETag")
+	r.Header.Del("Last-Modified")
+	// The response was received with the cookies before a later login.
+	c.LogIn(r.Timestamp)
+	u := r.URL.String()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.retries[u]++; c.retries[u] <= c.MaxRetries {
+		c.due[u] = true
+		return
+	}
+	delete(c.retries, u)
+	if ctx := r.Context(); ctx != nil {
+		ctx.Error(ErrLoggedOut)
+	}
+}
+
+// Resched implements crawler.Controller. A URL whose response is logged
+// out is revisited immediately.
+func (c *Controller) Resched(r *crawler.Response) (done bool, t crawler.Ticket) {
+	u := r.URL.String()
+	c.mu.Lock()
+	due := c.due[u]
+	delete(c.due, u)
+	c.mu.Unlock()
+	if due {
+		return false, crawler.Ticket{At: time.Now()}
+	}
+	return c.Controller.Resched(r)
+}
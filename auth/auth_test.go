@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ crawler.Controller       = &Controller{}
+	_ crawler.LinkHandler      = &Controller{}
+	_ crawler.LinkAccepter     = &Controller{}
+	_ crawler.LinkScheduler    = &Controller{}
+	_ crawler.SitemapReceiver  = &Controller{}
+	_ crawler.ResponseAccepter = &Controller{}
+)
+
+const loginPage = `<html><body>
+<form action="/search"><input name="q"></form>
+<form method="POST" action="/login?next=%2F">
+<input type="hidden" name="csrf" value="TOKEN">
+<input name="user" value="">
+<input type="password" name="pass">
+<input type="checkbox" name="remember" checked>
+<select name="lang"><option>en</option><option selected value="zh">Chinese</option></select>
+<input type="submit" name="go" value="Log in">
+<input type="submit" name="cancel" value="Cancel">
+</form></body></html>`
+
+type site struct {
+	sync.Mutex
+	token    int
+	sessions map[string]bool
+	logins   int
+	form     url.Values
+	// forget makes sessions expire immediately.
+	forget bool
+}
+
+func (s *site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	switch r.URL.Path {
+	case "/login":
+		if r.Method == "GET" {
+			s.token++
+			w.Header().Set("ETag", `"login"`)
+			fmt.Fprint(w, strings.Replace(loginPage, "TOKEN", fmt.Sprint(s.token), 1))
+			return
+		}
+		r.ParseForm()
+		s.form = r.PostForm
+		if r.PostForm.Get("csrf") != fmt.Sprint(s.token) ||
+			r.PostForm.Get("pass") != "secret" {
+			fmt.Fprint(w, "Wrong password")
+			return
+		}
+		s.logins++
+		sid := fmt.Sprint("sid", s.logins)
+		s.sessions[sid] = true
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: sid})
+		http.Redirect(w, r, "/welcome", http.StatusFound)
+	case "/welcome":
+		fmt.Fprint(w, "Welcome")
+	default:
+		if s.forget {
+			s.sessions = make(map[string]bool)
+		}
+		if c, err := r.Cookie("sid"); err != nil || !s.sessions[c.Value] {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		fmt.Fprint(w, "content")
+	}
+}
+
+func newClient() *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{Jar: jar}
+}
+
+func TestLogin(t *testing.T) {
+	assert := assert.New(t)
+	s := &site{sessions: make(map[string]bool)}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	login := &Login{
+		URL:     ts.URL + "/login",
+		Fields:  map[string]string{"user": "alice", "pass": "secret"},
+		Success: regexp.MustCompile("Welcome"),
+	}
+	client := newClient()
+	assert.NoError(login.Do(client))
+	assert.Equal(url.Values{
+		"csrf":     {"1"},
+		"user":     {"alice"},
+		"pass":     {"secret"},
+		"remember": {"on"},
+		"lang":     {"zh"},
+		"go":       {"Log in"},
+	}, s.form)
+	resp, err := client.Get(ts.URL + "/page")
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal("/page", resp.Request.URL.Path)
+
+	login.Fields["pass"] = "wrong"
+	assert.Equal(ErrLoginFailed, login.Do(newClient()))
+	assert.Error(login.Do(&http.Client{}))
+}
+
+type foreverController struct {
+	crawler.NopController
+}
+
+func (foreverController) Resched(_ *crawler.Response) (bool, crawler.Ticket) {
+	return false, crawler.Ticket{Score: 100}
+}
+
+func TestController(t *testing.T) {
+	assert := assert.New(t)
+	s := &site{sessions: make(map[string]bool)}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c := New(foreverController{}, &Login{
+		URL:    ts.URL + "/login",
+		Fields: map[string]string{"pass": "secret"},
+	}, newClient())
+	c.LoggedOut = RedirectedTo("/login")
+	c.MaxRetries = 1
+	c.Session = "alice"
+
+	u, _ := url.Parse(ts.URL + "/page")
+	fetch := func() *crawler.Response {
+		hreq, _ := http.NewRequest("GET", u.String(), nil)
+		req := &crawler.Request{Request: hreq}
+		c.Prepare(req)
+		assert.Equal("alice", req.Session)
+		resp, err := c.Client.Do(req.Request)
+		assert.NoError(err)
+		resp.Body.Close()
+		return &crawler.Response{
+			Response:  resp,
+			URL:       u,
+			NewURL:    resp.Request.URL,
+			Timestamp: time.Now(),
+			Body:      strings.NewReader("..."),
+		}
+	}
+
+	r := fetch()
+	assert.Equal(1, s.logins)
+	c.Handle(r, nil)
+	done, ticket := c.Resched(r)
+	assert.False(done)
+	assert.Equal(100, ticket.Score)
+
+	logout := func() {
+		s.Lock()
+		s.sessions = make(map[string]bool)
+		s.Unlock()
+	}
+
+	// Logged out by server
+	logout()
+	r = fetch()
+	c.Handle(r, nil)
+	assert.Equal(2, s.logins)
+	// A response received before the login doesn't cause another login.
+	assert.NoError(c.LogIn(r.Timestamp))
+	assert.Equal(2, s.logins)
+	done, ticket = c.Resched(r)
+	assert.False(done)
+	assert.Equal(0, ticket.Score)
+	assert.WithinDuration(time.Now(), ticket.At, time.Second)
+
+	// Logged out again before the retry succeeds.
+	logout()
+	r = fetch()
+	c.Handle(r, nil)
+	assert.Equal(3, s.logins)
+	_, ticket = c.Resched(r)
+	assert.Equal(100, ticket.Score)
+
+	r = fetch()
+	assert.Equal("/page", r.NewURL.Path)
+	c.Handle(r, nil)
+	_, ticket = c.Resched(r)
+	assert.Equal(100, ticket.Score)
+}
+
+type recordController struct {
+	crawler.NopController
+	mu      sync.Mutex
+	handled []string
+}
+
+func (c *recordController) Handle(r *crawler.Response, _ chan<- *url.URL) {
+	c.mu.Lock()
+	c.handled = append(c.handled, r.URL.Path)
+	c.mu.Unlock()
+}
+
+func TestControllerGiveUp(t *testing.T) {
+	assert := assert.New(t)
+	s := &site{sessions: make(map[string]bool), forget: true}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	client := newClient()
+	ctrl := &recordController{}
+	c := New(ctrl, &Login{
+		URL:    ts.URL + "/login",
+		Fields: map[string]string{"pass": "secret"},
+	}, client)
+	c.LoggedOut = RedirectedTo("/login")
+	c.MaxRetries = 2
+
+	opt := *crawler.DefaultOption
+	opt.FollowRedirect = false
+	opt.MinDelay = 0
+	store := crawler.NewMemStore()
+	cw := crawler.New(&crawler.Config{
+		Controller: c,
+		Client:     crawler.NewStdClient(client, nil),
+		Store:      store,
+		Option:     &opt,
+	})
+	assert.NoError(cw.Crawl(ts.URL + "/page"))
+	cw.Wait()
+
+	// The initial login, and one after each logged-out response.
+	assert.Equal(2+c.MaxRetries, s.logins)
+	assert.Empty(ctrl.handled)
+	u, err := store.Get(&url.URL{Scheme: "http", Host: ts.Listener.Addr().String(), Path: "/page"})
+	assert.NoError(err)
+	assert.True(u.Done)
+	assert.Equal("", u.ETag)
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var (
+	// ErrNoForm is returned if the login page has no login form.
+	ErrNoForm = errors.New("auth: login form not found")
+	// ErrLoginFailed is returned if the response to the submitted form
+	// doesn't match Login.Success.
+	ErrLoginFailed = errors.New("auth: login failed")
+	// ErrLoggedOut is the error of a URL whose responses are still logged
+	// out after Controller.MaxRetries revisits.
+	ErrLoggedOut = errors.New("auth: logged out")
+)
+
+// maxPageSize limits the size of pages read during login.
+const maxPageSize = 4 << 20
+
+// Login describes a form-based login sequence: the login page is fetched,
+// its form is filled and submitted, and the response is verified.
+type Login struct {
+	// URL is the login page.
+	URL string
+	// Form selects the login form among <form> elements. If Form is nil,
+	// the first form with a password field is used.
+	Form func(form *html.Node) bool
+	// Fields are filled into the form, e.g., the user name and password.
+	// Other fields, including hidden ones like CSRF tokens, are submitted
+	// with their values in the page.
+	Fields map[string]string
+	// Success must match the body of the final response to the submitted
+	// form. If Success is nil, any 2xx response is a success.
+	Success *regexp.Regexp
+}
+
+// Do logs in using client, whose cookie jar receives the cookies of the
+// logged-in session.
+func (l *Login) Do(client *http.Client) error {
+	if client.Jar == nil {
+		return errors.New("auth: client has no cookie jar")
+	}
+	resp, err := client.Get(l.URL)
+	if err != nil {
+		return err
+	}
+	page, err := readPage(resp)
+	if err != nil {
+		return err
+	}
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return err
+	}
+	form := findForm(doc, l.Form)
+	if form == nil {
+		return ErrNoForm
+	}
+	req, err := l.request(form, resp.Request.URL)
+	if err != nil {
+		return err
+	}
+	if resp, err = client.Do(req); err != nil {
+		return err
+	}
+	if page, err = readPage(resp); err != nil {
+		return err
+	}
+	if l.Success != nil && !l.Success.Match(page) {
+		return ErrLoginFailed
+	}
+	return nil
+}
+
+func readPage(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("auth: %s: unexpected response status: %s",
+			resp.Request.URL, resp.Status)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+}
+
+// request builds the submission of form found in the page at base.
+func (l *Login) request(form *html.Node, base *url.URL) (*http.Request, error) {
+	action, err := base.Parse(attr(form, "action"))
+	if err != nil {
+		return nil, err
+	}
+	action.Fragment = ""
+	values := formValues(form)
+	for k, v := range l.Fields {
+		values.Set(k, v)
+	}
+	if strings.EqualFold(attr(form, "method"), "post") {
+		req, err := http.NewRequest("POST", action.String(),
+			strings.NewReader(values.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Referer", base.String())
+		return req, nil
+	}
+	action.RawQuery = values.Encode()
+	req, err := http.NewRequest("GET", action.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Referer", base.String())
+	return req, nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// walk calls f for each element under n in document order until f returns
+// false.
+func walk(n *html.Node, f func(*html.Node) bool) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && !f(c) {
+			return false
+		}
+		if !walk(c, f) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasPassword(form *html.Node) bool {
+	found := false
+	walk(form, func(n *html.Node) bool {
+		found = n.DataAtom == atom.Input &&
+			strings.EqualFold(attr(n, "type"), "password")
+		return !found
+	})
+	return found
+}
+
+func findForm(doc *html.Node, match func(*html.Node) bool) (form *html.Node) {
+	if match == nil {
+		match = hasPassword
+	}
+	walk(doc, func(n *html.Node) bool {
+		if n.DataAtom == atom.Form && match(n) {
+			form = n
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// formValues returns the values that a browser would submit with form
+// without user input. The first named submit button is included.
+func formValues(form *html.Node) url.Values {
+	values := url.Values{}
+	submitted := false
+	walk(form, func(n *html.Node) bool {
+		name := attr(n, "name")
+		if name == "" || hasAttr(n, "disabled") {
+			return true
+		}
+		switch n.DataAtom {
+		case atom.Input:
+			switch strings.ToLower(attr(n, "type")) {
+			case "submit", "image":
+				if !submitted {
+					values.Add(name, attr(n, "value"))
+					submitted = true
+				}
+			case "checkbox", "radio":
+				if hasAttr(n, "checked") {
+					v := attr(n, "value")
+					if !hasAttr(n, "value") {
+						v = "on"
+					}
+					values.Add(name, v)
+				}
+			case "button", "reset", "file":
+			default:
+				values.Add(name, attr(n, "value"))
+			}
+		case atom.Button:
+			t := strings.ToLower(attr(n, "type"))
+			if (t == "" || t == "submit") && !submitted {
+				values.Add(name, attr(n, "value"))
+				submitted = true
+			}
+		case atom.Textarea:
+			values.Add(name, text(n))
+		case atom.Select:
+			var first, selected *html.Node
+			walk(n, func(o *html.Node) bool {
+				if o.DataAtom != atom.Option {
+					return true
+				}
+				if first == nil {
+					first = o
+				}
+				if hasAttr(o, "selected") {
+					selected = o
+					return false
+				}
+				return true
+			})
+			if selected == nil {
+				selected = first
+			}
+			if selected != nil {
+				v := attr(selected, "value")
+				if !hasAttr(selected, "value") {
+					v = strings.TrimSpace(text(selected))
+				}
+				values.Add(name, v)
+			}
+		}
+		return true
+	})
+	return values
+}
+
+func text(n *html.Node) string {
+	var b bytes.Buffer
+	var f func(*html.Node)
+	f = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			f(c)
+		}
+	}
+	f(n)
+	return b.String()
+}
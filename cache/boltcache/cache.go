@@ -0,0 +1,389 @@
+// Package boltcache implements cache.Storage on bolt, so that cached
+// responses survive restarts.
+package boltcache
+
+import (
+	"container/list"
+	"encoding/binary"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/fanyang01/crawler/cache"
+	"github.com/fanyang01/crawler/codec"
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+var (
+	bkEntry  = []byte("ENTRY_BUCKET")
+	bkAccess = []byte("ACCESS_BUCKET")
+)
+
+// record is a stored response.
+type record struct {
+	URL        string // URL of the request
+	Status     string
+	StatusCode int
+	Proto      string
+	ProtoMajor int
+	ProtoMinor int
+	Header     http.Header
+	Control    cache.Control
+	Body       []byte
+}
+
+// item is an entry of the LRU list.
+type item struct {
+	key   string
+	size  int64
+	atime int64
+	dirty bool // atime has not been written
+}
+
+// Cache is a cache.Storage bounded by the total size of stored records.
+// The least recently used records are evicted when the size exceeds the
+// limit. Access times are kept in memory and written on Set and Close,
+// so the order of eviction survives restarts unless the process crashes.
+// Errors of Set, Update and Remove, which can't be returned, are logged to
+// Logger, which discards them by default.
+type Cache struct {
+	DB     *bolt.DB
+	Logger log15.Logger
+	codec  codec.Codec
+
+	mu    sync.Mutex
+	max   int64
+	size  int64
+	lru   *list.List // front is the most recently used
+	index map[string]*list.Element
+}
+
+// New opens or creates a cache at path. max is the maximum total size(in
+// bytes) of stored records.
+func New(path string, opt *bolt.Options, max int64) (c *Cache, err error) {
+	c = &Cache{
+		Logger: log15.New(),
+		codec:  codec.Gob,
+		max:    max,
+		lru:    list.New(),
+		index:  make(map[string]*list.Element),
+	}
+	c.Logger.SetHandler(log15.DiscardHandler())
+	if c.DB, err = bolt.Open(path, 0644, opt); err != nil {
+		return nil, err
+	}
+	if err = c.DB.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bkEntry)
+		if err != nil {
+			return err
+		}
+		a, err := tx.CreateBucketIfNotExists(bkAccess)
+		if err != nil {
+			return err
+		}
+		var items []*item
+		if err = b.ForEach(func(k, v []byte) error {
+			it := &item{key: string(k), size: int64(len(v))}
+			if t := a.Get(k); len(t) == 8 {
+				it.atime = int64(binary.BigEndian.Uint64(t))
+			}
+			items = append(items, it)
+			return nil
+		}); err != nil {
+			return err
+		}
+		sort.Sort(byAtime(items))
+		for _, it := range items {
+			c.index[it.key] = c.lru.PushBack(it)
+			c.size += it.size
+		}
+		victims, err := c.evict(tx, c.size, "")
+		if err != nil {
+			return err
+		}
+		for _, e := range victims {
+			c.remove(e)
+		}
+		return nil
+	}); err != nil {
+		c.DB.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+type byAtime []*item
+
+func (s byAtime) Len() int           { return len(s) }
+func (s byAtime) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byAtime) Less(i, j int) bool { return s[i].atime > s[j].atime }
+
+// touch moves key to the front of LRU list.
+func (c *Cache) touch(key string) {
+	if e, ok := c.index[key]; ok {
+		it := e.Value.(*item)
+		it.atime, it.dirty = time.Now().UnixNano(), true
+		c.lru.MoveToFront(e)
+	}
+}
+
+// evict deletes in tx the least recently used records other than keep,
+// starting from the tail, while size is over the limit. It returns the
+// elements of the deleted records, which are left in the LRU list for
+// the caller to remove once tx is committed.
+func (c *Cache) evict(tx *bolt.Tx, size int64, keep string) ([]*list.Element, error) {
+	b, a := tx.Bucket(bkEntry), tx.Bucket(bkAccess)
+	var victims []*list.Element
+	for e := c.lru.Back(); e != nil && size > c.max; e = e.Prev() {
+		it := e.Value.(*item)
+		if it.key == keep {
+			continue
+		}
+		if err := b.Delete([]byte(it.key)); err != nil {
+			return nil, err
+		}
+		if err := a.Delete([]byte(it.key)); err != nil {
+			return nil, err
+		}
+		size -= it.size
+		victims = append(victims, e)
+	}
+	return victims, nil
+}
+
+func (c *Cache) remove(e *list.Element) {
+	it := c.lru.Remove(e).(*item)
+	delete(c.index, it.key)
+	c.size -= it.size
+}
+
+func putAtime(a *bolt.Bucket, key string, atime int64) error {
+	t := make([]byte, 8)
+	binary.BigEndian.PutUint64(t, uint64(atime))
+	return a.Put([]byte(key), t)
+}
+
+// flush writes in tx access times that have changed. It returns the
+// items written, which are still marked dirty until tx is committed.
+func (c *Cache) flush(tx *bolt.Tx) ([]*item, error) {
+	a := tx.Bucket(bkAccess)
+	var flushed []*item
+	for e := c.lru.Front(); e != nil; e = e.Next() {
+		if it := e.Value.(*item); it.dirty {
+			if err := putAtime(a, it.key, it.atime); err != nil {
+				return nil, err
+			}
+			flushed = append(flushed, it)
+		}
+	}
+	return flushed, nil
+}
+
+// put stores v with key in tx. The LRU list is not modified; the returned
+// function applies the changes to it and must be called only after tx is
+// committed.
+func (c *Cache) put(tx *bolt.Tx, key string, v []byte) (func(), error) {
+	if err := tx.Bucket(bkEntry).Put([]byte(key), v); err != nil {
+		return nil, err
+	}
+	size, total := int64(len(v)), c.size+int64(len(v))
+	e, ok := c.index[key]
+	if ok {
+		total -= e.Value.(*item).size
+	}
+	flushed, err := c.flush(tx)
+	if err != nil {
+		return nil, err
+	}
+	atime := time.Now().UnixNano()
+	if err := putAtime(tx.Bucket(bkAccess), key, atime); err != nil {
+		return nil, err
+	}
+	victims, err := c.evict(tx, total, key)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		for _, it := range flushed {
+			it.dirty = false
+		}
+		if ok {
+			it := e.Value.(*item)
+			c.size += size - it.size
+			it.size, it.atime = size, atime
+			c.lru.MoveToFront(e)
+		} else {
+			c.index[key] = c.lru.PushFront(&item{key: key, size: size, atime: atime})
+			c.size += size
+		}
+		for _, e := range victims {
+			c.remove(e)
+		}
+	}, nil
+}
+
+// update runs put in a transaction and applies the changes to the LRU
+// list if it is committed.
+func (c *Cache) update(key string, v []byte) error {
+	var apply func()
+	if err := c.DB.Update(func(tx *bolt.Tx) (err error) {
+		apply, err = c.put(tx, key, v)
+		return
+	}); err != nil {
+		return err
+	}
+	apply()
+	return nil
+}
+
+func (c *Cache) get(key string) (rec *record, err error) {
+	err = c.DB.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(bkEntry).Get([]byte(key))
+		if v == nil {
+			return nil
+		}
+		rec = &record{}
+		return c.codec.Unmarshal(v, rec)
+	})
+	return
+}
+
+// Get implements cache.Storage.
+func (c *Cache) Get(key string) (r *http.Response, body []byte, cc *cache.Control, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rec, err := c.get(key)
+	if err != nil || rec == nil {
+		return
+	}
+	u, err := url.Parse(rec.URL)
+	if err != nil {
+		return
+	}
+	c.touch(key)
+	r = &http.Response{
+		Status:        rec.Status,
+		StatusCode:    rec.StatusCode,
+		Proto:         rec.Proto,
+		ProtoMajor:    rec.ProtoMajor,
+		ProtoMinor:    rec.ProtoMinor,
+		Header:        rec.Header,
+		ContentLength: int64(len(rec.Body)),
+		Request:       &http.Request{Method: "GET", URL: u, Header: http.Header{}},
+	}
+	return r, rec.Body, &rec.Control, true
+}
+
+// Set implements cache.Storage.
+func (c *Cache) Set(key string, cc *cache.Control, r *http.Response, body []byte) {
+	if cc == nil || !cc.IsCacheable() {
+		return
+	}
+	rec := &record{
+		Status:     r.Status,
+		StatusCode: r.StatusCode,
+		Proto:      r.Proto,
+		ProtoMajor: r.ProtoMajor,
+		ProtoMinor: r.ProtoMinor,
+		Header:     r.Header,
+		Control:    *cc,
+		Body:       body,
+	}
+	if r.Request != nil {
+		rec.URL = r.Request.URL.String()
+	}
+	v, err := c.codec.Marshal(rec)
+	if err != nil {
+		c.Logger.Error("encode response", "key", key, "err", err)
+		return
+	}
+	if int64(len(v)) > c.max {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.update(key, v); err != nil {
+		c.Logger.Error("store response", "key", key, "err", err)
+	}
+}
+
+// Update implements cache.Storage.
+func (c *Cache) Update(key string, cc *cache.Control, h http.Header) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rec, err := c.get(key)
+	if err != nil || rec == nil {
+		return false
+	}
+	// rfc2616 13.12 Cache Replacement
+	if cc != nil && cc.Date.Before(rec.Control.Date) {
+		return true
+	}
+	if cc == nil || !cc.IsCacheable() {
+		c.removeKey(key)
+		return true
+	}
+	rec.Control, rec.Header = *cc, h
+	v, err := c.codec.Marshal(rec)
+	if err != nil {
+		c.Logger.Error("encode response", "key", key, "err", err)
+		return false
+	}
+	// The stale record is kept if it fails; it will be revalidated again.
+	if err := c.update(key, v); err != nil {
+		c.Logger.Error("update response", "key", key, "err", err)
+	}
+	return true
+}
+
+// Remove implements cache.Storage.
+func (c *Cache) Remove(key string) {
+	c.mu.Lock()
+	c.removeKey(key)
+	c.mu.Unlock()
+}
+
+func (c *Cache) removeKey(key string) {
+	e, ok := c.index[key]
+	if !ok {
+		return
+	}
+	if err := c.DB.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(bkEntry).Delete([]byte(key)); err != nil {
+			return err
+		}
+		return tx.Bucket(bkAccess).Delete([]byte(key))
+	}); err != nil {
+		c.Logger.Error("remove response", "key", key, "err", err)
+		return
+	}
+	c.remove(e)
+}
+
+// Size returns the total size of stored records.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// Close writes access times and closes the database.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var flushed []*item
+	if err := c.DB.Update(func(tx *bolt.Tx) (err error) {
+		flushed, err = c.flush(tx)
+		return
+	}); err != nil {
+		c.DB.Close()
+		return err
+	}
+	for _, it := range flushed {
+		it.dirty = false
+	}
+	return c.DB.Close()
+}
@@ -0,0 +1,131 @@
+package boltcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler/cache"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/inconshreveable/log15.v2"
+)
+
+var _ cache.Storage = &Cache{}
+
+func response(s string) *http.Response {
+	u, _ := url.Parse(s)
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"Etag": []string{`"x"`}},
+		Request:    &http.Request{URL: u},
+	}
+}
+
+func TestCache(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "test_boltcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.db")
+
+	c, err := New(path, nil, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cc := &cache.Control{
+		CacheType: cache.CacheNormal,
+		Date:      time.Now().UTC(),
+		MaxAge:    time.Hour,
+		ETag:      `"x"`,
+	}
+	body := []byte("hello")
+	c.Set("a", cc, response("http://example.com/a"), body)
+	c.Set("b", cc, response("http://example.com/b"), body)
+	c.Set("c", &cache.Control{}, response("http://example.com/c"), body)
+
+	r, b, rcc, ok := c.Get("a")
+	assert.True(ok)
+	assert.Equal(body, b)
+	assert.Equal(200, r.StatusCode)
+	assert.Equal(`"x"`, r.Header.Get("ETag"))
+	assert.Equal("http://example.com/a", r.Request.URL.String())
+	assert.Equal(time.Hour, rcc.MaxAge)
+	_, _, _, ok = c.Get("c")
+	assert.False(ok)
+
+	assert.True(c.Update("b", cc, http.Header{"Etag": []string{`"y"`}}))
+	assert.False(c.Update("c", cc, nil))
+	size := c.Size()
+	assert.NoError(c.Close())
+
+	// Reopen with a limit that holds only one record. "a" has been used
+	// less recently than "b".
+	c, err = New(path, nil, size/2+64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, _, _, ok = c.Get("a")
+	assert.False(ok)
+	r, _, _, ok = c.Get("b")
+	assert.True(ok)
+	assert.Equal(`"y"`, r.Header.Get("ETag"))
+
+	c.Set("d", cc, response("http://example.com/d"), []byte(strings.Repeat("x", 16)))
+	_, _, _, ok = c.Get("b")
+	assert.False(ok)
+	_, _, _, ok = c.Get("d")
+	assert.True(ok)
+
+	c.Remove("d")
+	_, _, _, ok = c.Get("d")
+	assert.False(ok)
+	assert.Equal(int64(0), c.Size())
+}
+
+func TestCacheFailedUpdate(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "test_boltcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := New(filepath.Join(dir, "cache.db"), nil, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logged []string
+	c.Logger.SetHandler(log15.FuncHandler(func(r *log15.Record) error {
+		logged = append(logged, r.Msg)
+		return nil
+	}))
+	cc := &cache.Control{
+		CacheType: cache.CacheNormal,
+		Date:      time.Now().UTC(),
+		MaxAge:    time.Hour,
+	}
+	c.Set("a", cc, response("http://example.com/a"), []byte("hello"))
+	size := c.Size()
+
+	// The in-memory index is unchanged if the transaction fails.
+	c.DB.Close()
+	c.Set("b", cc, response("http://example.com/b"), []byte("hello"))
+	assert.Equal(size, c.Size())
+	_, ok := c.index["b"]
+	assert.False(ok)
+	c.Remove("a")
+	assert.Equal(size, c.Size())
+	assert.Equal([]string{"store response", "remove response"}, logged)
+}
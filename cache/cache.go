@@ -5,8 +5,10 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -19,32 +21,75 @@ const (
 	CacheNormal
 )
 
+// Control is the caching metadata of a response.
 type Control struct {
-	CacheType    int
-	Date         time.Time
-	Timestamp    time.Time
-	Age          time.Duration
+	CacheType int
+	Date      time.Time
+	// Timestamp is the time when the response was received.
+	Timestamp time.Time
+	// Age is the corrected initial age of the response.
+	Age time.Duration
+	// MaxAge is the freshness lifetime of the response.
 	MaxAge       time.Duration
 	ETag         string
 	LastModified time.Time
+
+	// Heuristic is true if MaxAge is computed from LastModified because
+	// no explicit expiration time is given.
+	Heuristic      bool
+	Private        bool
+	MustRevalidate bool
+	// A stale response may be served for StaleWhileRevalidate while it's
+	// being revalidated, or for StaleIfError if the revalidation fails.
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	// Vary is the canonical names of request headers listed in Vary.
+	Vary []string
+}
+
+// heuristicFraction is the fraction of the time since last modification
+// used as the heuristic freshness lifetime.
+const heuristicFraction = 10
+
+// CurrentAge returns the age of the response now.
+func (cc *Control) CurrentAge() time.Duration {
+	return cc.Age + time.Now().Sub(cc.Timestamp)
 }
 
 func (cc *Control) IsExpired() bool {
-	age := computeAge(cc.Date, cc.Timestamp, cc.Age)
-	if age > cc.MaxAge {
-		return true
-	}
-	return false
+	return cc.CurrentAge() > cc.MaxAge
+}
+
+// staleness returns how long the response has been stale.
+func (cc *Control) staleness() time.Duration {
+	return cc.CurrentAge() - cc.MaxAge
+}
+
+// canServeStale reports whether the response, which is stale for less
+// than d, may be served.
+func (cc *Control) canServeStale(d time.Duration) bool {
+	return cc.CacheType == CacheNormal && !cc.MustRevalidate &&
+		d > 0 && cc.staleness() <= d
+}
+
+// ServeWhileRevalidate reports whether the stale response may be served
+// while it's revalidated in background.
+func (cc *Control) ServeWhileRevalidate() bool {
+	return cc.canServeStale(cc.StaleWhileRevalidate)
+}
+
+// ServeOnError reports whether the stale response may be served if the
+// revalidation fails.
+func (cc *Control) ServeOnError() bool {
+	return cc.canServeStale(cc.StaleIfError)
 }
 
-// Use a simplified calculation of rfc2616-sec13.
+// computeAge computes the corrected initial age of a response received at
+// resp. See RFC 9111 section 4.2.3.
 func computeAge(date, resp time.Time, age time.Duration) time.Duration {
 	apparent := max64(0, resp.Sub(date))
-	recv := max64(apparent, age)
-	// assume delay = 0
-	// initial := recv + delay
-	resident := time.Now().Sub(resp)
-	return recv + resident
+	// assume response_delay = 0
+	return max64(apparent, age)
 }
 
 func max64(x, y time.Duration) time.Duration {
@@ -54,102 +99,149 @@ func max64(x, y time.Duration) time.Duration {
 	return y
 }
 
-// https://www.w3.org/Protocols/rfc2616/rfc2616-sec13.html
+func parseSeconds(s string) (d time.Duration, ok bool) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || i < 0 {
+		return 0, false
+	}
+	if i > math.MaxInt32 {
+		i = math.MaxInt32
+	}
+	return time.Duration(i) * time.Second, true
+}
+
+// Status codes that are cacheable by default. See RFC 9110 section
+// 15.1.
+func heuristicallyCacheable(code int) bool {
+	switch code {
+	case 200, 203, 204, 206, 300, 301, 308, 404, 405, 410, 414, 501:
+		return true
+	}
+	return false
+}
+
+// Parse parses the caching metadata of a response received at rt for a
+// private cache, i.e., a cache used only by the crawler. It returns nil
+// if the response must not be stored. See RFC 9111.
 func Parse(r *http.Response, rt time.Time) *Control {
+	return parse(r, rt, false)
+}
+
+// ParseShared is like Parse, but for a shared cache, which must not store
+// private responses and prefers s-maxage to max-age.
+func ParseShared(r *http.Response, rt time.Time) *Control {
+	return parse(r, rt, true)
+}
+
+func parse(r *http.Response, rt time.Time, shared bool) *Control {
 	var (
-		cc     Control
-		err    error
-		maxAge = time.Duration(-1)
-		kv     = map[string]string{}
+		cc       Control
+		explicit bool
+		kv       = parseCacheControl(strings.Join(r.Header["Cache-Control"], ","))
 	)
-	switch r.StatusCode {
-	case 200, 203, 206, 300, 301:
-	default:
+	exist := func(directive string) bool {
+		_, ok := kv[directive]
+		return ok
+	}
+	if exist("no-store") || (shared && exist("private")) {
 		return nil
 	}
-	cc.Timestamp = rt
-	cc.Date = rt
-	if t := r.Header.Get("Date"); t != "" {
-		if cc.Date, err = time.Parse(http.TimeFormat, t); err == nil {
-			cc.Date = rt
-		}
+	if shared && r.Request != nil && r.Request.Header.Get("Authorization") != "" &&
+		!exist("public") && !exist("s-maxage") && !exist("must-revalidate") {
+		return nil
 	}
-	if s := r.Header.Get("Cache-Control"); s != "" {
-		kv = parseCacheControl(s)
-		var sec int64 = -1
-		if v, ok := kv["max-age"]; ok {
-			if i, err := strconv.ParseInt(v, 0, 32); err == nil {
-				sec = i
-			}
-		}
-		if v, ok := kv["s-maxage"]; ok {
-			if i, err := strconv.ParseInt(v, 0, 32); err == nil && i > sec {
-				sec = i
+	for _, v := range r.Header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return nil
+			} else if name != "" {
+				cc.Vary = append(cc.Vary, http.CanonicalHeaderKey(name))
 			}
 		}
-		if sec >= 0 {
-			maxAge = time.Duration(sec) * time.Second
-		} else {
-			if t := r.Header.Get("Expires"); t != "" {
-				expire, err := time.Parse(http.TimeFormat, t)
-				if err == nil && !cc.Date.IsZero() {
-					maxAge = expire.Sub(cc.Date)
-				}
-			}
+	}
+	sort.Strings(cc.Vary)
+
+	cc.Timestamp = rt
+	cc.Date = rt
+	if t, err := http.ParseTime(r.Header.Get("Date")); err == nil {
+		cc.Date = t
+	}
+	cc.ETag = r.Header.Get("ETag")
+	if t := r.Header.Get("Last-Modified"); t != "" {
+		cc.LastModified, _ = http.ParseTime(t)
+	}
+
+	// Freshness lifetime. See RFC 9111 section 4.2.1.
+	if d, ok := parseSeconds(kv["s-maxage"]); shared && ok {
+		cc.MaxAge, explicit = d, true
+	} else if d, ok := parseSeconds(kv["max-age"]); ok {
+		cc.MaxAge, explicit = d, true
+	} else if v, ok := r.Header["Expires"]; ok {
+		// An invalid date represents a time in the past.
+		if t, err := http.ParseTime(v[0]); err == nil {
+			cc.MaxAge = max64(0, t.Sub(cc.Date))
 		}
+		explicit = true
+	} else if !cc.LastModified.IsZero() && heuristicallyCacheable(r.StatusCode) {
+		cc.MaxAge = max64(0, cc.Date.Sub(cc.LastModified)/heuristicFraction)
+		cc.Heuristic = true
 	}
-	exist := func(directive string) bool {
-		_, ok := kv[directive]
-		return ok
+	switch {
+	case heuristicallyCacheable(r.StatusCode):
+	case explicit && r.StatusCode >= 200 && r.StatusCode < 600 &&
+		r.StatusCode != 304 && r.StatusCode != 206:
+	default:
+		return nil
 	}
-	// Cachable
+
 	cc.CacheType = CacheNormal
 	switch {
-	case exist("no-store"):
-		return nil
 	case exist("no-cache"):
-		maxAge = 0
+		cc.MaxAge = 0
+		cc.CacheType = CacheNeedValidate
+	case !explicit && !cc.Heuristic && !exist("public"):
+		// Without freshness information, the response is stored only
+		// if it can be revalidated.
+		if cc.ETag == "" && cc.LastModified.IsZero() {
+			return nil
+		}
 		cc.CacheType = CacheNeedValidate
-	case exist("must-revalidate"):
-		maxAge = 0
-		cc.CacheType = CacheNormal // TODO: special type?
-	case maxAge < 0:
-		return nil
 	}
-	cc.MaxAge = maxAge
+	cc.Private = exist("private")
+	cc.MustRevalidate = exist("must-revalidate") ||
+		(shared && (exist("proxy-revalidate") || exist("s-maxage")))
+	cc.StaleWhileRevalidate, _ = parseSeconds(kv["stale-while-revalidate"])
+	cc.StaleIfError, _ = parseSeconds(kv["stale-if-error"])
 
 	var age time.Duration
-	if a := r.Header.Get("Age"); a != "" {
-		if seconds, err := strconv.ParseInt(a, 0, 32); err == nil {
-			age = time.Duration(seconds) * time.Second
-		}
+	if a, ok := parseSeconds(r.Header.Get("Age")); ok {
+		age = a
 	}
 	cc.Age = computeAge(cc.Date, rt, age)
-
-	cc.ETag = r.Header.Get("ETag")
-	if t := r.Header.Get("Last-Modified"); t != "" {
-		cc.LastModified, _ = time.Parse(http.TimeFormat, t)
-	}
 	return &cc
 }
 
+// parseCacheControl parses the directives of Cache-Control. Names are
+// lowercased and quoted values are unquoted.
 func parseCacheControl(s string) (kv map[string]string) {
 	kv = make(map[string]string)
-	parts := strings.Split(strings.TrimSpace(s), ",")
-	if len(parts) == 1 && parts[0] == "" {
-		return
-	}
-	for i := 0; i < len(parts); i++ {
-		parts[i] = strings.TrimSpace(parts[i])
-		if len(parts[i]) == 0 {
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
 			continue
 		}
-		name, val := parts[i], ""
+		name, val := part, ""
 		if j := strings.Index(name, "="); j >= 0 {
-			val = strings.TrimLeft(name[j+1:], " \t\r\n\f")
-			name = strings.TrimRight(name[:j], " \t\r\n\f")
+			val = strings.TrimSpace(name[j+1:])
+			name = strings.TrimSpace(name[:j])
+			if n := len(val); n >= 2 && val[0] == '"' && val[n-1] == '"' {
+				val = val[1 : n-1]
+			}
+		}
+		name = strings.ToLower(name)
+		if _, ok := kv[name]; !ok {
+			kv[name] = val
 		}
-		kv[name] = val
 	}
 	return
 }
@@ -167,12 +259,110 @@ func (cc *Control) NeedValidate() bool {
 		(cc.CacheType == CacheNormal && cc.IsExpired())
 }
 
+// Storage stores cached responses by keys, which are usually produced
+// by Key. Implementations must be safe for concurrent use.
+type Storage interface {
+	// Get returns the response, body and metadata stored with key. The
+	// body of r is not set.
+	Get(key string) (r *http.Response, body []byte, cc *Control, ok bool)
+	// Set stores a response with key. It does nothing if cc is nil or
+	// not cacheable.
+	Set(key string, cc *Control, r *http.Response, body []byte)
+	// Update replaces the metadata and header of the response stored
+	// with key after it has been revalidated. It reports whether there
+	// is such a response.
+	Update(key string, cc *Control, h http.Header) bool
+	// Remove removes the response stored with key.
+	Remove(key string)
+}
+
+// Key returns the cache key of u.
+func Key(u *url.URL) string { return u.String() }
+
+// VariantKey returns the secondary key of the variant selected by the
+// request header h, given the response at key varies by vary. See RFC
+// 9111 section 4.1.
+func VariantKey(key string, vary []string, h http.Header) string {
+	if len(vary) == 0 {
+		return key
+	}
+	var buf bytes.Buffer
+	buf.WriteString(key)
+	for _, name := range vary {
+		buf.WriteString("\n")
+		buf.WriteString(name)
+		buf.WriteString(":")
+		for i, v := range h[name] {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			for j, f := range strings.Split(v, ",") {
+				if j > 0 {
+					buf.WriteString(",")
+				}
+				buf.WriteString(strings.TrimSpace(f))
+			}
+		}
+	}
+	return buf.String()
+}
+
+// Lookup returns the response stored in s with key for a request with
+// header h. If the stored response varies, the variant selected by h is
+// returned, and vkey is the key of the variant.
+func Lookup(s Storage, key string, h http.Header) (
+	r *http.Response, body []byte, cc *Control, vkey string, ok bool,
+) {
+	if r, body, cc, ok = s.Get(key); !ok || len(cc.Vary) == 0 {
+		return r, body, cc, key, ok
+	}
+	vkey = VariantKey(key, cc.Vary, h)
+	r, body, cc, ok = s.Get(vkey)
+	return
+}
+
+// Store returns the key under which a response to a request with header
+// h should be stored. If the response varies, the response without body
+// is stored with key to record the Vary list, and the key of the variant
+// is returned.
+func Store(s Storage, key string, cc *Control, r *http.Response, h http.Header) string {
+	if len(cc.Vary) == 0 {
+		return key
+	}
+	s.Set(key, cc, r, nil)
+	return VariantKey(key, cc.Vary, h)
+}
+
+// CopyResponse returns a copy of r with its own header, so that the copy
+// can be modified without affecting r. The body is not copied.
+func CopyResponse(r *http.Response) *http.Response {
+	c := *r
+	c.Header = copyHeader(r.Header)
+	return &c
+}
+
+func copyHeader(h http.Header) http.Header {
+	c := make(http.Header, len(h))
+	for k, vv := range h {
+		c[k] = append([]string(nil), vv...)
+	}
+	return c
+}
+
+// Copy returns a copy of cc.
+func (cc *Control) Copy() *Control {
+	c := *cc
+	c.Vary = append([]string(nil), cc.Vary...)
+	return &c
+}
+
 type entry struct {
 	r    *http.Response
 	ctrl *Control
 	body []byte
 }
 
+// Pool is an in-memory storage bounded by the total size of bodies.
 type Pool struct {
 	size int
 	max  int
@@ -187,11 +377,10 @@ func NewPool(max int) *Pool {
 	}
 }
 
-func (p *Pool) Set(u *url.URL, cc *Control, r *http.Response, b []byte) {
+func (p *Pool) Set(us string, cc *Control, r *http.Response, b []byte) {
 	if cc == nil || !cc.IsCacheable() {
 		return
 	}
-	us := u.String()
 
 	p.Lock()
 	defer p.Unlock()
@@ -207,16 +396,18 @@ func (p *Pool) Set(u *url.URL, cc *Control, r *http.Response, b []byte) {
 		p.size -= len(e.body)
 		delete(p.m, k)
 	}
+	// The caller keeps using r and cc.
+	r = CopyResponse(r)
+	r.Body = nil
 	p.m[us] = &entry{
 		r:    r,
-		ctrl: cc,
+		ctrl: cc.Copy(),
 		body: b,
 	}
 	p.size += len(b)
 }
 
-func (p *Pool) Update(u *url.URL, cc *Control, h http.Header) bool {
-	us := u.String()
+func (p *Pool) Update(us string, cc *Control, h http.Header) bool {
 	p.Lock()
 	defer p.Unlock()
 
@@ -224,32 +415,32 @@ func (p *Pool) Update(u *url.URL, cc *Control, h http.Header) bool {
 	if e == nil {
 		return false
 	}
-	// rfc2616 13.12 Cache Replacement
-	if cc.Date.Before(e.ctrl.Date) {
-		return true
-	}
 	if cc == nil || !cc.IsCacheable() {
 		p.remove(us)
 		return true
 	}
-	e.ctrl = cc
-	e.r.Header = h
+	// rfc2616 13.12 Cache Replacement
+	if cc.Date.Before(e.ctrl.Date) {
+		return true
+	}
+	e.ctrl = cc.Copy()
+	e.r.Header = copyHeader(h)
 	return true
 }
 
-func (p *Pool) Get(u *url.URL) (r *http.Response, b []byte, cc *Control, ok bool) {
-	us := u.String()
+// Get returns copies of the stored response and metadata, which the caller
+// may modify. The body is shared and must not be modified.
+func (p *Pool) Get(us string) (r *http.Response, b []byte, cc *Control, ok bool) {
 	p.RLock()
+	defer p.RUnlock()
 	e, ok := p.m[us]
-	p.RUnlock()
 	if ok {
-		r, b, cc = e.r, e.body, e.ctrl
+		r, b, cc = CopyResponse(e.r), e.body, e.ctrl.Copy()
 	}
 	return
 }
 
-func (p *Pool) Remove(u *url.URL) {
-	us := u.String()
+func (p *Pool) Remove(us string) {
 	p.Lock()
 	p.remove(us)
 	p.Unlock()
@@ -263,9 +454,13 @@ func (p *Pool) remove(us string) {
 	}
 }
 
+// Construct updates the stored response r with the header of a 304
+// response newr, and sets the body to b. See RFC 9111 section 3.2.
 func Construct(r, newr *http.Response, b []byte) *http.Response {
-	// TODO: only copy end-to-end headers
 	for k, vv := range newr.Header {
+		if !updatable(k) {
+			continue
+		}
 		r.Header.Del(k)
 		for _, v := range vv {
 			r.Header.Add(k, v)
@@ -275,27 +470,42 @@ func Construct(r, newr *http.Response, b []byte) *http.Response {
 	return r
 }
 
+// updatable reports whether the header field of a stored response can be
+// updated by a 304 response. Hop-by-hop fields and fields describing the
+// body are excluded.
+func updatable(name string) bool {
+	switch http.CanonicalHeaderKey(name) {
+	case "Connection", "Keep-Alive", "Proxy-Connection", "Te",
+		"Trailer", "Transfer-Encoding", "Upgrade",
+		"Content-Length", "Content-Encoding", "Content-Range":
+		return false
+	}
+	return true
+}
+
 type cacheReader struct {
-	url      *url.URL
+	key      string
 	response *http.Response
 	cc       *Control
 	buf      *bytes.Buffer
-	pool     *Pool
+	storage  Storage
 	err      error
 	status   int
 	tee      io.Reader
 }
 
-func (p *Pool) NewReader(u *url.URL, cc *Control,
+// NewReader returns a reader that reads from reader and stores the
+// response with key into s after reaching EOF.
+func NewReader(s Storage, key string, cc *Control,
 	r *http.Response, reader io.Reader) io.Reader {
 
 	buf := new(bytes.Buffer)
 	return &cacheReader{
-		url:      u,
+		key:      key,
 		cc:       cc,
 		response: r,
 		buf:      buf,
-		pool:     p,
+		storage:  s,
 		tee:      io.TeeReader(reader, buf),
 	}
 }
@@ -313,7 +523,7 @@ func (c *cacheReader) Read(p []byte) (n int, err error) {
 		if err != nil {
 			if err == io.EOF {
 				c.status = statusEOF
-				c.pool.Set(c.url, c.cc, c.response, c.buf.Bytes())
+				c.storage.Set(c.key, c.cc, c.response, c.buf.Bytes())
 			} else {
 				c.status = statusError
 			}
@@ -39,3 +39,80 @@ func TestParse(t *testing.T) {
 		assert.Equal(v.cc.CacheType, cc.CacheType)
 	}
 }
+
+func TestParseRFC7234(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC().Truncate(time.Second)
+	resp := func(code int, kv ...string) *http.Response {
+		r := &http.Response{StatusCode: code, Header: http.Header{}}
+		for i := 0; i < len(kv); i += 2 {
+			r.Header.Add(kv[i], kv[i+1])
+		}
+		return r
+	}
+
+	cc := Parse(resp(200,
+		"Date", now.Format(http.TimeFormat),
+		"Last-Modified", now.Add(-10*time.Hour).Format(http.TimeFormat),
+	), now)
+	assert.True(cc.Heuristic)
+	assert.Equal(time.Hour, cc.MaxAge)
+	assert.Equal(CacheNormal, cc.CacheType)
+
+	cc = Parse(resp(200,
+		"Cache-Control", `max-age=60, Must-Revalidate, stale-if-error="30"`,
+		"Cache-Control", "stale-while-revalidate=10",
+		"Vary", "accept-encoding, Accept-Language",
+	), now)
+	assert.Equal(time.Minute, cc.MaxAge)
+	assert.True(cc.MustRevalidate)
+	assert.Equal(30*time.Second, cc.StaleIfError)
+	assert.Equal(10*time.Second, cc.StaleWhileRevalidate)
+	assert.Equal([]string{"Accept-Encoding", "Accept-Language"}, cc.Vary)
+
+	// Stored only if it can be revalidated.
+	assert.Nil(Parse(resp(200), now))
+	cc = Parse(resp(200, "ETag", `"x"`), now)
+	assert.Equal(CacheNeedValidate, cc.CacheType)
+
+	assert.Nil(Parse(resp(200, "Cache-Control", "max-age=60", "Vary", "*"), now))
+	assert.Nil(Parse(resp(302, "ETag", `"x"`), now))
+	assert.NotNil(Parse(resp(302, "Cache-Control", "max-age=60"), now))
+
+	private := resp(200, "Cache-Control", "private, max-age=60, s-maxage=600")
+	assert.True(Parse(private, now).Private)
+	assert.Equal(time.Minute, Parse(private, now).MaxAge)
+	assert.Nil(ParseShared(private, now))
+	shared := resp(200, "Cache-Control", "max-age=60, s-maxage=600")
+	assert.Equal(10*time.Minute, ParseShared(shared, now).MaxAge)
+
+	cc = Parse(resp(200,
+		"Cache-Control", "max-age=60, stale-if-error=120",
+		"Date", now.Add(-90*time.Second).Format(http.TimeFormat),
+	), now)
+	assert.True(cc.NeedValidate())
+	assert.True(cc.ServeOnError())
+	assert.False(cc.ServeWhileRevalidate())
+}
+
+func TestLookup(t *testing.T) {
+	assert := assert.New(t)
+	p := NewPool(1 << 20)
+	cc := &Control{CacheType: CacheNormal, Vary: []string{"Accept-Language"}}
+	r := &http.Response{Header: http.Header{}}
+	en := http.Header{"Accept-Language": []string{"en, fr"}}
+	zh := http.Header{"Accept-Language": []string{"zh"}}
+
+	p.Set(Store(p, "k", cc, r, en), cc, r, []byte("en"))
+	p.Set(Store(p, "k", cc, r, zh), cc, r, []byte("zh"))
+
+	_, b, _, vkey, ok := Lookup(p, "k", http.Header{"Accept-Language": []string{"en,fr"}})
+	assert.True(ok)
+	assert.Equal("en", string(b))
+	assert.Equal(VariantKey("k", cc.Vary, en), vkey)
+	_, b, _, _, ok = Lookup(p, "k", zh)
+	assert.True(ok)
+	assert.Equal("zh", string(b))
+	_, _, _, _, ok = Lookup(p, "k", http.Header{})
+	assert.False(ok)
+}
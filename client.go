@@ -8,9 +8,12 @@ import (
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/fanyang01/crawler/cache"
+	"github.com/fanyang01/crawler/cookie"
+	"github.com/fanyang01/crawler/dnscache"
 )
 
 // Client defines how requests are made.
@@ -19,12 +22,15 @@ type Client interface {
 }
 
 var (
+	// DefaultResolver caches DNS lookups of DefaultHTTPTransport and
+	// extract.Extractor.
+	DefaultResolver      = dnscache.New()
 	DefaultHTTPTransport = &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
-		Dial: (&net.Dialer{
+		DialContext: DefaultResolver.Dialer(&net.Dialer{
 			Timeout:   5 * time.Second,
 			KeepAlive: 30 * time.Second,
-		}).Dial,
+		}),
 		TLSHandshakeTimeout: 5 * time.Second,
 	}
 	// DefaultHTTPClient uses DefaultHTTPTransport to make HTTP request,
@@ -51,22 +57,77 @@ func init() {
 // StdClient is intended to be used for fetching static resources.
 type StdClient struct {
 	client *http.Client
-	cache  *cache.Pool
+	cache  cache.Storage
+
+	policy   *StatusPolicy
+	mu       sync.Mutex
+	sessions *cookie.Sessions
+	clients  map[string]*http.Client // by session
 }
 
 // NewStdClient returns a new standard client that uses the provided HTTP
-// client to do HTTP requests. cacheSize specifies the maxmium size(in
-// bytes) of the HTTP cache pool. If cacheSize <= 0, HTTP caching will be
-// disabled.
-func NewStdClient(client *http.Client, cacheSize int) *StdClient {
+// client to do HTTP requests and storage to cache responses, e.g., a
+// cache.Pool in memory or a boltcache.Cache on disk. If storage is nil,
+// HTTP caching will be disabled.
+func NewStdClient(client *http.Client, storage cache.Storage) *StdClient {
 	if client == nil {
 		client = DefaultHTTPClient
 	}
-	c := &StdClient{client: client}
-	if cacheSize > 0 {
-		c.cache = cache.NewPool(cacheSize)
+	return &StdClient{client: client, cache: storage}
+}
+
+// SetSessions enables named sessions. A request whose Session is set
+// uses the cookie jar of the session rather than that of the HTTP client.
+func (c *StdClient) SetSessions(s *cookie.Sessions) {
+	c.mu.Lock()
+	c.sessions = s
+	c.clients = make(map[string]*http.Client)
+	c.mu.Unlock()
+}
+
+// SetStatusPolicy sets the policy that classifies response statuses. If
+// it's not set, DefaultStatusPolicy is used.
+func (c *StdClient) SetStatusPolicy(p *StatusPolicy) {
+	c.policy = p
+}
+
+func (c *StdClient) statusPolicy() *StatusPolicy {
+	if c.policy != nil {
+		return c.policy
+	}
+	return DefaultStatusPolicy
+}
+
+// httpClient returns the HTTP client for the session of req.
+func (c *StdClient) httpClient(req *Request) (*http.Client, error) {
+	if req.Session == "" {
+		return c.client, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.sessions == nil {
+		return nil, fmt.Errorf("crawler: no sessions for session %q", req.Session)
+	}
+	if client, ok := c.clients[req.Session]; ok {
+		return client, nil
+	}
+	jar, err := c.sessions.Jar(req.Session)
+	if err != nil {
+		return nil, err
 	}
-	return c
+	client := *c.client
+	client.Jar = jar
+	c.clients[req.Session] = &client
+	return &client, nil
+}
+
+// cacheKey returns the key of u in cache. Responses of a session are
+// private to it.
+func cacheKey(req *Request, u *url.URL) string {
+	if req.Session != "" {
+		return "session:" + req.Session + " " + cache.Key(u)
+	}
+	return cache.Key(u)
 }
 
 // ResponseStatusError represents unexpected response status.
@@ -79,8 +140,15 @@ func (e ResponseStatusError) Error() string {
 	return fmt.Sprintf("unexpected response status: %d %s", int(e), http.StatusText(int(e)))
 }
 
-// Do implements the Client interface.
+// Do implements the Client interface. Requests of schemes other than
+// http and https are passed to the handlers registered by RegisterScheme.
 func (c *StdClient) Do(req *Request) (r *Response, err error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		if h, ok := schemeHandler(req.URL.Scheme); ok {
+			return h.Do(req)
+		}
+		return nil, fmt.Errorf("crawler: unsupported scheme: %s", req.URL.Scheme)
+	}
 	defer func() {
 		if err != nil && r != nil {
 			r.free()
@@ -88,119 +156,204 @@ func (c *StdClient) Do(req *Request) (r *Response, err error) {
 	}()
 
 	var (
-		hr       *http.Response
-		cc       *cache.Control
-		body     []byte
-		now      time.Time
-		ok       bool
-		modified bool = true
+		hr          *http.Response
+		cc          *cache.Control
+		body        []byte
+		now         time.Time
+		ok          bool
+		modified    bool = true
+		notModified bool
+		key         = cacheKey(req, req.URL)
+		validated   = req.Header.Get("If-None-Match") != "" ||
+			req.Header.Get("If-Modified-Since") != ""
+		// The caller has its own copy of the content. Validators added
+		// from the store don't bypass the cache, which may have a fresh
+		// copy; they are used if the request is made.
+		conditional = validated && !req.stored
+		// Only complete responses of GET are cached.
+		cacheable = c.cache != nil && req.Method == "GET" &&
+			req.Header.Get("Range") == ""
 	)
-	if req.Method == "GET" && c.cache != nil {
-		if hr, body, cc, ok = c.cache.Get(req.URL); ok {
-			if cc.NeedValidate() {
-				if hr, cc, modified, err = c.revalidate(
-					req.URL, hr, body, cc,
-				); err != nil {
-					return
-				}
-			} else {
+	client, err := c.httpClient(req)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable && !conditional {
+		if hr, body, cc, key, ok = cache.Lookup(
+			c.cache, key, req.Header,
+		); ok {
+			switch {
+			case !cc.NeedValidate():
+				modified = false
+				hr.Body = ioutil.NopCloser(bytes.NewReader(body))
+			case cc.ServeWhileRevalidate():
+				// hr and cc are served and modified below.
+				go c.refresh(req, key, cache.CopyResponse(hr), body, cc.Copy())
 				modified = false
 				hr.Body = ioutil.NopCloser(bytes.NewReader(body))
+			default:
+				rhr, rcc, rmodified, rerr := c.revalidate(req, key, hr, body, cc)
+				if rerr == nil {
+					// The cached copy is the one of the last visit,
+					// and the server confirmed it's unchanged.
+					notModified = validated && !rmodified && sameValidators(req.Header, cc)
+					if notModified {
+						rhr.Body = ioutil.NopCloser(bytes.NewReader(nil))
+					}
+					hr, cc, modified = rhr, rcc, rmodified
+				} else if _, retryable := rerr.(RetryableError); retryable &&
+					cc.ServeOnError() {
+					// Serve the stale response.
+					modified = false
+					hr.Body = ioutil.NopCloser(bytes.NewReader(body))
+				} else {
+					return nil, rerr
+				}
 			}
 			now = time.Now()
 			goto INIT
 		}
 	}
 
-	if hr, err = c.client.Do(req.Request); err != nil {
+	if hr, err = client.Do(req.Request); err != nil {
 		return nil, RetryableError{Err: err}
 	}
 	now = time.Now()
 
-	// Only status code 2xx is OK.
-	switch {
-	case 200 <= hr.StatusCode && hr.StatusCode < 300:
-	// 5xx and 4xx but 404 are retryable.
-	case hr.StatusCode >= 500:
-		fallthrough
-	case hr.StatusCode >= 400 && hr.StatusCode != 404:
-		hr.Body.Close()
-		err = RetryableError{
-			Err: ResponseStatusError(hr.StatusCode),
-		}
+	if hr.StatusCode == http.StatusNotModified && validated {
+		r = NewResponse()
+		r.init(req.URL, hr, now, nil)
+		r.NotModified = true
 		return
-	default:
+	}
+	if err = c.statusPolicy().Check(hr); err != nil {
 		hr.Body.Close()
-		err = ResponseStatusError(hr.StatusCode)
 		return
 	}
-	if c.cache != nil {
+	if cacheable {
 		cc = cache.Parse(hr, now)
 	}
 
 INIT:
 	r = NewResponse()
 	r.init(req.URL, hr, now, cc)
+	r.NotModified = notModified
 	if c.cache != nil && cc != nil && cc.IsCacheable() {
 		if !modified { // Just update cached header
-			if ok := c.cache.Update(req.URL, r.CacheControl, r.Header); ok {
+			// A response without body is not stored in place of the
+			// cached one.
+			if ok := c.cache.Update(key, r.CacheControl, r.Header); ok || notModified {
 				return
 			}
 		}
-		r.Body = c.cache.NewReader(r.NewURL, r.CacheControl, r.Response, r.Body)
+		stored := decoded(r.Response)
+		r.Body = cache.NewReader(c.cache, cache.Store(
+			c.cache, cacheKey(req, r.NewURL), r.CacheControl, stored, req.Header,
+		), r.CacheControl, stored, r.Body)
 	}
 	return
 }
 
+// sameValidators reports whether the validators in h, which are those of
+// the last visit, describe the cached response of cc.
+func sameValidators(h http.Header, cc *cache.Control) bool {
+	if etag := h.Get("If-None-Match"); etag != "" {
+		return etag == cc.ETag
+	}
+	t, err := http.ParseTime(h.Get("If-Modified-Since"))
+	return err == nil && !cc.LastModified.IsZero() && !cc.LastModified.After(t)
+}
+
+// refresh revalidates a stale response in background and stores the new
+// one. hr and cc must not be shared with the response being served.
+func (c *StdClient) refresh(
+	req *Request, key string, hr *http.Response, body []byte, cc *cache.Control,
+) {
+	hr, cc, modified, err := c.revalidate(req, key, hr, body, cc)
+	if err != nil || cc == nil || !cc.IsCacheable() {
+		return
+	}
+	if !modified {
+		c.cache.Update(key, cc, hr.Header)
+		return
+	}
+	r := NewResponse()
+	defer r.free()
+	r.init(req.URL, hr, time.Now(), cc)
+	rd := r.Body
+	if req.bandwidth != nil {
+		rd = req.bandwidth.Reader(rd, req.URL.Host, req.HostBandwidth)
+	}
+	b, err := ioutil.ReadAll(rd)
+	r.bodyCloser.Close()
+	if err == nil {
+		stored := decoded(hr)
+		c.cache.Set(cache.Store(
+			c.cache, cacheKey(req, r.NewURL), cc, stored, req.Header,
+		), cc, stored, b)
+	}
+}
+
+// decoded returns a copy of hr to be stored along with the decoded body.
+// The fields describing the encoded body are removed, so that the cached
+// body is not decoded again when it's served.
+func decoded(hr *http.Response) *http.Response {
+	r := cache.CopyResponse(hr)
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.TransferEncoding = nil
+	r.ContentLength = -1
+	return r
+}
+
+// revalidate makes a conditional request for the stale response r, which
+// is stored with key. The header of req is sent along, so that the same
+// variant is selected.
 func (c *StdClient) revalidate(
-	u *url.URL, r *http.Response, body []byte, cc *cache.Control,
+	req *Request, key string, r *http.Response, body []byte, cc *cache.Control,
 ) (
 	rr *http.Response, rcc *cache.Control, modified bool, err error,
 ) {
 	modified = true
 
-	req, _ := http.NewRequest("GET", u.String(), nil)
+	u := req.URL
+	hreq, _ := http.NewRequest("GET", u.String(), nil)
+	for k, vv := range req.Header {
+		hreq.Header[k] = vv
+	}
 	if cc.ETag != "" {
-		req.Header.Add("If-None-Match", cc.ETag)
+		hreq.Header.Set("If-None-Match", cc.ETag)
 	}
 	var t time.Time
 	if t = cc.LastModified; t.IsZero() {
 		t = cc.Date
 	}
-	req.Header.Add("If-Modified-Since", t.Format(http.TimeFormat))
+	hreq.Header.Set("If-Modified-Since", t.UTC().Format(http.TimeFormat))
 
-	if rr, err = c.client.Do(req); err != nil {
+	client, err := c.httpClient(req)
+	if err != nil {
+		return
+	}
+	if rr, err = client.Do(hreq); err != nil {
+		err = RetryableError{Err: err}
 		return
 	}
 
-	switch {
-	case rr.StatusCode == 304:
+	if rr.StatusCode == 304 {
 		rr.Body.Close()
 		rr = cache.Construct(r, rr, body)
 		if rr.Request.URL.String() == u.String() {
 			modified = false
 		}
-		fallthrough
-	case 200 <= rr.StatusCode && rr.StatusCode < 300:
-		rcc = cache.Parse(rr, time.Now())
-		if rcc == nil || !rcc.IsCacheable() {
-			c.cache.Remove(u)
-		}
-		return
-	// 5xx and 4xx but 404 are retryable.
-	case rr.StatusCode >= 500:
-		fallthrough
-	case rr.StatusCode >= 400 && rr.StatusCode != 404:
-		rr.Body.Close()
-		err = RetryableError{
-			Err: ResponseStatusError(rr.StatusCode),
-		}
-		return
-	default:
+	} else if err = c.statusPolicy().Check(rr); err != nil {
 		rr.Body.Close()
-		err = ResponseStatusError(rr.StatusCode)
 		return
 	}
+	rcc = cache.Parse(rr, time.Now())
+	if rcc == nil || !rcc.IsCacheable() {
+		c.cache.Remove(key)
+	}
+	return
 }
 
 func (r *Response) init(u *url.URL, hr *http.Response,
@@ -211,6 +364,7 @@ func (r *Response) init(u *url.URL, hr *http.Response,
 	r.Timestamp = t
 	r.Response = hr
 	r.CacheControl = cc
+	r.initTLS(hr.TLS)
 	r.InitBody(hr.Body)
 	return r
 }
@@ -1,14 +1,22 @@
 package crawler
 
 import (
+	"compress/gzip"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/fanyang01/crawler/cache"
+	"github.com/fanyang01/crawler/cookie"
+	"github.com/fanyang01/crawler/urlx"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -68,6 +76,8 @@ func TestClientCache(t *testing.T) {
 			return
 		}
 		w.Header().Set("Cache-Control", "max-age=1")
+		// Date has a precision of seconds, which affects the age.
+		w.Header()["Date"] = nil
 		w.Header().Set("ETag", magic)
 		fmt.Fprint(w, magic)
 	}))
@@ -120,3 +130,419 @@ func TestClientCache(t *testing.T) {
 	f("/revalidate", magic, true, true)
 	f("/revalidate", magic, true, true)
 }
+
+func TestClientStaleIfError(t *testing.T) {
+	assert := assert.New(t)
+	client := NewStdClient(&http.Client{}, cache.NewPool(1<<20))
+	down := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	}))
+	defer ts.Close()
+
+	get := func(lang string) (string, error) {
+		hreq, _ := http.NewRequest("GET", ts.URL, nil)
+		hreq.Header.Set("Accept-Language", lang)
+		r, err := client.Do(&Request{Request: hreq})
+		if err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		return string(b), err
+	}
+	for _, lang := range []string{"en", "zh"} {
+		b, err := get(lang)
+		assert.NoError(err)
+		assert.Equal(lang, b)
+	}
+	down = true
+	for _, lang := range []string{"en", "zh"} {
+		b, err := get(lang)
+		assert.NoError(err)
+		assert.Equal(lang, b)
+	}
+	_, err := get("fr")
+	assert.Error(err)
+}
+
+type revalidateController struct {
+	NopController
+	mu          sync.Mutex
+	notModified []bool
+}
+
+func (c *revalidateController) Handle(r *Response, _ chan<- *url.URL) {
+	c.mu.Lock()
+	c.notModified = append(c.notModified, r.NotModified)
+	c.mu.Unlock()
+}
+
+func (c *revalidateController) Resched(r *Response) (bool, Ticket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.notModified) > 1, Ticket{}
+}
+
+func TestClientCacheEncoding(t *testing.T) {
+	assert := assert.New(t)
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		fmt.Fprint(gw, "hello")
+		gw.Close()
+	}))
+	defer ts.Close()
+
+	client := &StdClient{
+		client: &http.Client{},
+		cache:  cache.NewPool(1 << 20),
+	}
+	for i := 0; i < 2; i++ {
+		hreq, err := http.NewRequest("GET", ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hreq.Header.Set("Accept-Encoding", AcceptEncoding)
+		r, err := client.Do(&Request{Request: hreq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(err)
+		assert.Equal("hello", string(b))
+	}
+	// The second response is served from the cache.
+	assert.Equal(int32(1), atomic.LoadInt32(&count))
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	assert := assert.New(t)
+	var count, revalidated int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("Cache-Control", "max-age=0, stale-while-revalidate=60")
+		w.Header().Set("X-Count", fmt.Sprint(atomic.LoadInt32(&count)))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&revalidated, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	client := &StdClient{
+		client: &http.Client{},
+		cache:  cache.NewPool(1 << 20),
+	}
+	get := func() *Response {
+		hreq, err := http.NewRequest("GET", ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := client.Do(&Request{Request: hreq})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	r := get()
+	b, _ := ioutil.ReadAll(r.Body)
+	assert.Equal("hello", string(b))
+
+	// The stale response is served while it's refreshed in background.
+	// Run with -race to check that they don't share the response.
+	for i := 0; i < 10; i++ {
+		r := get()
+		r.Header.Set("X-Local", "x")
+		r.CacheControl.MaxAge = time.Hour
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal("hello", string(b))
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(&revalidated) < 10 &&
+		time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(int32(10), atomic.LoadInt32(&revalidated))
+	assert.Equal(int32(11), atomic.LoadInt32(&count))
+}
+
+func TestConditional(t *testing.T) {
+	assert := assert.New(t)
+	lastmod := time.Date(2016, 1, 2, 3, 4, 5, 0, time.UTC)
+	var conditional []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		conditional = append(conditional, r.Header.Get("If-None-Match")+
+			"|"+r.Header.Get("If-Modified-Since"))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", lastmod.Format(http.TimeFormat))
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	store := NewMemStore()
+	ctrl := &revalidateController{}
+	cw := New(&Config{Controller: ctrl, Store: store})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+
+	assert.Equal([]bool{false, true}, ctrl.notModified)
+	assert.Equal([]string{
+		"|",
+		`"v1"|` + lastmod.Format(http.TimeFormat),
+	}, conditional)
+
+	u, err := store.Get(mustParseURL(ts.URL + "/"))
+	assert.NoError(err)
+	assert.Equal(`"v1"`, u.ETag)
+	assert.True(lastmod.Equal(u.LastModified))
+	assert.Equal(2, u.NumVisit)
+}
+
+func TestConditionalCache(t *testing.T) {
+	assert := assert.New(t)
+	var count int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "max-age=3600")
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	// The validators in the store don't bypass the fresh cached copy.
+	client := &StdClient{
+		client: &http.Client{},
+		cache:  cache.NewPool(1 << 20),
+	}
+	ctrl := &revalidateController{}
+	cw := New(&Config{Controller: ctrl, Client: client})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+	assert.Equal([]bool{false, false}, ctrl.notModified)
+	assert.Equal(int32(1), atomic.LoadInt32(&count))
+}
+
+func TestConditionalStaleCache(t *testing.T) {
+	assert := assert.New(t)
+	var conditional []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Cache-Control", "no-cache")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+
+	// The cached copy is revalidated with the validators of the last
+	// visit, so the 304 surfaces as unchanged.
+	client := &StdClient{
+		client: &http.Client{},
+		cache:  cache.NewPool(1 << 20),
+	}
+	ctrl := &revalidateController{}
+	cw := New(&Config{Controller: ctrl, Client: client})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+	assert.Equal([]bool{false, true}, ctrl.notModified)
+	assert.Equal([]string{"", `"v1"`}, conditional)
+}
+
+func TestSessions(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{
+				Name: "user", Value: r.URL.Query().Get("user"),
+			})
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60")
+		if c, err := r.Cookie("user"); err == nil {
+			fmt.Fprint(w, c.Value)
+		}
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "sessions")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+	client := NewStdClient(&http.Client{}, cache.NewPool(1<<20))
+	get := func(session, path string) (string, error) {
+		hreq, _ := http.NewRequest("GET", ts.URL+path, nil)
+		r, err := client.Do(&Request{Request: hreq, Session: session})
+		if err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadAll(r.Body)
+		return string(b), err
+	}
+
+	_, err = get("alice", "/")
+	assert.Error(err)
+	sessions := cookie.NewSessions(cookie.Dir(dir))
+	client.SetSessions(sessions)
+	for _, user := range []string{"alice", "bob"} {
+		b, err := get(user, "/login?user="+user)
+		assert.NoError(err)
+		assert.Equal(user, b)
+	}
+	for _, user := range []string{"alice", "bob"} {
+		b, err := get(user, "/")
+		assert.NoError(err)
+		assert.Equal(user, b)
+	}
+	b, _ := get("", "/")
+	assert.Equal("", b)
+
+	assert.NoError(sessions.Flush())
+
+	// Restart
+	client = NewStdClient(&http.Client{}, nil)
+	sessions = cookie.NewSessions(cookie.Dir(dir))
+	client.SetSessions(sessions)
+	b, _ = get("bob", "/")
+	assert.Equal("bob", b)
+	jar, _ := sessions.Jar("bob")
+	u, _ := url.Parse(ts.URL)
+	assert.NoError(jar.Clear(u.Host))
+	b, _ = get("bob", "/")
+	assert.Equal("", b)
+	jar.SetCookies(u, []*http.Cookie{{Name: "user", Value: "carol"}})
+	b, _ = get("bob", "/")
+	assert.Equal("carol", b)
+}
+
+type echoScheme struct{}
+
+func (echoScheme) Normalize(u *url.URL) error { return nil }
+func (echoScheme) Do(req *Request) (*Response, error) {
+	r := NewResponse()
+	hr := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(req.URL.Opaque)),
+		Request:    req.Request,
+	}
+	r.init(req.URL, hr, time.Now(), nil)
+	return r, nil
+}
+
+func TestRegisterScheme(t *testing.T) {
+	assert := assert.New(t)
+	_, err := urlx.Parse("echo:hello", urlx.Normalize)
+	assert.Error(err)
+
+	RegisterScheme("echo", echoScheme{})
+	u, err := urlx.Parse("echo:hello", urlx.Normalize)
+	assert.NoError(err)
+	r, err := DefaultClient.Do(&Request{Request: &http.Request{URL: u}})
+	if assert.NoError(err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal("hello", string(b))
+	}
+	_, err = DefaultClient.Do(&Request{Request: &http.Request{
+		URL: &url.URL{Scheme: "gopher", Host: "example.com"},
+	}})
+	assert.Error(err)
+}
+
+type statusController struct {
+	NopController
+	status chan int
+}
+
+func (c statusController) Handle(r *Response, _ chan<- *url.URL) {
+	c.status <- r.StatusCode
+}
+
+func TestStatusPolicy(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(404)
+		case "/many":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(429)
+		case "/date":
+			w.Header().Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+			w.WriteHeader(429)
+		case "/blocked":
+			w.WriteHeader(999)
+		case "/error":
+			w.WriteHeader(500)
+		}
+	}))
+	defer ts.Close()
+
+	get := func(c *StdClient, path string) (*Response, error) {
+		hreq, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Do(&Request{Request: hreq})
+	}
+
+	c := NewStdClient(nil, nil)
+	_, err := get(c, "/missing")
+	assert.Equal(ResponseStatusError(404), err)
+	_, err = get(c, "/many")
+	assert.Equal(RetryableError{Err: ResponseStatusError(429), After: 120 * time.Second}, err)
+	_, err = get(c, "/error")
+	assert.Equal(RetryableError{Err: ResponseStatusError(500)}, err)
+	_, err = get(c, "/blocked")
+	assert.Equal(RetryableError{Err: ResponseStatusError(999)}, err)
+
+	c.SetStatusPolicy(&StatusPolicy{
+		Classes: map[int]StatusClass{
+			404: StatusHandle,
+			500: StatusFail,
+			999: StatusThrottle,
+		},
+		ThrottleDelay: time.Minute,
+		MaxRetryAfter: 30 * time.Minute,
+	})
+	r, err := get(c, "/missing")
+	if assert.NoError(err) {
+		assert.Equal(404, r.StatusCode)
+	}
+	_, err = get(c, "/error")
+	assert.Equal(ResponseStatusError(500), err)
+	_, err = get(c, "/blocked")
+	assert.Equal(RetryableError{Err: ResponseStatusError(999), After: time.Minute}, err)
+	_, err = get(c, "/date")
+	assert.Equal(RetryableError{Err: ResponseStatusError(429), After: 30 * time.Minute}, err)
+
+	// Responses of StatusHandle reach Controller.Handle.
+	ctrl := statusController{status: make(chan int, 1)}
+	opt := *DefaultOption
+	opt.ObeyRobots = false
+	cw := New(&Config{Controller: ctrl, Client: c, Option: &opt})
+	assert.NoError(cw.Crawl(ts.URL + "/missing"))
+	cw.Wait()
+	assert.Equal(404, <-ctrl.status)
+}
@@ -11,6 +11,7 @@ import (
 
 type Config struct {
 	Controller   Controller
+	Client       Client
 	Store        Store
 	Queue        queue.WaitQueue
 	Logger       log15.Logger
@@ -38,6 +39,11 @@ func initConfig(cfg *Config) *Config {
 	if cfg.Controller == nil {
 		cfg.Controller = DefaultController
 	}
+	if cfg.Client == nil && cfg.Option.TLS != nil {
+		cfg.Client = NewStdClient(NewHTTPClient(cfg.Option.TLS), nil)
+	} else if cfg.Client == nil {
+		cfg.Client = DefaultClient
+	}
 	if cfg.Logger == nil {
 		cfg.Logger = log15.New()
 		cfg.Logger.SetHandler(log15.DiscardHandler())
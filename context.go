@@ -24,6 +24,7 @@ type Context struct {
 	url   *url.URL
 	depth int
 	err   error
+	skip  *Ticket
 	C     context.Context
 }
 
@@ -67,7 +68,7 @@ func (c *Context) Value(k interface{}) interface{} {
 }
 
 func (c *Context) Retry(err error) {
-	c.err = RetryableError{err}
+	c.err = RetryableError{Err: err}
 }
 func (c *Context) Error(err error) {
 	c.err = err
@@ -76,6 +77,12 @@ func (c *Context) Fatal(err error) {
 	c.err = FatalError{err}
 }
 
+// UpdateURL updates the metadata of the URL in store with f, so that it
+// persists across visits, and across restarts if the store is persistent.
+func (c *Context) UpdateURL(f func(*URL)) error {
+	return c.cw.store.UpdateFunc(c.url, f)
+}
+
 func (c *Context) NumVisit() (cnt int, err error) {
 	if err = c.fromStore(); err == nil {
 		cnt = c.Value(ckNumVisit).(int)
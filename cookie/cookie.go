@@ -0,0 +1,269 @@
+// Package cookie provides persistent cookie jars for named sessions.
+package cookie
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// entry is a cookie with the URL of the response that set it.
+type entry struct {
+	URL    string
+	Cookie *http.Cookie
+}
+
+// key identifies a cookie in a jar.
+func (e *entry) key(host string) string {
+	c := e.Cookie
+	if c.Domain != "" {
+		host = "." + strings.TrimPrefix(strings.ToLower(c.Domain), ".")
+	}
+	return host + ";" + c.Path + ";" + c.Name
+}
+
+// matches reports whether the cookie may be sent to host.
+func (e *entry) matches(host, origin string) bool {
+	if d := e.Cookie.Domain; d != "" {
+		d = strings.TrimPrefix(strings.ToLower(d), ".")
+		return host == d || strings.HasSuffix(host, "."+d)
+	}
+	return host == origin
+}
+
+// Jar is a http.CookieJar whose cookies are saved to a storage when they
+// are changed. The changes made by SetCookies are saved after a delay, so
+// that a burst of responses setting cookies is saved once; Flush saves
+// them immediately. All cookies are saved, including session cookies, so
+// that a logged-in session survives restarts.
+type Jar struct {
+	name    string
+	storage Storage
+	delay   time.Duration
+	onError func(session string, err error)
+
+	saving  sync.Mutex // serializes saves
+	mu      sync.Mutex
+	jar     *cookiejar.Jar
+	entries map[string]*entry
+	dirty   bool        // changes are not saved
+	timer   *time.Timer // pending save
+}
+
+func newJar(name string, s *Sessions) (*Jar, error) {
+	j := &Jar{
+		name:    name,
+		storage: s.storage,
+		delay:   s.SaveDelay,
+		onError: s.OnError,
+		entries: make(map[string]*entry),
+	}
+	var entries []*entry
+	if b, err := j.storage.Load(name); err != nil {
+		return nil, err
+	} else if b != nil {
+		if err = json.Unmarshal(b, &entries); err != nil {
+			return nil, err
+		}
+	}
+	for _, e := range entries {
+		if u, err := url.Parse(e.URL); err == nil && e.Cookie != nil {
+			j.entries[e.key(u.Host)] = e
+		}
+	}
+	j.rebuild()
+	return j, nil
+}
+
+// rebuild replays stored cookies into a new jar.
+func (j *Jar) rebuild() {
+	j.jar, _ = cookiejar.New(&cookiejar.Options{
+		PublicSuffixList: publicsuffix.List,
+	})
+	now := time.Now()
+	for k, e := range j.entries {
+		if !e.Cookie.Expires.IsZero() && !e.Cookie.Expires.After(now) {
+			delete(j.entries, k)
+			continue
+		}
+		u, _ := url.Parse(e.URL)
+		j.jar.SetCookies(u, []*http.Cookie{e.Cookie})
+	}
+}
+
+// save applies f, if not nil, to the entries and saves them. If f is nil,
+// the entries are saved only if they have been changed. Saves are
+// serialized, so that an older state never overwrites a newer one.
+func (j *Jar) save(f func()) error {
+	j.saving.Lock()
+	defer j.saving.Unlock()
+
+	j.mu.Lock()
+	if f != nil {
+		f()
+	} else if !j.dirty {
+		j.mu.Unlock()
+		return nil
+	}
+	if j.timer != nil {
+		j.timer.Stop()
+		j.timer = nil
+	}
+	j.dirty = false
+	entries := make([]*entry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	b, err := json.Marshal(entries)
+	j.mu.Unlock()
+
+	if err == nil {
+		err = j.storage.Save(j.name, b)
+	}
+	if err != nil {
+		// Retry on the next save.
+		j.mu.Lock()
+		j.dirty = true
+		j.mu.Unlock()
+	}
+	return err
+}
+
+// Flush saves the changes made by SetCookies that are pending.
+func (j *Jar) Flush() error { return j.save(nil) }
+
+// flush is called by the timer of a pending save.
+func (j *Jar) flush() {
+	if err := j.Flush(); err != nil && j.onError != nil {
+		j.onError(j.name, err)
+	}
+}
+
+// Name returns the name of the session.
+func (j *Jar) Name() string { return j.name }
+
+// Cookies implements http.CookieJar.
+func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.jar.Cookies(u)
+}
+
+// SetCookies implements http.CookieJar. It can also be used to seed
+// cookies.
+func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.jar.SetCookies(u, cookies)
+
+	now := time.Now()
+	for _, c := range cookies {
+		cc := *c
+		// Convert relative expiration to absolute.
+		if cc.MaxAge > 0 {
+			cc.Expires = now.Add(time.Duration(cc.MaxAge) * time.Second)
+			cc.MaxAge = 0
+		}
+		e := &entry{URL: u.String(), Cookie: &cc}
+		k := e.key(u.Host)
+		if cc.MaxAge < 0 || (!cc.Expires.IsZero() && !cc.Expires.After(now)) {
+			delete(j.entries, k)
+		} else {
+			j.entries[k] = e
+		}
+	}
+	// http.CookieJar has no way to report the error, so the cookies
+	// are saved in background, and the error is reported to onError.
+	j.dirty = true
+	if j.timer == nil {
+		j.timer = time.AfterFunc(j.delay, j.flush)
+	}
+}
+
+// Clear removes cookies that would be sent to host. Cookies of parent
+// domains, e.g., those of ".example.com" for "www.example.com", are also
+// removed.
+func (j *Jar) Clear(host string) error {
+	host = strings.ToLower(host)
+	return j.save(func() {
+		for k, e := range j.entries {
+			if u, err := url.Parse(e.URL); err != nil || e.matches(host, u.Host) {
+				delete(j.entries, k)
+			}
+		}
+		j.rebuild()
+	})
+}
+
+// ClearAll removes all cookies.
+func (j *Jar) ClearAll() error {
+	return j.save(func() {
+		j.entries = make(map[string]*entry)
+		j.rebuild()
+	})
+}
+
+// DefaultSaveDelay is the default delay of saving the changes of a jar.
+const DefaultSaveDelay = time.Second
+
+// Sessions manages the jars of named sessions, which are loaded from the
+// storage on first use.
+type Sessions struct {
+	// SaveDelay is the delay of saving the changes made by SetCookies.
+	// It should be set before jars are used.
+	SaveDelay time.Duration
+	// OnError, if not nil, is called with the errors of saves in
+	// background. It should be set before jars are used.
+	OnError func(session string, err error)
+
+	storage Storage
+	mu      sync.Mutex
+	jars    map[string]*Jar
+}
+
+// NewSessions creates sessions that are persisted in storage.
+func NewSessions(storage Storage) *Sessions {
+	return &Sessions{
+		SaveDelay: DefaultSaveDelay,
+		storage:   storage,
+		jars:      make(map[string]*Jar),
+	}
+}
+
+// Jar returns the jar of the named session. The name must not be empty.
+func (s *Sessions) Jar(name string) (*Jar, error) {
+	if name == "" {
+		return nil, errors.New("cookie: empty session name")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if j, ok := s.jars[name]; ok {
+		return j, nil
+	}
+	j, err := newJar(name, s)
+	if err != nil {
+		return nil, err
+	}
+	s.jars[name] = j
+	return j, nil
+}
+
+// Flush saves the pending changes of all jars. It should be called before
+// the program exits. It returns the first error encountered.
+func (s *Sessions) Flush() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jars {
+		if e := j.Flush(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
@@ -0,0 +1,164 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/stretchr/testify/assert"
+)
+
+func names(cookies []*http.Cookie) (s []string) {
+	for _, c := range cookies {
+		s = append(s, c.Name+"="+c.Value)
+	}
+	sort.Strings(s)
+	return
+}
+
+func testStorage(t *testing.T, storage Storage) {
+	assert := assert.New(t)
+	a, _ := url.Parse("http://a.example.com/")
+	b, _ := url.Parse("http://b.example.com/")
+
+	s := NewSessions(storage)
+	_, err := s.Jar("")
+	assert.Error(err)
+	alice, err := s.Jar("alice")
+	assert.NoError(err)
+	alice.SetCookies(a, []*http.Cookie{
+		{Name: "sid", Value: "1"},
+		{Name: "pref", Value: "x", MaxAge: 3600},
+		{Name: "gone", Value: "y", MaxAge: -1},
+	})
+	alice.SetCookies(b, []*http.Cookie{
+		{Name: "all", Value: "2", Domain: "example.com"},
+	})
+	bob, _ := s.Jar("bob")
+	bob.SetCookies(a, []*http.Cookie{{Name: "sid", Value: "3"}})
+
+	assert.NoError(s.Flush())
+
+	// Reopen
+	s = NewSessions(storage)
+	alice, _ = s.Jar("alice")
+	bob, _ = s.Jar("bob")
+	assert.Equal([]string{"all=2", "pref=x", "sid=1"}, names(alice.Cookies(a)))
+	assert.Equal([]string{"all=2"}, names(alice.Cookies(b)))
+	assert.Equal([]string{"sid=3"}, names(bob.Cookies(a)))
+
+	// Deleted by server
+	alice.SetCookies(a, []*http.Cookie{{Name: "pref", MaxAge: -1}})
+	assert.Equal([]string{"all=2", "sid=1"}, names(alice.Cookies(a)))
+
+	assert.NoError(alice.Clear("b.example.com"))
+	assert.Equal([]string{"sid=1"}, names(alice.Cookies(a)))
+	assert.Empty(alice.Cookies(b))
+	alice, _ = NewSessions(storage).Jar("alice")
+	assert.Equal([]string{"sid=1"}, names(alice.Cookies(a)))
+
+	assert.NoError(alice.ClearAll())
+	assert.Empty(alice.Cookies(a))
+	assert.Equal([]string{"sid=3"}, names(bob.Cookies(a)))
+}
+
+func TestDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	testStorage(t, Dir(filepath.Join(dir, "sessions")))
+}
+
+func TestBolt(t *testing.T) {
+	f, err := ioutil.TempFile("", "cookie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	db, err := bolt.Open(f.Name(), 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	storage, err := NewBolt(db, "COOKIE_BUCKET")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, storage)
+}
+
+// countStorage counts saves, and fails them if err is set.
+type countStorage struct {
+	mu    sync.Mutex
+	saves int
+	err   error
+}
+
+func (s *countStorage) Load(string) ([]byte, error) { return nil, nil }
+
+func (s *countStorage) Save(string, []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saves++
+	return s.err
+}
+
+func (s *countStorage) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.saves
+}
+
+func TestSaveDelay(t *testing.T) {
+	assert := assert.New(t)
+	u, _ := url.Parse("http://a.example.com/")
+	storage := &countStorage{}
+	s := NewSessions(storage)
+	s.SaveDelay = 20 * time.Millisecond
+	errc := make(chan error, 1)
+	s.OnError = func(session string, err error) {
+		assert.Equal("alice", session)
+		errc <- err
+	}
+	j, _ := s.Jar("alice")
+
+	// A burst of changes is saved once.
+	for i := 0; i < 10; i++ {
+		j.SetCookies(u, []*http.Cookie{{Name: "sid", Value: fmt.Sprint(i)}})
+	}
+	assert.Equal(0, storage.count())
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(1, storage.count())
+	assert.NoError(s.Flush())
+	assert.Equal(1, storage.count())
+
+	// Errors of saves in background are reported.
+	storage.mu.Lock()
+	storage.err = errors.New("disk full")
+	storage.mu.Unlock()
+	j.SetCookies(u, []*http.Cookie{{Name: "sid", Value: "x"}})
+	select {
+	case err := <-errc:
+		assert.EqualError(err, "disk full")
+	case <-time.After(time.Second):
+		t.Error("error is not reported")
+	}
+	// The changes are saved on the next flush.
+	storage.mu.Lock()
+	storage.err = nil
+	storage.mu.Unlock()
+	assert.NoError(j.Flush())
+	assert.Equal(3, storage.count())
+}
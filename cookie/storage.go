@@ -0,0 +1,95 @@
+package cookie
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/boltdb/bolt"
+)
+
+// Storage persists the cookies of sessions.
+type Storage interface {
+	// Load returns the data saved for session, or nil if nothing is
+	// saved.
+	Load(session string) ([]byte, error)
+	Save(session string, data []byte) error
+}
+
+// Dir is a storage that saves each session in a file in the directory.
+type Dir string
+
+func (d Dir) path(session string) string {
+	return filepath.Join(string(d), url.PathEscape(session)+".json")
+}
+
+// Load implements Storage.
+func (d Dir) Load(session string) ([]byte, error) {
+	b, err := ioutil.ReadFile(d.path(session))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+// Save implements Storage. The file is replaced atomically.
+func (d Dir) Save(session string, data []byte) error {
+	if err := os.MkdirAll(string(d), 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(string(d), ".cookie")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), d.path(session))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Bolt is a storage that saves sessions in a bucket of a bolt DB, which
+// may be shared with other components, e.g., boltstore.
+type Bolt struct {
+	DB     *bolt.DB
+	Bucket []byte
+}
+
+// NewBolt creates the bucket in db if it doesn't exist.
+func NewBolt(db *bolt.DB, bucket string) (*Bolt, error) {
+	b := &Bolt{DB: db, Bucket: []byte(bucket)}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(b.Bucket)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Load implements Storage.
+func (b *Bolt) Load(session string) (data []byte, err error) {
+	err = b.DB.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(b.Bucket).Get([]byte(session)); v != nil {
+			data = append([]byte(nil), v...)
+		}
+		return nil
+	})
+	return
+}
+
+// Save implements Storage.
+func (b *Bolt) Save(session string, data []byte) error {
+	return b.DB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(b.Bucket).Put([]byte(session), data)
+	})
+}
@@ -5,15 +5,18 @@ import (
 	"errors"
 	"net/url"
 	"sync"
+	"time"
 
 	"gopkg.in/inconshreveable/log15.v2"
 
+	"github.com/fanyang01/crawler/ratelimit"
 	"github.com/fanyang01/crawler/urlx"
 )
 
 // Crawler crawls web pages.
 type Crawler struct {
 	ctrl   Controller
+	client Client
 	store  Store
 	opt    *Option
 	logger log15.Logger
@@ -24,6 +27,9 @@ type Crawler struct {
 	scheduler *scheduler
 
 	normalize func(*url.URL) error
+	robots    *robotsCache
+	sitemaps  *sitemapFinder
+	bandwidth *ratelimit.Bandwidth
 
 	quit chan struct{}
 	wg   sync.WaitGroup
@@ -36,11 +42,16 @@ func New(cfg *Config) *Crawler {
 		opt:       cfg.Option,
 		store:     storeWrapper{cfg.Store},
 		ctrl:      cfg.Controller,
+		client:    cfg.Client,
 		logger:    cfg.Logger,
 		normalize: cfg.NormalizeURL,
+		bandwidth: ratelimit.NewBandwidth(cfg.Option.Bandwidth),
 		quit:      make(chan struct{}),
 	}
 
+	cw.robots = cw.newRobotsCache()
+	cw.sitemaps = cw.newSitemapFinder()
+
 	// connect each part
 	cw.maker = cw.newRequestMaker()
 	cw.fetcher = cw.newFetcher()
@@ -62,6 +73,20 @@ func New(cfg *Config) *Crawler {
 	return cw
 }
 
+// Interval returns the interval between two requests to host that the
+// crawler respects. It is the larger one of the interval given by
+// controller and the crawl delay declared in robots.txt.
+func (cw *Crawler) Interval(host string) time.Duration {
+	d := cw.ctrl.Interval(host)
+	if !cw.opt.ObeyRobots {
+		return d
+	}
+	if declared := cw.robots.Delay(host); declared > d {
+		return declared
+	}
+	return d
+}
+
 // Crawl starts the crawler using several seeds.
 func (cw *Crawler) Crawl(seeds ...string) (err error) {
 	cw.wg.Add(4)
@@ -132,6 +157,9 @@ func (cw *Crawler) addSeeds(seeds ...string) (n int, err error) {
 		}); err != nil {
 			return
 		} else if ok {
+			if cw.opt.SitemapDiscovery {
+				cw.sitemaps.Discover(u, 0)
+			}
 			cw.scheduler.NewIn <- u
 			n++
 		}
@@ -160,7 +188,12 @@ func (cw *Crawler) Enqueue(urls ...string) error {
 // Stop stops the crawler.
 func (cw *Crawler) Stop() {
 	close(cw.quit)
+	cw.bandwidth.Close()
 	cw.wg.Wait()
 }
 
 func (cw *Crawler) Logger() log15.Logger { return cw.logger }
+
+// Bandwidth returns the limiter of Option.Bandwidth, which can be shared
+// by readers outside of the crawler, e.g., download.Downloader.
+func (cw *Crawler) Bandwidth() *ratelimit.Bandwidth { return cw.bandwidth }
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"golang.org/x/net/context"
+
+	"github.com/fanyang01/crawler/sitemap"
 )
 
 type Ticket struct {
@@ -22,7 +24,8 @@ type Controller interface {
 	// also extract hyperlinks from the response and send them to the
 	// channel. Note that r.NewURL may differ from r.URL if r.URL has been
 	// redirected, so r.NewURL should also be included if following
-	// redirects is expected.
+	// redirects is expected. If r.NotModified is true, the body is empty
+	// because the content has not changed since the last visit.
 	Handle(r *Response, ch chan<- *url.URL)
 
 	// Accept determines whether a URL should be processed. It is redundant
@@ -56,6 +59,140 @@ type Etc interface {
 	Charset(u *url.URL) (label string)
 }
 
+// SitemapReceiver is an optional interface for controllers. If
+// Option.SitemapDiscovery is enabled, each entry of the discovered
+// sitemaps is passed to Add before the URL is scheduled.
+type SitemapReceiver interface {
+	Add(entry *sitemap.URL)
+}
+
+// LinkHandler is an optional interface for controllers. If implemented,
+// HandleLink is called instead of Handle, so that links can be sent with
+// their context in the page.
+type LinkHandler interface {
+	HandleLink(r *Response, ch chan<- *Link)
+}
+
+// LinkAccepter is an optional interface for controllers. If implemented,
+// AcceptLink is called instead of Accept.
+type LinkAccepter interface {
+	AcceptLink(r *Response, link *Link) bool
+}
+
+// LinkScheduler is an optional interface for controllers. If implemented,
+// SchedLink is called instead of Sched. Links of seeds and recovered URLs
+// carry only the URL.
+type LinkScheduler interface {
+	SchedLink(r *Response, link *Link) Ticket
+}
+
+// ResponseAccepter is an optional interface for controllers. If
+// Option.Probe is enabled, a URL whose type can't be told from its path is
+// probed with a HEAD request, or a GET request of the first byte if HEAD
+// is not allowed, and AcceptResponse decides by the header whether the
+// body should be fetched. The body of r is empty. A rejected URL is passed
+// to Resched with r, and visited again unless it's done. See ProbeFilter.
+type ResponseAccepter interface {
+	AcceptResponse(r *Response) bool
+}
+
+// The functions below call the optional method of ctrl, or fall back to
+// the behavior of the crawler if ctrl doesn't implement it. Controllers
+// that wrap another controller should implement all the optional
+// interfaces using them, so that the wrapped controller is not hidden.
+// See Forward.
+
+// HandleLink calls ctrl.HandleLink if ctrl is a LinkHandler. Otherwise,
+// ctrl.Handle is called and the URLs are sent as links.
+func HandleLink(ctrl Controller, r *Response, ch chan<- *Link) {
+	if lh, ok := ctrl.(LinkHandler); ok {
+		lh.HandleLink(r, ch)
+		return
+	}
+	var (
+		urls = make(chan *url.URL, perPage)
+		done = make(chan struct{})
+	)
+	go func() {
+		for u := range urls {
+			ch <- &Link{URL: u}
+		}
+		close(done)
+	}()
+	ctrl.Handle(r, urls)
+	close(urls)
+	<-done
+}
+
+// AcceptLink calls ctrl.AcceptLink if ctrl is a LinkAccepter, or
+// ctrl.Accept otherwise.
+func AcceptLink(ctrl Controller, r *Response, link *Link) bool {
+	if la, ok := ctrl.(LinkAccepter); ok {
+		return la.AcceptLink(r, link)
+	}
+	return ctrl.Accept(r, link.URL)
+}
+
+// SchedLink calls ctrl.SchedLink if ctrl is a LinkScheduler, or
+// ctrl.Sched otherwise.
+func SchedLink(ctrl Controller, r *Response, link *Link) Ticket {
+	if ls, ok := ctrl.(LinkScheduler); ok {
+		return ls.SchedLink(r, link)
+	}
+	return ctrl.Sched(r, link.URL)
+}
+
+// AddSitemapEntry calls ctrl.Add if ctrl is a SitemapReceiver.
+func AddSitemapEntry(ctrl Controller, entry *sitemap.URL) {
+	if sr, ok := ctrl.(SitemapReceiver); ok {
+		sr.Add(entry)
+	}
+}
+
+// AcceptResponse calls ctrl.AcceptResponse if ctrl is a ResponseAccepter.
+// Otherwise, all responses are accepted.
+func AcceptResponse(ctrl Controller, r *Response) bool {
+	if ra, ok := ctrl.(ResponseAccepter); ok {
+		return ra.AcceptResponse(r)
+	}
+	return true
+}
+
+// Forward is embedded by controllers that wrap another controller. It
+// implements all the optional interfaces by forwarding to the wrapped
+// Controller, so the embedding controller only overrides the methods it
+// changes. The methods of the optional interfaces are called instead of
+// Handle, Accept and Sched, so overriding one of the latter requires
+// overriding HandleLink, AcceptLink or SchedLink too.
+type Forward struct {
+	Controller
+}
+
+// HandleLink implements LinkHandler.
+func (f Forward) HandleLink(r *Response, ch chan<- *Link) {
+	HandleLink(f.Controller, r, ch)
+}
+
+// AcceptLink implements LinkAccepter.
+func (f Forward) AcceptLink(r *Response, link *Link) bool {
+	return AcceptLink(f.Controller, r, link)
+}
+
+// SchedLink implements LinkScheduler.
+func (f Forward) SchedLink(r *Response, link *Link) Ticket {
+	return SchedLink(f.Controller, r, link)
+}
+
+// Add implements SitemapReceiver.
+func (f Forward) Add(entry *sitemap.URL) {
+	AddSitemapEntry(f.Controller, entry)
+}
+
+// AcceptResponse implements ResponseAccepter.
+func (f Forward) AcceptResponse(r *Response) bool {
+	return AcceptResponse(f.Controller, r)
+}
+
 // NopController is an empty controller - it walks through each seed once
 // and does nothing.
 type NopController struct{}
@@ -0,0 +1,105 @@
+package crawler
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// AcceptEncoding lists the content codings that can be decoded. It's sent
+// as the Accept-Encoding header of requests made by crawler.
+const AcceptEncoding = "gzip, deflate, br, zstd"
+
+// contentCodings returns the codings applied to the body of r in order.
+// Content-Encoding is preferred to Transfer-Encoding.
+func contentCodings(r *http.Response) (codings []string) {
+	var values []string
+	for _, v := range r.Header["Content-Encoding"] {
+		values = append(values, strings.Split(v, ",")...)
+	}
+	if len(values) == 0 {
+		values = r.TransferEncoding
+	}
+	for _, c := range values {
+		switch c = strings.ToLower(strings.TrimSpace(c)); c {
+		case "", "identity", "chunked":
+		default:
+			codings = append(codings, c)
+		}
+	}
+	return
+}
+
+// decoder is a chain of decoders.
+type decoder struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decoders, but not the underlying body.
+func (d *decoder) Close() error {
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		d.closers[i].Close()
+	}
+	return nil
+}
+
+// decode returns a reader that decodes body, to which codings have been
+// applied in order. It returns nil if no coding is applied.
+func decode(body io.Reader, codings []string) (io.ReadCloser, error) {
+	if len(codings) == 0 {
+		return nil, nil
+	}
+	d := &decoder{Reader: body}
+	for i := len(codings) - 1; i >= 0; i-- {
+		switch codings[i] {
+		case "gzip", "x-gzip":
+			r, err := gzip.NewReader(d.Reader)
+			if err != nil {
+				d.Close()
+				return nil, err
+			}
+			d.Reader = r
+			d.closers = append(d.closers, r)
+		case "deflate":
+			// Some servers send raw deflate data rather than the zlib
+			// format required by RFC 9110.
+			br := bufio.NewReader(d.Reader)
+			var rc io.ReadCloser
+			if b, err := br.Peek(2); err == nil && b[0]&0x0f == 8 &&
+				(uint16(b[0])<<8|uint16(b[1]))%31 == 0 {
+				if rc, err = zlib.NewReader(br); err != nil {
+					d.Close()
+					return nil, err
+				}
+			} else {
+				rc = flate.NewReader(br)
+			}
+			d.Reader = rc
+			d.closers = append(d.closers, rc)
+		case "br":
+			d.Reader = brotli.NewReader(d.Reader)
+		case "zstd":
+			zr, err := zstd.NewReader(d.Reader, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				d.Close()
+				return nil, err
+			}
+			rc := zr.IOReadCloser()
+			d.Reader = rc
+			d.closers = append(d.closers, rc)
+		default:
+			d.Close()
+			return nil, fmt.Errorf("unsupported content encoding: %s", codings[i])
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,83 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, b []byte, coding string) []byte {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+		err error
+	)
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, err = flate.NewWriter(&buf, flate.DefaultCompression)
+	case "br":
+		w = brotli.NewWriter(&buf)
+	case "zstd":
+		w, err = zstd.NewWriter(&buf)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	assert := assert.New(t)
+	content := []byte(strings.Repeat("hello, world\n", 100))
+	for _, v := range []struct {
+		header string
+		apply  []string
+	}{
+		{"", nil},
+		{"identity", nil},
+		{"gzip", []string{"gzip"}},
+		{"deflate", []string{"deflate"}},
+		{"deflate", []string{"raw-deflate"}},
+		{"br", []string{"br"}},
+		{"zstd", []string{"zstd"}},
+		{"gzip, br", []string{"gzip", "br"}},
+		{"ZSTD,gzip", []string{"zstd", "gzip"}},
+	} {
+		body := content
+		for _, c := range v.apply {
+			body = encode(t, body, c)
+		}
+		r := &Response{Response: &http.Response{Header: http.Header{}}}
+		if v.header != "" {
+			r.Header.Set("Content-Encoding", v.header)
+		}
+		r.InitBody(ioutil.NopCloser(bytes.NewReader(body)))
+		b, err := ioutil.ReadAll(r.Body)
+		assert.NoError(err, v.header)
+		assert.Equal(content, b, v.header)
+		r.bodyCloser.Close()
+	}
+
+	r := &Response{Response: &http.Response{Header: http.Header{
+		"Content-Encoding": []string{"compress"},
+	}}}
+	r.InitBody(ioutil.NopCloser(bytes.NewReader(content)))
+	_, err := ioutil.ReadAll(r.Body)
+	assert.Error(err)
+}
@@ -0,0 +1,315 @@
+// Package dnscache provides a caching DNS resolver shared by the transport
+// and the URL filters of crawler.
+package dnscache
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// entry is a cached result of lookup.
+type entry struct {
+	ips     []net.IP
+	err     error
+	expires time.Time
+	refresh time.Time // when to refresh it in background
+}
+
+// call is an in-flight lookup.
+type call struct {
+	done chan struct{}
+	ips  []net.IP
+	err  error
+}
+
+// Resolver caches the addresses of hosts. Successful lookups are cached
+// for TTL and failed ones for NegativeTTL. A cached entry that is used
+// near its expiration is refreshed in background, so that busy hosts are
+// never looked up synchronously again. Concurrent lookups of a host are
+// merged into one.
+type Resolver struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	// Timeout limits each lookup.
+	Timeout time.Duration
+	// MaxEntries bounds the number of cached hosts. Expired entries are
+	// evicted first.
+	MaxEntries int
+	// Lookup looks up the addresses of host. It defaults to the system
+	// resolver.
+	Lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+
+	mu     sync.RWMutex
+	cache  map[string]*entry
+	calls  map[string]*call
+	static map[string][]net.IP
+}
+
+// New creates a resolver with default settings.
+func New() *Resolver {
+	return &Resolver{
+		TTL:         5 * time.Minute,
+		NegativeTTL: 30 * time.Second,
+		Timeout:     10 * time.Second,
+		MaxEntries:  1 << 16,
+		Lookup:      net.DefaultResolver.LookupIPAddr,
+		cache:       make(map[string]*entry),
+		calls:       make(map[string]*call),
+		static:      make(map[string][]net.IP),
+	}
+}
+
+// Override resolves host to ips without looking up, like the --resolve
+// option of curl. host may be "host" or "host:port", the latter only
+// applies to dialing the port. Calling Override without ips removes the
+// override.
+func (r *Resolver) Override(host string, ips ...net.IP) {
+	host = strings.ToLower(host)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(ips) == 0 {
+		delete(r.static, host)
+		return
+	}
+	r.static[host] = append([]net.IP(nil), ips...)
+}
+
+// LookupIP returns the addresses of host.
+func (r *Resolver) LookupIP(host string) ([]net.IP, error) {
+	return r.LookupIPContext(context.Background(), host)
+}
+
+// LookupIPContext returns the addresses of host. If ctx is done before the
+// lookup finishes, the lookup continues in background to fill the cache.
+func (r *Resolver) LookupIPContext(ctx context.Context, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	host = strings.ToLower(host)
+	now := time.Now()
+	r.mu.Lock()
+	if ips, ok := r.static[host]; ok {
+		r.mu.Unlock()
+		return ips, nil
+	}
+	if e, ok := r.cache[host]; ok && now.Before(e.expires) {
+		if e.err == nil && !now.Before(e.refresh) {
+			r.start(host)
+		}
+		r.mu.Unlock()
+		return e.ips, e.err
+	}
+	c := r.start(host)
+	r.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.ips, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Prefetch looks up hosts in background if they are not cached. It's
+// called for every scheduled link, so hosts that are cached and fresh are
+// skipped under the read lock.
+func (r *Resolver) Prefetch(hosts ...string) {
+	now := time.Now()
+	var stale []string
+	r.mu.RLock()
+	for _, host := range hosts {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		if host = strings.ToLower(host); !r.fresh(host, now) {
+			stale = append(stale, host)
+		}
+	}
+	r.mu.RUnlock()
+	if len(stale) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, host := range stale {
+		// It may have been looked up since the check.
+		if !r.fresh(host, now) {
+			r.start(host)
+		}
+	}
+}
+
+// fresh reports whether host is overridden, or cached and not due to be
+// refreshed. r.mu is held.
+func (r *Resolver) fresh(host string, now time.Time) bool {
+	if _, ok := r.static[host]; ok {
+		return true
+	}
+	e, ok := r.cache[host]
+	return ok && now.Before(e.refresh)
+}
+
+// Forget removes host from the cache.
+func (r *Resolver) Forget(host string) {
+	r.mu.Lock()
+	delete(r.cache, strings.ToLower(host))
+	r.mu.Unlock()
+}
+
+// start starts a lookup of host unless one is in flight. r.mu is held.
+func (r *Resolver) start(host string) *call {
+	if c, ok := r.calls[host]; ok {
+		return c
+	}
+	c := &call{done: make(chan struct{})}
+	r.calls[host] = c
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+		addrs, err := r.Lookup(ctx, host)
+		cancel()
+		for _, a := range addrs {
+			c.ips = append(c.ips, a.IP)
+		}
+		if err == nil && len(c.ips) == 0 {
+			err = &net.DNSError{Err: "no such host", Name: host}
+		}
+		c.err = err
+
+		now := time.Now()
+		r.mu.Lock()
+		delete(r.calls, host)
+		if e, ok := r.cache[host]; ok && err != nil &&
+			e.err == nil && now.Before(e.expires) {
+			// A failed refresh doesn't replace a valid entry.
+			c.ips, c.err = e.ips, nil
+		} else {
+			ttl := r.TTL
+			if err != nil {
+				ttl = r.NegativeTTL
+			}
+			r.evict(now)
+			r.cache[host] = &entry{
+				ips:     c.ips,
+				err:     err,
+				expires: now.Add(ttl),
+				refresh: now.Add(ttl * 3 / 4),
+			}
+		}
+		r.mu.Unlock()
+		close(c.done)
+	}()
+	return c
+}
+
+// evict makes room for a new entry. r.mu is held.
+func (r *Resolver) evict(now time.Time) {
+	if r.MaxEntries <= 0 || len(r.cache) < r.MaxEntries {
+		return
+	}
+	for host, e := range r.cache {
+		if !now.Before(e.expires) {
+			delete(r.cache, host)
+		}
+	}
+	for host := range r.cache {
+		if len(r.cache) < r.MaxEntries {
+			break
+		}
+		delete(r.cache, host)
+	}
+}
+
+// minDialTimeout is the minimum time given to dial an address when the
+// time left is shared among several addresses, as in package net.
+const minDialTimeout = 2 * time.Second
+
+// Dialer returns a function that dials like d, but resolves the host of
+// addr with r. The addresses are tried in order until one succeeds. The
+// timeout and deadline of d, and the deadline of the context, limit the
+// whole dial, and the time left is shared among the remaining addresses,
+// so that an unreachable address doesn't use up the time of the others.
+// It can be used as http.Transport.DialContext.
+func (r *Resolver) Dialer(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		deadline := dialDeadline(ctx, d, time.Now())
+		if !deadline.IsZero() {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			defer cancel()
+		}
+		r.mu.RLock()
+		ips, ok := r.static[strings.ToLower(addr)]
+		r.mu.RUnlock()
+		if !ok {
+			if ips, err = r.LookupIPContext(ctx, host); err != nil {
+				return nil, err
+			}
+		}
+		// The deadline is applied by the context of each address.
+		dd := *d
+		dd.Timeout, dd.Deadline = 0, time.Time{}
+		err = errors.New("dnscache: no address")
+		for i, ip := range ips {
+			actx := ctx
+			if !deadline.IsZero() {
+				var cancel context.CancelFunc
+				actx, cancel = context.WithDeadline(ctx, partialDeadline(
+					time.Now(), deadline, len(ips)-i,
+				))
+				defer cancel()
+			}
+			var conn net.Conn
+			if conn, err = dd.DialContext(
+				actx, network, net.JoinHostPort(ip.String(), port),
+			); err == nil {
+				return conn, nil
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, err
+	}
+}
+
+// dialDeadline returns the earliest of the deadlines given by d and ctx,
+// or zero if there is none.
+func dialDeadline(ctx context.Context, d *net.Dialer, now time.Time) (deadline time.Time) {
+	earliest := func(t time.Time) {
+		if deadline.IsZero() || (!t.IsZero() && t.Before(deadline)) {
+			deadline = t
+		}
+	}
+	if d.Timeout > 0 {
+		earliest(now.Add(d.Timeout))
+	}
+	earliest(d.Deadline)
+	if t, ok := ctx.Deadline(); ok {
+		earliest(t)
+	}
+	return
+}
+
+// partialDeadline returns the deadline of dialing one of remaining
+// addresses, which share the time left before deadline.
+func partialDeadline(now, deadline time.Time, remaining int) time.Time {
+	left := deadline.Sub(now)
+	timeout := left / time.Duration(remaining)
+	if timeout < minDialTimeout {
+		if left < minDialTimeout {
+			timeout = left
+		} else {
+			timeout = minDialTimeout
+		}
+	}
+	return now.Add(timeout)
+}
@@ -0,0 +1,202 @@
+package dnscache
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+type fakeDNS struct {
+	sync.Mutex
+	calls map[string]int
+	hosts map[string]string
+	delay time.Duration
+}
+
+func (f *fakeDNS) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	time.Sleep(f.delay)
+	f.Lock()
+	defer f.Unlock()
+	f.calls[host]++
+	ip, ok := f.hosts[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return []net.IPAddr{{IP: net.ParseIP(ip)}}, nil
+}
+
+func (f *fakeDNS) count(host string) int {
+	f.Lock()
+	defer f.Unlock()
+	return f.calls[host]
+}
+
+func newResolver() (*Resolver, *fakeDNS) {
+	f := &fakeDNS{
+		calls: make(map[string]int),
+		hosts: map[string]string{"a.example.com": "10.0.0.1"},
+	}
+	r := New()
+	r.Lookup = f.lookup
+	return r, f
+}
+
+func TestResolver(t *testing.T) {
+	assert := assert.New(t)
+	r, f := newResolver()
+	r.TTL = 100 * time.Millisecond
+	r.NegativeTTL = 50 * time.Millisecond
+	f.delay = 10 * time.Millisecond
+
+	// Concurrent lookups are merged.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ips, err := r.LookupIP("a.example.com")
+			assert.NoError(err)
+			assert.Equal("10.0.0.1", ips[0].String())
+		}()
+	}
+	wg.Wait()
+	assert.Equal(1, f.count("a.example.com"))
+	r.LookupIP("A.example.com")
+	assert.Equal(1, f.count("a.example.com"))
+
+	// Negative caching
+	_, err := r.LookupIP("b.example.com")
+	assert.Error(err)
+	_, err = r.LookupIP("b.example.com")
+	assert.Error(err)
+	assert.Equal(1, f.count("b.example.com"))
+	time.Sleep(60 * time.Millisecond)
+	r.LookupIP("b.example.com")
+	assert.Equal(2, f.count("b.example.com"))
+
+	// Prefetch
+	f.Lock()
+	f.hosts["c.example.com"] = "10.0.0.3"
+	f.Unlock()
+	r.Prefetch("c.example.com", "127.0.0.1")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(1, f.count("c.example.com"))
+	r.LookupIP("c.example.com")
+	assert.Equal(1, f.count("c.example.com"))
+
+	// Overrides
+	r.Override("d.example.com", net.ParseIP("10.0.0.4"))
+	ips, err := r.LookupIP("d.example.com")
+	assert.NoError(err)
+	assert.Equal("10.0.0.4", ips[0].String())
+	assert.Equal(0, f.count("d.example.com"))
+	r.Override("d.example.com")
+	_, err = r.LookupIP("d.example.com")
+	assert.Error(err)
+
+	// The deadline has passed before the lookup finishes.
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+	_, err = r.LookupIPContext(ctx, "e.example.com")
+	assert.Equal(context.DeadlineExceeded, err)
+}
+
+func TestRefresh(t *testing.T) {
+	assert := assert.New(t)
+	r, f := newResolver()
+	r.TTL = 200 * time.Millisecond
+	r.LookupIP("a.example.com")
+
+	// Refreshed in background near expiration, while the cached entry is
+	// returned.
+	time.Sleep(160 * time.Millisecond)
+	f.Lock()
+	f.hosts["a.example.com"] = "10.0.0.2"
+	f.Unlock()
+	ips, _ := r.LookupIP("a.example.com")
+	assert.Equal("10.0.0.1", ips[0].String())
+	time.Sleep(20 * time.Millisecond)
+	ips, _ = r.LookupIP("a.example.com")
+	assert.Equal("10.0.0.2", ips[0].String())
+	assert.Equal(2, f.count("a.example.com"))
+}
+
+func TestEvict(t *testing.T) {
+	r, f := newResolver()
+	r.MaxEntries = 4
+	for i := 0; i < 10; i++ {
+		host := fmt.Sprint(i, ".example.com")
+		f.hosts[host] = "10.0.0.1"
+		r.LookupIP(host)
+	}
+	assert.Equal(t, 4, len(r.cache))
+}
+
+func TestDialer(t *testing.T) {
+	assert := assert.New(t)
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&n, 1)
+	}))
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+
+	r, f := newResolver()
+	f.hosts["local.example.com"] = "127.0.0.1"
+	r.Override("other.example.com:"+port, net.ParseIP("127.0.0.1"))
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: r.Dialer(&net.Dialer{Timeout: time.Second}),
+	}}
+	for _, host := range []string{"local.example.com", "other.example.com"} {
+		resp, err := client.Get("http://" + host + ":" + port + "/")
+		if assert.NoError(err) {
+			resp.Body.Close()
+		}
+	}
+	assert.Equal(int32(2), atomic.LoadInt32(&n))
+	assert.Equal(0, f.count("other.example.com"))
+	_, err := client.Get("http://other.example.com:1/")
+	assert.Error(err)
+}
+
+func TestDialDeadline(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now()
+	bg := context.Background()
+	assert.True(dialDeadline(bg, &net.Dialer{}, now).IsZero())
+	assert.Equal(now.Add(time.Second), dialDeadline(bg, &net.Dialer{Timeout: time.Second}, now))
+	ctx, cancel := context.WithDeadline(bg, now.Add(500*time.Millisecond))
+	defer cancel()
+	assert.Equal(now.Add(500*time.Millisecond), dialDeadline(ctx, &net.Dialer{
+		Timeout: time.Second,
+	}, now))
+
+	// The time left is shared among the remaining addresses.
+	deadline := now.Add(12 * time.Second)
+	assert.Equal(now.Add(4*time.Second), partialDeadline(now, deadline, 3))
+	assert.Equal(deadline, partialDeadline(now, deadline, 1))
+	assert.Equal(now.Add(minDialTimeout), partialDeadline(now, deadline, 12))
+	deadline = now.Add(time.Second)
+	assert.Equal(deadline, partialDeadline(now, deadline, 3))
+}
+
+func TestPrefetch(t *testing.T) {
+	assert := assert.New(t)
+	r, f := newResolver()
+	r.Prefetch("a.example.com", "10.0.0.9")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(1, f.count("a.example.com"))
+	// A fresh host is not looked up again.
+	r.Prefetch("a.example.com", "A.example.com")
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(1, f.count("a.example.com"))
+}
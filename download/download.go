@@ -3,11 +3,15 @@ package download
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/ratelimit"
 )
 
 type FreeList struct {
@@ -42,44 +46,70 @@ func (f *FreeList) Put(b *bytes.Buffer) {
 	}
 }
 
+// Downloader saves files under Dir. A file is written to a partial file
+// next to its path, and moved to the path when it's complete, so an
+// existing file is only replaced by a complete one.
 type Downloader struct {
 	Dir     string
 	GenPath func(*url.URL) string
+	// Client makes the requests of Fetch and the resumptions of
+	// interrupted downloads. If nil, crawler.DefaultHTTPClient is used.
+	// The requests are made with Client directly rather than through
+	// the crawler.Client of a crawler, so they are not subject to its
+	// cache, sessions, proxies, status policy or rate limits. Set the
+	// proxy and cookie jar of Client if they are needed.
+	Client *http.Client
+	// Bandwidth, if not nil, limits the bodies of the requests made by
+	// Downloader, and HostBandwidth is the limit of each host. Set it to
+	// Crawler.Bandwidth to share the limits of a crawler.
+	Bandwidth     *ratelimit.Bandwidth
+	HostBandwidth int
+	// Segments is the maximum number of concurrent range requests of a
+	// download made by Fetch. Zero or one means one request.
+	Segments int
+	// MinSegmentSize is the minimum size of a segment. Zero means 1MB.
+	MinSegmentSize int64
+	// MaxResumes is the maximum number of resumptions of an interrupted
+	// download. Zero means DefaultMaxResumes, and a negative value
+	// disables resumption.
+	MaxResumes int
 }
 
-func file(pth string) (f *os.File, err error) {
-	dir, _ := filepath.Split(pth)
-	if err = os.MkdirAll(dir, 0755); err != nil {
-		return
+func (d *Downloader) path(u *url.URL) string {
+	if d.GenPath != nil {
+		return d.GenPath(u)
 	}
-	return os.OpenFile(
-		pth,
-		os.O_WRONLY|os.O_CREATE|os.O_EXCL,
-		0644,
-	)
+	return d.genPath(u)
 }
 
+// Handle saves the content read from r as the file of u.
 func (d *Downloader) Handle(u *url.URL, r io.Reader) error {
-	var (
-		f   *os.File
-		pth string
-		err error
-	)
+	pth := d.path(u)
+	p := newPartial(u, pth, http.Header{}, -1)
+	return d.complete(pth, p, ioutil.NopCloser(r), nil)
+}
 
-	if d.GenPath != nil {
-		pth = d.GenPath(u)
-	} else {
-		pth = d.genPath(u)
+// HandleResponse saves the body of r as Handle does, unless the page is
+// marked as noarchive or not modified since the last visit. If the body
+// is cut off and r has a validator, the rest is downloaded with range
+// requests.
+func (d *Downloader) HandleResponse(r *crawler.Response, body io.Reader) error {
+	if r.Robots.NoArchive || r.NotModified {
+		return nil
 	}
-
-	if f, err = file(pth); err != nil {
-		return err
+	pth := d.path(r.URL)
+	header, length := r.Header, r.ContentLength
+	var restart func() (*partial, io.ReadCloser, error)
+	if r.Header.Get("Content-Encoding") != "" || r.Truncated {
+		// The offsets of the body are not those of the resource.
+		header, length = http.Header{}, -1
+	} else {
+		restart = func() (*partial, io.ReadCloser, error) {
+			return d.start(r.URL, pth)
+		}
 	}
-	defer f.Close()
-
-	_, err = io.Copy(f, r)
-	return err
-
+	p := newPartial(r.URL, pth, header, length)
+	return d.complete(pth, p, ioutil.NopCloser(body), restart)
 }
 
 func (d *Downloader) genPath(u *url.URL) string {
@@ -0,0 +1,229 @@
+package download
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// abortWriter drops the connection after n bytes of the body.
+type abortWriter struct {
+	http.ResponseWriter
+	n int
+}
+
+func (w *abortWriter) Write(b []byte) (int, error) {
+	if len(b) > w.n {
+		b = b[:w.n]
+	}
+	n, _ := w.ResponseWriter.Write(b)
+	if w.n -= n; w.n <= 0 {
+		w.ResponseWriter.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+	return n, nil
+}
+
+// server serves content with ETag. The first abort requests are cut off
+// after 1000 bytes. Range headers of requests are recorded.
+type server struct {
+	sync.Mutex
+	content []byte
+	etag    string
+	abort   int
+	ranges  []string
+	ifRange []string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.Lock()
+	content, etag := s.content, s.etag
+	s.ranges = append(s.ranges, req.Header.Get("Range"))
+	s.ifRange = append(s.ifRange, req.Header.Get("If-Range"))
+	if s.abort > 0 {
+		s.abort--
+		w = &abortWriter{ResponseWriter: w, n: 1000}
+	}
+	s.Unlock()
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, req, "file.bin", time.Unix(0, 0), bytes.NewReader(content))
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(b)
+	return b
+}
+
+func setup(t *testing.T, s *server) (*Downloader, *url.URL, func()) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	u, _ := url.Parse(ts.URL + "/file.bin")
+	d := &Downloader{Dir: dir, Client: ts.Client()}
+	return d, u, func() {
+		ts.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func assertFile(t *testing.T, d *Downloader, u *url.URL, content []byte) {
+	pth := d.path(u)
+	b, err := ioutil.ReadFile(pth)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(content, b), "content mismatch")
+	_, err = os.Stat(pth + partSuffix)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(pth + metaSuffix)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFetchSegments(t *testing.T) {
+	s := &server{content: random(1 << 20), etag: `"v1"`}
+	d, u, done := setup(t, s)
+	defer done()
+	d.Segments, d.MinSegmentSize = 4, 100<<10
+
+	assert.NoError(t, d.Fetch(u))
+	assertFile(t, d, u, s.content)
+	assert.Len(t, s.ranges, 4)
+	assert.Equal(t, "bytes=0-", s.ranges[0])
+	for _, v := range s.ifRange[1:] {
+		assert.Equal(t, `"v1"`, v)
+	}
+}
+
+func TestFetchBandwidth(t *testing.T) {
+	s := &server{content: random(200 << 10), etag: `"v1"`}
+	d, u, done := setup(t, s)
+	defer done()
+	d.Segments, d.MinSegmentSize = 2, 50<<10
+	// The burst of one second is free, and the rest takes one second.
+	d.Bandwidth = ratelimit.NewBandwidth(100 << 10)
+
+	start := time.Now()
+	assert.NoError(t, d.Fetch(u))
+	assert.True(t, time.Since(start) > 900*time.Millisecond)
+	assertFile(t, d, u, s.content)
+}
+
+func TestFetchResume(t *testing.T) {
+	s := &server{content: random(100 << 10), etag: `"v1"`, abort: 2}
+	d, u, done := setup(t, s)
+	defer done()
+
+	assert.NoError(t, d.Fetch(u))
+	assertFile(t, d, u, s.content)
+	assert.Len(t, s.ranges, 3)
+	for i := 1; i < 3; i++ {
+		assert.True(t, strings.HasPrefix(s.ranges[i], "bytes="))
+		assert.NotEqual(t, "bytes=0-", s.ranges[i])
+		assert.Equal(t, `"v1"`, s.ifRange[i])
+	}
+}
+
+func TestFetchLater(t *testing.T) {
+	s := &server{content: random(100 << 10), etag: `"v1"`, abort: 1}
+	d, u, done := setup(t, s)
+	defer done()
+	d.MaxResumes = -1
+
+	assert.Error(t, d.Fetch(u))
+	pth := d.path(u)
+	_, err := os.Stat(pth + partSuffix)
+	assert.NoError(t, err)
+	_, err = os.Stat(pth)
+	assert.True(t, os.IsNotExist(err))
+
+	// A new downloader picks up the partial file.
+	d = &Downloader{Dir: d.Dir, Client: d.Client, MaxResumes: -1}
+	assert.NoError(t, d.Fetch(u))
+	assertFile(t, d, u, s.content)
+	assert.NotEqual(t, "bytes=0-", s.ranges[1])
+}
+
+func TestFetchChanged(t *testing.T) {
+	s := &server{content: random(100 << 10), etag: `"v1"`, abort: 1}
+	d, u, done := setup(t, s)
+	defer done()
+	d.MaxResumes = -1
+	assert.Error(t, d.Fetch(u))
+
+	s.Lock()
+	s.content, s.etag = random(50<<10), `"v2"`
+	s.Unlock()
+	// The resumption is refused, and the download starts over.
+	d.MaxResumes = 0
+	assert.NoError(t, d.Fetch(u))
+	assertFile(t, d, u, s.content)
+}
+
+func TestHandle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	d := &Downloader{Dir: dir}
+	u, _ := url.Parse("http://example.com/a.txt")
+
+	assert.NoError(t, d.Handle(u, strings.NewReader("old")))
+	// An existing file is replaced.
+	assert.NoError(t, d.Handle(u, strings.NewReader("new")))
+	assertFile(t, d, u, []byte("new"))
+}
+
+func TestSavePartial(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	u, _ := url.Parse("http://example.com/a")
+	pth := dir + "/a"
+	p := newPartial(u, pth, http.Header{"Etag": []string{`"v1"`}}, 1<<10)
+	p.split(4, 256)
+	f, err := openPart(pth, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Truncate(p.Length)
+
+	// Concurrent saves of segments don't interleave.
+	var wg sync.WaitGroup
+	for _, s := range p.Segments {
+		wg.Add(1)
+		go func(s *segment) {
+			defer wg.Done()
+			w := &segmentWriter{f: f, p: p, s: s}
+			for i := 0; i < 16; i++ {
+				w.Write(make([]byte, 16))
+				assert.NoError(p.save(f))
+			}
+		}(s)
+	}
+	wg.Wait()
+	q := loadPartial(u, pth)
+	if assert.NotNil(q) {
+		for i, s := range q.Segments {
+			assert.Equal(int64(256), s.Done, "segment %d", i)
+		}
+	}
+	_, err = os.Stat(pth + metaSuffix + tempSuffix)
+	assert.True(os.IsNotExist(err))
+}
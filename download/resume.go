@@ -0,0 +1,520 @@
+package download
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fanyang01/crawler"
+	"golang.org/x/net/context"
+)
+
+// ErrChanged is returned when the resource has changed during a download,
+// or the downloaded file doesn't match its length, so the partial file is
+// discarded.
+var ErrChanged = errors.New("download: resource changed during download")
+
+// DefaultMaxResumes is the number of resumptions used when
+// Downloader.MaxResumes is zero.
+const DefaultMaxResumes = 3
+
+const (
+	partSuffix = ".part"
+	metaSuffix = ".part.json"
+	tempSuffix = ".tmp"
+	// saveInterval is the number of bytes written between saves of the
+	// bookkeeping of a segment.
+	saveInterval = 4 << 20
+)
+
+// partial is the bookkeeping of an unfinished download, which is saved
+// next to the partial file, so that the download can be resumed later.
+type partial struct {
+	URL          string
+	ETag         string
+	LastModified string
+	Length       int64 // -1 if unknown
+	Segments     []*segment
+
+	mu     sync.Mutex
+	saving sync.Mutex // serializes saves
+	path   string
+}
+
+// segment is a range of the file. End is inclusive, or -1 if the length
+// is unknown.
+type segment struct {
+	Start, End int64
+	Done       int64
+}
+
+func (s *segment) finished() bool {
+	return s.End >= 0 && s.Start+s.Done > s.End
+}
+
+func newPartial(u *url.URL, pth string, header http.Header, length int64) *partial {
+	p := &partial{
+		URL:          u.String(),
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		Length:       length,
+		path:         pth,
+	}
+	if length < 0 {
+		p.Length = -1
+	}
+	p.Segments = []*segment{{Start: 0, End: p.Length - 1}}
+	return p
+}
+
+// resumable reports whether there is a validator to resume safely.
+func (p *partial) resumable() bool {
+	return strongETag(p.ETag) || p.LastModified != ""
+}
+
+func strongETag(etag string) bool {
+	return etag != "" && !strings.HasPrefix(etag, "W/")
+}
+
+// loadPartial returns the bookkeeping of the unfinished download of u at
+// pth, or nil if there's none.
+func loadPartial(u *url.URL, pth string) *partial {
+	b, err := ioutil.ReadFile(pth + metaSuffix)
+	if err != nil {
+		return nil
+	}
+	p := &partial{path: pth}
+	if json.Unmarshal(b, p) != nil || p.URL != u.String() ||
+		len(p.Segments) == 0 || !p.resumable() {
+		return nil
+	}
+	fi, err := os.Stat(pth + partSuffix)
+	if err != nil {
+		return nil
+	}
+	// Bytes written after the last save are downloaded again, but those
+	// lost before reaching the disk must not be skipped.
+	for _, s := range p.Segments {
+		if s.Start+s.Done > fi.Size() {
+			if s.Done = fi.Size() - s.Start; s.Done < 0 {
+				s.Done = 0
+			}
+		}
+	}
+	return p
+}
+
+// save writes the bookkeeping of p. The partial file f is synced after
+// the bookkeeping is taken and before it's written, so that it never
+// covers bytes that are not on the disk. It's written to a temporary file
+// that replaces the old one, so a crash never leaves it truncated.
+func (p *partial) save(f *os.File) error {
+	p.saving.Lock()
+	defer p.saving.Unlock()
+
+	p.mu.Lock()
+	b, err := json.Marshal(p)
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	tmp := p.path + metaSuffix + tempSuffix
+	t, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = t.Write(b); err == nil {
+		err = t.Sync()
+	}
+	if e := t.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, p.path+metaSuffix)
+}
+
+// discard removes the partial file and its bookkeeping.
+func discard(pth string) {
+	os.Remove(pth + partSuffix)
+	os.Remove(pth + metaSuffix)
+	os.Remove(pth + metaSuffix + tempSuffix)
+}
+
+// finish verifies the partial file and moves it to pth.
+func (p *partial) finish(f *os.File) error {
+	for _, s := range p.Segments {
+		if s.End >= 0 && !s.finished() {
+			return io.ErrUnexpectedEOF
+		}
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if p.Length >= 0 && fi.Size() != p.Length {
+		return ErrChanged
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = os.Rename(p.path+partSuffix, p.path); err != nil {
+		return err
+	}
+	os.Remove(p.path + metaSuffix)
+	return nil
+}
+
+// segmentWriter writes to the segment of the partial file.
+type segmentWriter struct {
+	f       *os.File
+	p       *partial
+	s       *segment
+	unsaved int64
+}
+
+func (w *segmentWriter) Write(b []byte) (int, error) {
+	n, err := w.f.WriteAt(b, w.s.Start+w.s.Done)
+	w.p.mu.Lock()
+	w.s.Done += int64(n)
+	w.p.mu.Unlock()
+	if w.unsaved += int64(n); w.unsaved >= saveInterval {
+		w.unsaved = 0
+		w.p.save(w.f)
+	}
+	return n, err
+}
+
+// fill copies body into s. A body shorter than the segment is an error.
+func (p *partial) fill(f *os.File, s *segment, body io.Reader) error {
+	w := &segmentWriter{f: f, p: p, s: s}
+	if s.End < 0 {
+		_, err := io.Copy(w, body)
+		return err
+	}
+	_, err := io.CopyN(w, body, s.End-s.Start+1-s.Done)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *Downloader) client() *http.Client {
+	if d.Client != nil {
+		return d.Client
+	}
+	return crawler.DefaultHTTPClient
+}
+
+func (d *Downloader) maxResumes() int {
+	switch {
+	case d.MaxResumes < 0:
+		return 0
+	case d.MaxResumes == 0:
+		return DefaultMaxResumes
+	}
+	return d.MaxResumes
+}
+
+func (d *Downloader) minSegmentSize() int64 {
+	if d.MinSegmentSize > 0 {
+		return d.MinSegmentSize
+	}
+	return 1 << 20
+}
+
+// get requests the range of s in u. It returns ErrChanged if the resource
+// is not the one described by p.
+func (d *Downloader) get(ctx context.Context, p *partial, s *segment) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", p.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	start := s.Start + s.Done
+	if s.End >= 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, s.End))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+	}
+	if strongETag(p.ETag) {
+		req.Header.Set("If-Range", p.ETag)
+	} else {
+		req.Header.Set("If-Range", p.LastModified)
+	}
+	// The offsets are those of the identity encoding.
+	req.Header.Set("Accept-Encoding", "identity")
+
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return nil, crawler.RetryableError{Err: err}
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			// If-Range doesn't match, or ranges are not supported.
+			return nil, ErrChanged
+		}
+		return nil, statusError(resp.StatusCode)
+	}
+	first, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+	if !ok || first != start || (p.Length >= 0 && total != p.Length) ||
+		(p.ETag != "" && resp.Header.Get("ETag") != "" &&
+			resp.Header.Get("ETag") != p.ETag) {
+		resp.Body.Close()
+		return nil, ErrChanged
+	}
+	return d.limit(resp), nil
+}
+
+// statusError classifies a status like crawler.StdClient.
+func statusError(code int) error {
+	err := crawler.ResponseStatusError(code)
+	if code >= 500 || (code >= 400 && code != 404) {
+		return crawler.RetryableError{Err: err}
+	}
+	return err
+}
+
+// parseContentRange parses "bytes first-last/total". total is -1 if it's
+// unknown.
+func parseContentRange(s string) (first, last, total int64, ok bool) {
+	if !strings.HasPrefix(s, "bytes ") {
+		return
+	}
+	s = s[len("bytes "):]
+	i, j := strings.IndexByte(s, '-'), strings.IndexByte(s, '/')
+	if i < 0 || j < i {
+		return
+	}
+	var err error
+	if first, err = strconv.ParseInt(s[:i], 10, 64); err != nil {
+		return
+	}
+	if last, err = strconv.ParseInt(s[i+1:j], 10, 64); err != nil {
+		return
+	}
+	if total = -1; s[j+1:] != "*" {
+		if total, err = strconv.ParseInt(s[j+1:], 10, 64); err != nil {
+			return
+		}
+	}
+	return first, last, total, first <= last
+}
+
+// run fills the unfinished segments of p concurrently. If first is not
+// nil, it's the body of the first segment.
+func (d *Downloader) run(f *os.File, p *partial, first io.ReadCloser) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			cancel()
+		})
+	}
+	for _, s := range p.Segments {
+		if s.finished() {
+			continue
+		}
+		body := first
+		first = nil
+		wg.Add(1)
+		go func(s *segment, body io.ReadCloser) {
+			defer wg.Done()
+			if body == nil {
+				var e error
+				if body, e = d.get(ctx, p, s); e != nil {
+					fail(e)
+					return
+				}
+			}
+			defer body.Close()
+			if e := p.fill(f, s, body); e != nil {
+				fail(e)
+			}
+		}(s, body)
+	}
+	if first != nil {
+		first.Close()
+	}
+	wg.Wait()
+	return err
+}
+
+// split divides the first segment into at most n segments.
+func (p *partial) split(n int, min int64) {
+	if n < 2 || p.Length < 2*min || len(p.Segments) != 1 || p.Segments[0].Done > 0 {
+		return
+	}
+	size := p.Length / int64(n)
+	if size < min {
+		size = min
+	}
+	p.Segments = p.Segments[:0]
+	for start := int64(0); start < p.Length; start += size {
+		end := start + size - 1
+		if end >= p.Length-1 || p.Length-1-end < min {
+			end = p.Length - 1
+		}
+		p.Segments = append(p.Segments, &segment{Start: start, End: end})
+		if end == p.Length-1 {
+			break
+		}
+	}
+}
+
+// openPart opens the partial file. It's created and truncated if create
+// is true.
+func openPart(pth string, create bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+		return nil, err
+	}
+	flag := os.O_WRONLY
+	if create {
+		flag |= os.O_CREATE | os.O_TRUNC
+	}
+	return os.OpenFile(pth+partSuffix, flag, 0644)
+}
+
+// start makes the first request of a new download, which asks for the
+// whole file as a range to learn whether ranges are supported.
+func (d *Downloader) start(u *url.URL, pth string) (*partial, io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Range", "bytes=0-")
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err := d.client().Do(req)
+	if err != nil {
+		return nil, nil, crawler.RetryableError{Err: err}
+	}
+	var p *partial
+	switch resp.StatusCode {
+	case http.StatusOK:
+		p = newPartial(u, pth, resp.Header, resp.ContentLength)
+	case http.StatusPartialContent:
+		first, _, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || first != 0 {
+			resp.Body.Close()
+			return nil, nil, fmt.Errorf("download: invalid Content-Range: %q",
+				resp.Header.Get("Content-Range"))
+		}
+		p = newPartial(u, pth, resp.Header, total)
+		if p.resumable() {
+			p.split(d.Segments, d.minSegmentSize())
+		}
+	default:
+		resp.Body.Close()
+		return nil, nil, statusError(resp.StatusCode)
+	}
+	return p, d.limit(resp), nil
+}
+
+// limit returns the body of resp limited by d.Bandwidth.
+func (d *Downloader) limit(resp *http.Response) io.ReadCloser {
+	if d.Bandwidth == nil {
+		return resp.Body
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{
+		d.Bandwidth.Reader(resp.Body, resp.Request.URL.Host, d.HostBandwidth),
+		resp.Body,
+	}
+}
+
+// Fetch downloads u to its path. An interrupted download is resumed with
+// range requests, including the one left by a previous call or process.
+// If the server supports ranges and Segments is larger than 1, the file
+// is downloaded in parallel segments. The file is moved to its path only
+// after it's complete.
+func (d *Downloader) Fetch(u *url.URL) error {
+	pth := d.path(u)
+	return d.complete(pth, loadPartial(u, pth), nil, func() (*partial, io.ReadCloser, error) {
+		return d.start(u, pth)
+	})
+}
+
+// complete runs the download described by p until it's finished or the
+// resumptions are exhausted. If p is nil, restart begins a new download.
+func (d *Downloader) complete(
+	pth string, p *partial, body io.ReadCloser,
+	restart func() (*partial, io.ReadCloser, error),
+) (err error) {
+	var f *os.File
+	for attempt := 0; ; attempt++ {
+		create := p == nil || body != nil
+		if p == nil {
+			if restart == nil {
+				return err
+			}
+			if p, body, err = restart(); err != nil {
+				goto RETRY
+			}
+		}
+		if f, err = openPart(pth, create); err != nil {
+			if body != nil {
+				body.Close()
+			}
+			return err
+		}
+		if create && p.Length > 0 && len(p.Segments) > 1 {
+			f.Truncate(p.Length)
+		}
+		if p.resumable() {
+			p.save(f)
+		}
+		err = d.run(f, p, body)
+		body = nil
+		if err == nil {
+			err = p.finish(f)
+		}
+		if err != nil && err != ErrChanged && p.resumable() {
+			// Saved before f is closed, so that its data can be synced.
+			p.save(f)
+		}
+		f.Close()
+		if err == nil {
+			return nil
+		}
+	RETRY:
+		if p != nil && (err == ErrChanged || !p.resumable()) {
+			discard(pth)
+			p = nil
+		}
+		if attempt >= d.maxResumes() || !retryable(err) {
+			return err
+		}
+	}
+}
+
+func retryable(err error) bool {
+	switch err.(type) {
+	case crawler.RetryableError, net.Error:
+		return true
+	}
+	return err == ErrChanged || err == io.ErrUnexpectedEOF
+}
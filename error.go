@@ -1,8 +1,16 @@
 package crawler
 
-import "net/url"
+import (
+	"net/url"
+	"time"
+)
 
-type RetryableError struct{ Err error }
+// RetryableError is an error after which the request is retried. After, if
+// positive, is the minimum delay of the retry, e.g., that of Retry-After.
+type RetryableError struct {
+	Err   error
+	After time.Duration
+}
 type FatalError struct{ Err error }
 
 func (e RetryableError) Error() string {
@@ -39,7 +39,7 @@ var freelist = download.NewFreeList(1<<20, 32)
 func (c *Controller) Handle(r *crawler.Response, ch chan<- *url.URL) {
 	var (
 		html   = media.IsHTML(r.ContentType)
-		body   = io.LimitReader(r.Body, 1<<20)
+		body   = r.Body // limited by Option.MaxBodySize
 		logger = c.logger.New("url", r.URL)
 		err    error
 		buf    *bytes.Buffer
@@ -49,7 +49,7 @@ func (c *Controller) Handle(r *crawler.Response, ch chan<- *url.URL) {
 
 	if !html {
 		uniq = true
-		if err = c.downloader.Handle(r.URL, body); err != nil {
+		if err = c.downloader.HandleResponse(r, body); err != nil {
 			logger.Error("download", "err", err)
 		}
 		goto LOG
@@ -69,7 +69,7 @@ func (c *Controller) Handle(r *crawler.Response, ch chan<- *url.URL) {
 			logger.Error("extract links", "err", err)
 			goto LOG
 		}
-		if err = c.downloader.Handle(r.URL, buf); err != nil {
+		if err = c.downloader.HandleResponse(r, buf); err != nil {
 			c.logger.Error("download", "err", err)
 		}
 	} else {
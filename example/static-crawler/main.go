@@ -142,11 +142,15 @@ func main() {
 		log.Fatal(http.ListenAndServe("localhost:7869", nil))
 	}()
 
+	opt := *crawler.DefaultOption
+	opt.MaxBodySize = 1 << 20
+	opt.TruncateBody = true
 	cw := crawler.New(&crawler.Config{
 		Controller: ctrl,
 		Logger:     logger,
 		Store:      store,
 		Queue:      queue,
+		Option:     &opt,
 	})
 	if err := cw.Crawl(urls[offset-1 : offset-1+nseed]...); err != nil {
 		log.Fatal(err)
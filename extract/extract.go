@@ -3,11 +3,11 @@ package extract
 
 import (
 	"io"
-	"net"
 	"net/url"
 	"strings"
 
 	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/dnscache"
 	"github.com/fanyang01/crawler/urlx"
 
 	"golang.org/x/net/html"
@@ -23,15 +23,23 @@ type Extractor struct {
 
 	// Conflict with host matcher
 	SubDomain bool // www.example.com -> {example.com, **.example.com}
+	// ResolveIP accepts hosts that share an address with the host of the
+	// page. Lookups are cached by Resolver, or crawler.DefaultResolver if
+	// it's nil.
 	ResolveIP bool
+	Resolver  *dnscache.Resolver
 
 	Pos        []struct{ Tag, Attr string }
 	Redirect   bool
 	SniffFlags int
+	// SkipNoFollow skips elements whose rel attribute contains nofollow,
+	// ugc or sponsored.
+	SkipNoFollow bool
 }
 
 // Extract parses the HTML document, extracts URLs and filters them using
-// the matcher.
+// the matcher. The document is not parsed if r.NoFollow reports true, but
+// the redirect targets are still sent if Redirect is set.
 func (e *Extractor) Extract(
 	r *crawler.Response, body io.Reader, ch chan<- *url.URL,
 ) error {
@@ -50,7 +58,12 @@ func (e *Extractor) Extract(
 		}
 	}
 	chErr := make(chan error, 1)
-	go e.tokenLoop(r, body, chURL, chErr)
+	if r.NoFollow() {
+		close(chURL)
+		close(chErr)
+	} else {
+		go e.tokenLoop(r, body, chURL, chErr)
+	}
 
 	scheme, host := r.URL.Scheme, r.URL.Host
 	for u := range chURL {
@@ -69,9 +82,13 @@ func (e *Extractor) Extract(
 				}
 			}
 			if e.ResolveIP {
-				if ip0, err := net.LookupIP(host); err != nil {
+				resolver := e.Resolver
+				if resolver == nil {
+					resolver = crawler.DefaultResolver
+				}
+				if ip0, err := resolver.LookupIP(r.URL.Hostname()); err != nil {
 					continue
-				} else if ip1, err := net.LookupIP(u.Host); err != nil {
+				} else if ip1, err := resolver.LookupIP(u.Hostname()); err != nil {
 					continue
 				} else {
 					for _, i0 := range ip0 {
@@ -134,6 +151,11 @@ func (e *Extractor) tokenLoop(
 				err  error
 				name = string(token.Data)
 			)
+			if e.SkipNoFollow {
+				if rel, ok := get(&token, "rel"); ok && crawler.IsNoFollow(rel) {
+					continue
+				}
+			}
 			for _, d := range dest {
 				if name != d.Tag {
 					continue
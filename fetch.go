@@ -19,6 +19,10 @@ import (
 	"golang.org/x/net/html/charset"
 )
 
+// previewSize is the number of bytes read ahead to detect content type
+// and scan <head>.
+const previewSize = 4096
+
 type fetcher struct {
 	workerConn
 	In     <-chan *Request
@@ -45,6 +49,7 @@ func (f *fetcher) work() {
 			out    = f.Out
 			errOut chan *Context
 			logger = f.logger.New("url", req.URL)
+			start  = time.Now()
 		)
 		r, err := req.Client.Do(req)
 		if err != nil {
@@ -54,10 +59,11 @@ func (f *fetcher) work() {
 			goto END
 		}
 		logger.Info(r.Status)
-		if err := f.initResponse(req, r); err != nil {
+		if err := f.initResponse(req, r, start); err != nil {
 			req.ctx.err = err
 			out, errOut = nil, f.ErrOut
 			logger.Error("initialize response", "err", err)
+			r.bodyCloser.Close()
 			r.free()
 		}
 	END:
@@ -70,7 +76,7 @@ func (f *fetcher) work() {
 	}
 }
 
-func (f *fetcher) initResponse(req *Request, r *Response) error {
+func (f *fetcher) initResponse(req *Request, r *Response, start time.Time) error {
 	// Redirected response is treated as the response of original URL,
 	// because we need to ensure there is only one instance of a URL in the
 	// processing flow, but many URLs can redirect to the same location.
@@ -81,22 +87,34 @@ func (f *fetcher) initResponse(req *Request, r *Response) error {
 	r.ctx = req.ctx
 	r.Timestamp = time.Now()
 	r.scanLocation()
+	r.scanRobotsTag(f.cw.opt.RobotAgent)
 	if err := r.normalize(f.cw.normalize); err != nil {
 		return err
 	}
+	if r.NotModified {
+		return nil // nothing to inspect
+	}
+	r.Body = f.cw.bandwidth.Reader(r.Body, r.URL.Host, req.HostBandwidth)
+	if err := r.limitBody(req, start); err != nil {
+		return err
+	}
 	r.detectContentType()
 
 	var (
 		preview []byte
 		err     error
 	)
-	if preview, err = r.preview(1024); err != nil {
+	if preview, err = r.preview(previewSize); err != nil {
+		if _, ok := err.(LimitError); ok {
+			return err
+		}
 		return fmt.Errorf("preview: %v", err)
 	}
 	if !r.CertainType {
 		r.ContentType = http.DetectContentType(preview)
 	}
-	r.scanHTMLMeta(preview)
+	r.scanHTMLMeta(preview, f.cw.opt.RobotAgent)
+	r.initRelations(f.cw.normalize)
 	r.convToUTF8(preview, f.cw.ctrl.Charset)
 	return nil
 }
@@ -148,6 +166,15 @@ func (r *Response) scanLocation() {
 	if s := r.Header.Get("Refresh"); s != "" {
 		r.Refresh.Seconds, r.Refresh.URL = parseRefresh(s, baseurl)
 	}
+	for _, v := range r.Header["Link"] {
+		r.WebLinks = append(r.WebLinks, parseLinkHeader(v, baseurl)...)
+	}
+}
+
+func (r *Response) scanRobotsTag(agent string) {
+	for _, v := range r.Header["X-Robots-Tag"] {
+		r.Robots.ParseHeader(agent, v)
+	}
 }
 
 func (r *Response) detectContentType() (sure bool) {
@@ -184,22 +211,35 @@ func (r *Response) detectContentType() (sure bool) {
 	return false
 }
 
-func (r *Response) scanHTMLMeta(content []byte) {
+// scanHTMLMeta scans <meta> tags for content type, charset, refresh and
+// robots directives, and <link> tags for typed links, until <body> is
+// met. Directives in <meta name="robots"> and <meta name=agent> are
+// applied.
+func (r *Response) scanHTMLMeta(content []byte, agent string) {
+	agent = strings.ToLower(agent)
 	if len(content) == 0 {
 		return
 	}
-	if len(content) > 1024 {
-		content = content[:1024]
-	}
 	z := html.NewTokenizer(bytes.NewReader(content))
 	for {
 		switch z.Next() {
 		case html.ErrorToken:
 			return
+		case html.EndTagToken:
+			if tagName, _ := z.TagName(); bytes.Equal(tagName, []byte("head")) {
+				return
+			}
 
 		case html.StartTagToken, html.SelfClosingTagToken:
 			tagName, hasAttr := z.TagName()
-			if !bytes.Equal(tagName, []byte("meta")) {
+			if bytes.Equal(tagName, []byte("body")) {
+				return
+			} else if bytes.Equal(tagName, []byte("link")) {
+				if hasAttr {
+					r.scanHTMLLink(z)
+				}
+				continue
+			} else if !bytes.Equal(tagName, []byte("meta")) {
 				continue
 			}
 			attrList := make(map[string]bool)
@@ -208,6 +248,7 @@ func (r *Response) scanHTMLMeta(content []byte) {
 				pragmaUnknown = iota
 				pragmaContentType
 				pragmaRefresh
+				pragmaRobots
 			)
 			pragma := pragmaUnknown
 			content := ""
@@ -234,6 +275,10 @@ func (r *Response) scanHTMLMeta(content []byte) {
 					case "refresh":
 						pragma = pragmaRefresh
 					}
+				case "name":
+					if s := string(bytes.TrimSpace(val)); s == "robots" || s == agent {
+						pragma = pragmaRobots
+					}
 				case "content":
 					content = string(val)
 				case "charset":
@@ -259,11 +304,36 @@ func (r *Response) scanHTMLMeta(content []byte) {
 				if content = strings.TrimSpace(content); content != "" {
 					r.Refresh.Seconds, r.Refresh.URL = parseRefresh(content, r.NewURL)
 				}
+			case pragmaRobots:
+				r.Robots.Parse(content)
 			}
 		}
 	}
 }
 
+func (r *Response) scanHTMLLink(z *html.Tokenizer) {
+	var href, rel string
+	for more := true; more; {
+		var key, val []byte
+		key, val, more = z.TagAttr()
+		switch string(key) {
+		case "href":
+			href = strings.TrimSpace(string(val))
+		case "rel":
+			rel = strings.ToLower(string(val))
+		}
+	}
+	if href == "" || rel == "" {
+		return
+	}
+	if u, err := urlx.ParseRef(r.NewURL, href); err == nil {
+		r.WebLinks = append(r.WebLinks, WebLink{
+			URL: u,
+			Rel: strings.Fields(rel),
+		})
+	}
+}
+
 func fmtContentType(s string) string {
 	m, p, err := mime.ParseMediaType(s)
 	if err != nil {
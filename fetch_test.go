@@ -8,6 +8,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -19,6 +20,9 @@ func TestFetchParse(t *testing.T) {
 <meta http-equiv="content-type" content="text/html;charset=GBK">
 <meta charset="GBK">
 <meta http-equiv="refresh" content="30; URL=1.html">
+<meta name="robots" content="noarchive">
+<meta name="GoCrawler" content="nofollow">
+<meta name="otherbot" content="noindex">
 </head>
 <body>
 </body>
@@ -34,6 +38,8 @@ func TestFetchParse(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 		w.Header().Set("Content-Location", "index.html")
+		w.Header().Add("X-Robots-Tag", "otherbot: none")
+		w.Header().Add("X-Robots-Tag", "unavailable_after: Friday, 25-Jun-10 15:00:00 PST")
 		fmt.Fprint(w, page)
 	}))
 	defer ts.Close()
@@ -51,12 +57,13 @@ func TestFetchParse(t *testing.T) {
 	assert := assert.New(t)
 
 	resp.scanLocation()
+	resp.scanRobotsTag("gocrawler")
 	resp.detectContentType()
 
 	preview, err := resp.preview(1024)
 	assert.Nil(err)
 
-	resp.scanHTMLMeta(preview)
+	resp.scanHTMLMeta(preview, "gocrawler")
 
 	assert.Equal(url, resp.NewURL.String())
 	assert.Equal(`text/html; charset=gbk`, resp.ContentType)
@@ -64,6 +71,10 @@ func TestFetchParse(t *testing.T) {
 	assert.Equal(url+"1.html", resp.Refresh.URL.String())
 	assert.Equal(url+"index.html", resp.ContentLocation.String())
 	assert.Equal(30, resp.Refresh.Seconds)
+	assert.False(resp.Robots.NoIndex)
+	assert.True(resp.Robots.NoFollow)
+	assert.True(resp.Robots.NoArchive)
+	assert.Equal(2010, resp.Robots.UnavailableAfter.Year())
 }
 
 func TestConvToUTF8(t *testing.T) {
@@ -114,3 +125,75 @@ func TestConvToUTF8(t *testing.T) {
 		assert.Equal(exp[i].Content, b)
 	}
 }
+
+func TestLimitBody(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := strings.Repeat("x", 1000)
+		switch r.URL.Path {
+		case "/length":
+			w.Header().Set("Content-Length", "1000")
+			fmt.Fprint(w, body)
+		case "/chunked":
+			fmt.Fprint(w, body[:500])
+			w.(http.Flusher).Flush()
+			fmt.Fprint(w, body[500:])
+		case "/slow":
+			fmt.Fprint(w, body[:500])
+			w.(http.Flusher).Flush()
+			time.Sleep(500 * time.Millisecond)
+			fmt.Fprint(w, body[500:])
+		}
+	}))
+	defer ts.Close()
+
+	fetch := func(path string, req *Request) (*Response, error) {
+		hreq, err := http.NewRequest("GET", ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Request = hreq
+		start := time.Now()
+		r, err := DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, r.limitBody(req, start)
+	}
+
+	r, err := fetch("/length", &Request{MaxBodySize: 100, TruncateBody: true})
+	assert.NoError(err)
+	b, err := ioutil.ReadAll(r.Body)
+	assert.NoError(err)
+	assert.Equal(100, len(b))
+	assert.True(r.Truncated)
+
+	_, err = fetch("/length", &Request{MaxBodySize: 100})
+	assert.Equal(ErrBodyTooLarge, err)
+
+	r, err = fetch("/chunked", &Request{MaxBodySize: 100})
+	assert.NoError(err)
+	b, err = ioutil.ReadAll(r.Body)
+	assert.Equal(ErrBodyTooLarge, err)
+	assert.Equal(100, len(b))
+	assert.False(r.Truncated)
+
+	r, err = fetch("/chunked", &Request{MaxBodySize: 1000})
+	assert.NoError(err)
+	b, err = ioutil.ReadAll(r.Body)
+	assert.NoError(err)
+	assert.Equal(1000, len(b))
+	assert.False(r.Truncated)
+
+	r, err = fetch("/slow", &Request{MaxFetchTime: 100 * time.Millisecond, TruncateBody: true})
+	assert.NoError(err)
+	b, err = ioutil.ReadAll(r.Body)
+	assert.NoError(err)
+	assert.Equal(500, len(b))
+	assert.True(r.Truncated)
+
+	r, err = fetch("/slow", &Request{MaxFetchTime: 100 * time.Millisecond})
+	assert.NoError(err)
+	_, err = ioutil.ReadAll(r.Body)
+	assert.Equal(ErrFetchTimeout, err)
+}
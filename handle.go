@@ -59,44 +59,111 @@ func (h *handler) work() {
 
 func (h *handler) handle(r *Response) error {
 	depth := r.ctx.Depth()
-	ch := make(chan *url.URL, perPage)
+	if h.cw.opt.SitemapDiscovery {
+		// The scheduler doesn't finish while sites are being discovered.
+		h.cw.sitemaps.Discover(r.URL, depth)
+	}
+	ch := make(chan *Link, perPage)
 	go func() {
 		if h.cw.opt.FollowRedirect {
 			// Treat the new URL as one found under the original URL
 			original := r.URL.String()
 			if r.NewURL.String() != original {
 				newurl := *r.NewURL
-				ch <- &newurl
+				ch <- &Link{URL: &newurl}
 			}
 			if refresh := r.Refresh.URL; refresh != nil &&
 				refresh.String() != original {
 				newurl := *refresh
-				ch <- &newurl
+				ch <- &Link{URL: &newurl}
 			}
 		}
-		h.cw.ctrl.Handle(r, ch)
+		h.handleCtrl(r, ch)
 		close(ch)
 	}()
 	return h.handleLink(r, ch, depth)
 }
 
-func (h *handler) handleLink(r *Response, ch <-chan *url.URL, depth int) error {
-	for u := range ch {
-		if err := h.cw.normalize(u); err != nil {
-			h.logger.Debug("normalize URL", "url", u, "err", err)
+// handleCtrl passes r to controller. See HandleLink.
+func (h *handler) handleCtrl(r *Response, ch chan<- *Link) {
+	HandleLink(h.cw.ctrl, r, ch)
+}
+
+func (h *handler) handleLink(r *Response, ch <-chan *Link, depth int) error {
+	if err := h.canonicalize(r, depth); err != nil {
+		return err
+	}
+	// Links are drained but discarded if the page is a duplicate, or if
+	// it's nofollow and they are not redirect targets.
+	nofollow := r.NoFollow()
+	for link := range ch {
+		if r.duplicate || (nofollow && !r.isRedirect(link.URL)) {
 			continue
 		}
-		if ok, err := h.filter(r, u, depth); err != nil {
+		if err := h.cw.normalize(link.URL); err != nil {
+			h.logger.Debug("normalize URL", "url", link.URL, "err", err)
+			continue
+		}
+		if ok, err := h.filter(r, link, depth+1); err != nil {
 			return err
 		} else if ok {
-			r.links = append(r.links, u)
+			r.links = append(r.links, link)
 		}
 	}
 	return nil
 }
 
-func (h *handler) filter(r *Response, u *url.URL, depth int) (bool, error) {
-	if !h.cw.ctrl.Accept(r, u) {
+// canonicalize marks r as a duplicate if Option.PreferCanonical is set and
+// the canonical URL of r is not itself. The canonical URL is enqueued with
+// the same depth as r.
+func (h *handler) canonicalize(r *Response, depth int) error {
+	if !h.cw.opt.PreferCanonical || r.Canonical == nil {
+		return nil
+	}
+	if c := r.Canonical.String(); c == r.URL.String() || c == r.NewURL.String() {
+		return nil
+	}
+	// If the canonical URL has been collapsed itself, e.g., into r, the
+	// page is kept so that at least one of them survives.
+	var collapsed bool
+	if ok, err := h.cw.store.Exist(r.Canonical); err != nil {
+		return err
+	} else if ok {
+		if err = h.cw.store.GetFunc(r.Canonical, func(u *URL) {
+			collapsed = u.Duplicate
+		}); err != nil {
+			return err
+		}
+	}
+	if collapsed {
+		return nil
+	}
+	if err := h.cw.store.UpdateFunc(r.URL, func(u *URL) {
+		u.Duplicate = true
+	}); err != nil {
+		return err
+	}
+	r.duplicate = true
+	u := *r.Canonical
+	link := &Link{
+		URL:  &u,
+		Tag:  "link",
+		Attr: "href",
+		Rel:  []string{"canonical"},
+	}
+	if ok, err := h.filter(r, link, depth); err != nil {
+		return err
+	} else if ok {
+		r.links = append(r.links, link)
+	}
+	return nil
+}
+
+// filter reports whether link is a new URL accepted by controller. It's
+// stored with depth if it's new.
+func (h *handler) filter(r *Response, link *Link, depth int) (bool, error) {
+	u := link.URL
+	if !AcceptLink(h.cw.ctrl, r, link) {
 		return false, nil
 	}
 	if ok, err := h.cw.store.Exist(u); err != nil {
@@ -107,28 +174,49 @@ func (h *handler) filter(r *Response, u *url.URL, depth int) (bool, error) {
 	// New link
 	if ok, err := h.cw.store.PutNX(&URL{
 		URL:   *u,
-		Depth: depth + 1,
+		Depth: depth,
 	}); err != nil || !ok {
 		return false, err
 	}
 	return true, nil
 }
 
+// ExtractHref sends URLs of all <a href> in the HTML document to ch.
 func ExtractHref(base *url.URL, reader io.Reader, ch chan<- *url.URL) error {
+	return extractHref(base, reader, ch, false)
+}
+
+// ExtractFollowHref is like ExtractHref, but skips links whose rel
+// attribute contains nofollow, ugc or sponsored.
+func ExtractFollowHref(base *url.URL, reader io.Reader, ch chan<- *url.URL) error {
+	return extractHref(base, reader, ch, true)
+}
+
+func extractHref(
+	base *url.URL, reader io.Reader, ch chan<- *url.URL, skipNoFollow bool,
+) error {
 	z := html.NewTokenizer(reader)
 	f := func(z *html.Tokenizer, base *url.URL) *url.URL {
-		for {
-			key, val, more := z.TagAttr()
-			if bytes.Equal(key, []byte("href")) {
-				if u, err := urlx.ParseRef(base, string(val)); err == nil {
-					return u
-				}
-				break
-			}
-			if !more {
-				break
+		var (
+			href []byte
+			rel  string
+		)
+		for more := true; more; {
+			var key, val []byte
+			key, val, more = z.TagAttr()
+			switch {
+			case href == nil && bytes.Equal(key, []byte("href")):
+				href = val
+			case skipNoFollow && bytes.Equal(key, []byte("rel")):
+				rel = string(val)
 			}
 		}
+		if href == nil || (skipNoFollow && IsNoFollow(rel)) {
+			return nil
+		}
+		if u, err := urlx.ParseRef(base, string(href)); err == nil {
+			return u
+		}
 		return nil
 	}
 LOOP:
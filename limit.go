@@ -0,0 +1,110 @@
+package crawler
+
+import (
+	"io"
+	"time"
+)
+
+// LimitError is returned when a response exceeds the maximum body size or
+// download time and truncation is disabled. It's not retryable.
+type LimitError string
+
+func (e LimitError) Error() string { return string(e) }
+
+var (
+	ErrBodyTooLarge = LimitError("response body exceeds the maximum size")
+	ErrFetchTimeout = LimitError("response body exceeds the maximum download time")
+)
+
+// limitedBody enforces the limits of a request on the body of its
+// response.
+type limitedBody struct {
+	r        *Response
+	body     io.Reader
+	n, max   int64
+	deadline time.Time
+	timer    *time.Timer
+	truncate bool
+	err      error
+}
+
+// limitBody applies the limits of req to r. The time spent on making the
+// request, which started at start, is included in the download time. If
+// truncation is disabled, a response whose Content-Length exceeds the
+// maximum size is rejected without reading the body.
+func (r *Response) limitBody(req *Request, start time.Time) error {
+	if req.MaxBodySize <= 0 && req.MaxFetchTime <= 0 {
+		return nil
+	}
+	if !req.TruncateBody && req.MaxBodySize > 0 &&
+		r.ContentLength > req.MaxBodySize {
+		return ErrBodyTooLarge
+	}
+	l := &limitedBody{
+		r:        r,
+		body:     r.Body,
+		max:      req.MaxBodySize,
+		truncate: req.TruncateBody,
+	}
+	if req.MaxFetchTime > 0 {
+		l.deadline = start.Add(req.MaxFetchTime)
+		// Closing the body interrupts a blocking read.
+		if hr := r.Response; hr != nil && hr.Body != nil {
+			l.timer = time.AfterFunc(l.deadline.Sub(time.Now()), func() {
+				hr.Body.Close()
+			})
+		}
+	}
+	r.Body, r.limit = l, l
+	return nil
+}
+
+func (l *limitedBody) expired() bool {
+	return !l.deadline.IsZero() && !time.Now().Before(l.deadline)
+}
+
+func (l *limitedBody) Read(p []byte) (n int, err error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if l.expired() {
+		return 0, l.exceed(ErrFetchTimeout)
+	}
+	// Read one more byte to find out whether the body is too large.
+	if l.max > 0 && int64(len(p)) > l.max-l.n+1 {
+		p = p[:l.max-l.n+1]
+	}
+	n, err = l.body.Read(p)
+	l.n += int64(n)
+	switch {
+	case l.max > 0 && l.n > l.max:
+		n -= int(l.n - l.max)
+		l.n = l.max
+		return n, l.exceed(ErrBodyTooLarge)
+	case err != nil && err != io.EOF && l.expired():
+		return n, l.exceed(ErrFetchTimeout)
+	case err != nil:
+		l.err = err
+		l.stop()
+	}
+	return
+}
+
+// exceed discards the rest of the body. It returns io.EOF if the body is
+// truncated, or err otherwise.
+func (l *limitedBody) exceed(err error) error {
+	l.stop()
+	l.r.bodyCloser.Close()
+	if l.truncate {
+		l.r.Truncated = true
+		err = io.EOF
+	}
+	l.err = err
+	return err
+}
+
+func (l *limitedBody) stop() {
+	if l.timer != nil {
+		l.timer.Stop()
+	}
+}
@@ -0,0 +1,249 @@
+package crawler
+
+import (
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/fanyang01/crawler/urlx"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Link is a link found in a page with its context. Tag and Attr are empty
+// for links not found in the document, e.g., redirections.
+type Link struct {
+	URL      *url.URL
+	Text     string   // anchor text with spaces collapsed
+	Tag      string   // tag of origin, e.g., "a"
+	Attr     string   // attribute of origin, e.g., "href"
+	Rel      []string // lowercased relation types
+	Hreflang string
+	Title    string
+	Pos      int // position among links extracted from the page
+}
+
+// HasRel reports whether rel is one of the relation types of the link.
+func (l *Link) HasRel(rel string) bool { return hasRel(l.Rel, rel) }
+
+func hasRel(rels []string, rel string) bool {
+	for _, r := range rels {
+		if r == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractLinks sends links of all <a href> and <area href> in the HTML
+// document to ch.
+func ExtractLinks(base *url.URL, reader io.Reader, ch chan<- *Link) error {
+	var (
+		z       = html.NewTokenizer(reader)
+		pending *Link // <a> waiting for its text
+		text    []string
+		alt     []string
+		pos     int
+	)
+	flush := func() {
+		if pending == nil {
+			return
+		}
+		words := text
+		if len(words) == 0 {
+			words = alt
+		}
+		pending.Text = strings.Join(words, " ")
+		ch <- pending
+		pending, text, alt = nil, text[:0], alt[:0]
+	}
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			flush()
+			if err := z.Err(); err != io.EOF {
+				return err
+			}
+			return nil
+		case html.TextToken:
+			if pending != nil {
+				text = append(text, strings.Fields(string(z.Text()))...)
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.A {
+				flush()
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			a := atom.Lookup(name)
+			if a == atom.A {
+				flush()
+			}
+			if !hasAttr {
+				continue
+			}
+			attrs := map[string]string{}
+			for more := true; more; {
+				var key, val []byte
+				key, val, more = z.TagAttr()
+				if _, ok := attrs[string(key)]; !ok {
+					attrs[string(key)] = string(val)
+				}
+			}
+			switch a {
+			case atom.Base:
+				if u, err := urlx.ParseRef(base, attrs["href"]); err == nil {
+					base = u
+				}
+				continue
+			case atom.Img:
+				if pending != nil {
+					alt = append(alt, strings.Fields(attrs["alt"])...)
+				}
+				continue
+			case atom.A, atom.Area:
+			default:
+				continue
+			}
+			href, ok := attrs["href"]
+			if !ok {
+				continue
+			}
+			u, err := urlx.ParseRef(base, strings.TrimSpace(href))
+			if err != nil {
+				continue
+			}
+			link := &Link{
+				URL:      u,
+				Tag:      a.String(),
+				Attr:     "href",
+				Rel:      strings.Fields(strings.ToLower(attrs["rel"])),
+				Hreflang: attrs["hreflang"],
+				Title:    attrs["title"],
+				Pos:      pos,
+			}
+			pos++
+			if a == atom.Area || tt == html.SelfClosingTagToken {
+				ch <- link
+			} else {
+				pending = link
+			}
+		}
+	}
+}
+
+// WebLink is a typed link found in a Link header(RFC 8288) or a <link>
+// element in <head>.
+type WebLink struct {
+	URL    *url.URL
+	Rel    []string // lowercased relation types
+	Params map[string]string
+}
+
+// HasRel reports whether rel is one of the relation types of the link.
+func (l *WebLink) HasRel(rel string) bool { return hasRel(l.Rel, rel) }
+
+// IsNoFollow reports whether the value of a rel attribute asks crawlers
+// not to follow the link, i.e., it contains nofollow, ugc or sponsored.
+func IsNoFollow(rel string) bool {
+	for _, r := range strings.Fields(strings.ToLower(rel)) {
+		switch r {
+		case "nofollow", "ugc", "sponsored":
+			return true
+		}
+	}
+	return false
+}
+
+// splitOutside splits s by sep, ignoring separators inside angle
+// brackets or double quotes.
+func splitOutside(s string, sep byte) (parts []string) {
+	var (
+		quoted, bracket bool
+		start           int
+	)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' && !bracket:
+			quoted = !quoted
+		case c == '\\' && quoted:
+			i++
+		case c == '<' && !quoted:
+			bracket = true
+		case c == '>' && !quoted:
+			bracket = false
+		case c == sep && !quoted && !bracket:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseLinkHeader parses the value of a Link header. References are
+// resolved against base. Malformed links are skipped.
+func parseLinkHeader(s string, base *url.URL) (links []WebLink) {
+	for _, v := range splitOutside(s, ',') {
+		params := splitOutside(v, ';')
+		ref := strings.TrimSpace(params[0])
+		if len(ref) < 2 || ref[0] != '<' || ref[len(ref)-1] != '>' {
+			continue
+		}
+		u, err := urlx.ParseRef(base, ref[1:len(ref)-1])
+		if err != nil {
+			continue
+		}
+		link := WebLink{URL: u, Params: make(map[string]string)}
+		for _, p := range params[1:] {
+			var key, val string
+			if i := strings.IndexByte(p, '='); i >= 0 {
+				key, val = p[:i], strings.TrimSpace(p[i+1:])
+				if n := len(val); n >= 2 && val[0] == '"' && val[n-1] == '"' {
+					val = strings.Replace(val[1:n-1], `\"`, `"`, -1)
+				}
+			} else {
+				key = p
+			}
+			key = strings.ToLower(strings.TrimSpace(key))
+			if key == "rel" {
+				// Only the first occurrence of rel is used.
+				if link.Rel == nil {
+					link.Rel = strings.Fields(strings.ToLower(val))
+				}
+				continue
+			}
+			link.Params[key] = val
+		}
+		links = append(links, link)
+	}
+	return
+}
+
+// initRelations sets Canonical, Next and Prev from WebLinks. Links found
+// earlier, i.e., those in Link headers, take precedence.
+func (r *Response) initRelations(normalize func(*url.URL) error) {
+	set := func(p **url.URL, u *url.URL) {
+		if *p != nil {
+			return
+		}
+		uu := *u
+		if err := normalize(&uu); err == nil {
+			*p = &uu
+		}
+	}
+	for i := range r.WebLinks {
+		link := &r.WebLinks[i]
+		for _, rel := range link.Rel {
+			switch rel {
+			case "canonical":
+				set(&r.Canonical, link.URL)
+			case "next":
+				set(&r.Next, link.URL)
+			case "prev", "previous":
+				set(&r.Prev, link.URL)
+			}
+		}
+	}
+}
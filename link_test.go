@@ -0,0 +1,236 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLinkHeader(t *testing.T) {
+	assert := assert.New(t)
+	base := mustParseURL("http://example.com/a/b")
+	links := parseLinkHeader(
+		`<http://example.com/c>; rel="canonical", </p?x=1,2>; rel="prev next"; title="a;b, \"c\""`+
+			`, <c>; REL=Alternate; hreflang=de, malformed; rel=next`,
+		base,
+	)
+	assert.Equal(3, len(links))
+	assert.Equal("http://example.com/c", links[0].URL.String())
+	assert.True(links[0].HasRel("canonical"))
+	assert.Equal("http://example.com/p?x=1,2", links[1].URL.String())
+	assert.Equal([]string{"prev", "next"}, links[1].Rel)
+	assert.Equal(`a;b, "c"`, links[1].Params["title"])
+	assert.Equal("http://example.com/a/c", links[2].URL.String())
+	assert.Equal([]string{"alternate"}, links[2].Rel)
+	assert.Equal("de", links[2].Params["hreflang"])
+}
+
+func TestIsNoFollow(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(IsNoFollow("nofollow"))
+	assert.True(IsNoFollow("external UGC"))
+	assert.True(IsNoFollow("sponsored noopener"))
+	assert.False(IsNoFollow("noopener noreferrer"))
+	assert.False(IsNoFollow(""))
+}
+
+func TestExtractFollowHref(t *testing.T) {
+	assert := assert.New(t)
+	const page = `<a href="/a">a</a><a rel="nofollow" href="/b">b</a>
+<a href="/c" rel="ugc">c</a><a rel="noopener" href="/d">d</a>`
+	base := mustParseURL("http://example.com/")
+	extract := func(f func(*url.URL, io.Reader, chan<- *url.URL) error) (paths []string) {
+		ch := make(chan *url.URL, 10)
+		assert.NoError(f(base, strings.NewReader(page), ch))
+		close(ch)
+		for u := range ch {
+			paths = append(paths, u.Path)
+		}
+		return
+	}
+	assert.Equal([]string{"/a", "/b", "/c", "/d"}, extract(ExtractHref))
+	assert.Equal([]string{"/a", "/d"}, extract(ExtractFollowHref))
+}
+
+type canonicalController struct {
+	NopController
+	mu  sync.Mutex
+	res map[string]*Response
+}
+
+func (c *canonicalController) Handle(r *Response, ch chan<- *url.URL) {
+	c.mu.Lock()
+	c.res[r.URL.Path] = &Response{
+		Canonical: r.Canonical,
+		Next:      r.Next,
+		Prev:      r.Prev,
+	}
+	c.mu.Unlock()
+	ExtractHref(r.NewURL, r.Body, ch)
+}
+
+func TestCanonical(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		mu      sync.Mutex
+		visited = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/page?sid=1">a</a>`)
+		case "/page":
+			w.Header().Set("Link", `</page?n=2>; rel="next"`)
+			fmt.Fprint(w, `<html><head><link rel="canonical" href="/page"></head>
+<body><a href="/other">x</a></body></html>`)
+		default:
+			fmt.Fprint(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := &canonicalController{res: map[string]*Response{}}
+	opt := *DefaultOption
+	opt.PreferCanonical = true
+	cw := New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+
+	// Links in /page?sid=1 are discarded, /page is fetched instead.
+	assert.Equal(map[string]int{
+		"/":      1,
+		"/page":  2,
+		"/other": 1,
+	}, visited)
+	r := ctrl.res["/page"]
+	assert.Equal(ts.URL+"/page", r.Canonical.String())
+	assert.Equal(ts.URL+"/page?n=2", r.Next.String())
+	assert.Nil(r.Prev)
+}
+
+func TestMutualCanonical(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		visited = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		case "/a":
+			fmt.Fprint(w, `<link rel="canonical" href="/b"><a href="/x">x</a>`)
+		case "/b":
+			fmt.Fprint(w, `<link rel="canonical" href="/a"><a href="/y">y</a>`)
+		default:
+			fmt.Fprint(w, `<html></html>`)
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := &canonicalController{res: map[string]*Response{}}
+	opt := *DefaultOption
+	opt.PreferCanonical = true
+	cw := New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(t, cw.Crawl(ts.URL+"/"))
+	cw.Wait()
+
+	// /a is collapsed into /b, which is kept although it points back.
+	assert.Equal(t, map[string]int{
+		"/":  1,
+		"/a": 1,
+		"/b": 1,
+		"/y": 1,
+	}, visited)
+}
+
+func TestExtractLinks(t *testing.T) {
+	assert := assert.New(t)
+	const page = `<html><head><base href="http://example.com/dir/"></head><body>
+<p>Read <a href="a.html" title="A" rel="Next NoFollow">the
+	<b>first</b>   page</a> now.</p>
+<a href="/img"><img src="x.png" alt="An image"></a>
+<map><area href="/area" hreflang="de"></map>
+<a name="anchor">no href</a>
+<a href="/unclosed">unclosed
+</body></html>`
+	ch := make(chan *Link, 10)
+	assert.NoError(ExtractLinks(mustParseURL("http://example.com/"), strings.NewReader(page), ch))
+	close(ch)
+	var links []*Link
+	for link := range ch {
+		links = append(links, link)
+	}
+	assert.Equal(4, len(links))
+
+	assert.Equal(&Link{
+		URL:   mustParseURL("http://example.com/dir/a.html"),
+		Text:  "the first page",
+		Tag:   "a",
+		Attr:  "href",
+		Rel:   []string{"next", "nofollow"},
+		Title: "A",
+		Pos:   0,
+	}, links[0])
+	assert.Equal("An image", links[1].Text)
+	assert.Equal("area", links[2].Tag)
+	assert.Equal("de", links[2].Hreflang)
+	assert.Equal(2, links[2].Pos)
+	assert.Equal("unclosed", links[3].Text)
+	assert.True(links[0].HasRel("nofollow"))
+}
+
+type linkController struct {
+	NopController
+	mu    sync.Mutex
+	texts map[string]string
+}
+
+func (c *linkController) HandleLink(r *Response, ch chan<- *Link) {
+	ExtractLinks(r.NewURL, r.Body, ch)
+}
+
+func (c *linkController) AcceptLink(r *Response, link *Link) bool {
+	return !link.HasRel("nofollow")
+}
+
+func (c *linkController) SchedLink(r *Response, link *Link) Ticket {
+	c.mu.Lock()
+	c.texts[link.URL.Path] = link.Text
+	c.mu.Unlock()
+	return Ticket{}
+}
+
+func TestLinkController(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">Page A</a><a href="/b" rel="nofollow">B</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := &linkController{texts: map[string]string{}}
+	cw := New(&Config{Controller: ctrl})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+	assert.Equal(map[string]string{
+		"/":  "",
+		"/a": "Page A",
+	}, ctrl.texts)
+}
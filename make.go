@@ -2,7 +2,11 @@ package crawler
 
 import (
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
+
+	"golang.org/x/net/context"
 )
 
 type maker struct {
@@ -25,10 +29,26 @@ func (cw *Crawler) newRequestMaker() *maker {
 }
 
 func (m *maker) newRequest(ctx *Context) (req *Request, err error) {
-	req = &Request{ctx: ctx}
+	opt := m.cw.opt
+	req = &Request{
+		ctx:           ctx,
+		MaxBodySize:   opt.MaxBodySize,
+		MaxFetchTime:  opt.MaxFetchTime,
+		TruncateBody:  opt.TruncateBody,
+		HostBandwidth: opt.HostBandwidth,
+		bandwidth:     m.cw.bandwidth,
+	}
 	if req.Request, err = http.NewRequest("GET", ctx.url.String(), nil); err != nil {
 		return nil, err
 	}
+	req.Header.Set("Accept-Encoding", AcceptEncoding)
+	// Revalidate with the validators of the last visit, which survive
+	// restarts if the store is persistent.
+	if err = m.cw.store.GetFunc(ctx.url, func(u *URL) {
+		req.stored = u.setConditional(req.Request)
+	}); err != nil {
+		return nil, err
+	}
 	m.cw.ctrl.Prepare(req)
 	if err = req.ctx.err; err != nil {
 		return nil, err
@@ -36,11 +56,68 @@ func (m *maker) newRequest(ctx *Context) (req *Request, err error) {
 
 	req.Method = strings.ToUpper(req.Method)
 	if req.Client == nil {
-		req.Client = DefaultClient
+		req.Client = m.cw.client
+	}
+	if a, ok := m.cw.ctrl.(ResponseAccepter); ok && opt.Probe && needProbe(req) {
+		m.probe(req, a)
 	}
 	return
 }
 
+// probe decides by the response of a probe whether req is made. If the
+// probe fails, the request is made anyway. If the controller rejects the
+// response, the URL is rescheduled by Controller.Resched, e.g., to check
+// content rejected by its date again later, or completed if it's done. A
+// URL rescheduled without time is delayed by the interval of the host, or
+// by the retry delay if there is no interval, rather than probed again at
+// once. If
+// requests to the host are spaced, the probe counts as a request, and the
+// accepted request is made as a new item of the queue.
+func (m *maker) probe(req *Request, a ResponseAccepter) {
+	r, err := probe(req)
+	if err != nil {
+		m.logger.Info("probe failed", "url", req.URL, "err", err)
+		return
+	}
+	defer r.free()
+	r.ctx = req.ctx
+	r.detectContentType()
+	if !a.AcceptResponse(r) {
+		if done, t := m.cw.ctrl.Resched(r); done {
+			req.Cancel()
+		} else {
+			if t.At.IsZero() {
+				d := m.cw.Interval(req.URL.Host)
+				if d <= 0 {
+					d, _ = m.cw.ctrl.Retry(req.ctx)
+				}
+				t.At = time.Now().Add(d)
+			}
+			req.Skip(t)
+		}
+		return
+	}
+	if m.cw.scheduler.spaced(req.URL.Host) {
+		c := req.ctx.C
+		if c == nil {
+			c = context.Background()
+		}
+		req.Skip(Ticket{
+			At:  time.Now(),
+			Ctx: context.WithValue(c, probedKey{}, true),
+		})
+	}
+}
+
+// allow checks u against robots.txt if Option.ObeyRobots is set. See
+// robotsCache.Check.
+func (m *maker) allow(u *url.URL) (ok bool, retry time.Time) {
+	if !m.cw.opt.ObeyRobots {
+		return true, time.Time{}
+	}
+	return m.cw.robots.Check(u)
+}
+
 func (m *maker) cleanup() { close(m.Out) }
 
 func (m *maker) work() {
@@ -53,12 +130,25 @@ func (m *maker) work() {
 			req       *Request
 			err       error
 		)
-		if req, err = m.newRequest(ctx); err != nil {
+		if ok, retry := m.allow(ctx.url); !ok {
+			out, cancelOut = nil, m.CancelOut
+			if !retry.IsZero() {
+				// Not disallowed, so the URL is visited later.
+				ctx.skip = &Ticket{At: retry}
+				logger.Info("robots.txt unreachable", "retry", retry)
+			} else {
+				logger.Info("disallowed by robots.txt")
+			}
+		} else if req, err = m.newRequest(ctx); err != nil {
 			out, errOut = nil, m.ErrOut
 			logger.Error("make request", "err", err)
 		} else if req.cancel {
 			out, cancelOut = nil, m.CancelOut
-			logger.Info("request canceled")
+			if ctx.skip != nil {
+				logger.Info("request skipped", "next", ctx.skip.At)
+			} else {
+				logger.Info("request canceled")
+			}
 		}
 		select {
 		case out <- req:
@@ -127,6 +127,7 @@ const (
 	muxINTERVAL
 	muxFREQ
 	muxDEPTH
+	muxBANDWIDTH
 	muxLEN
 
 	reqSTATIC = iota
@@ -207,6 +208,12 @@ func (mux *Mux) SetHostInterval(pattern string, d time.Duration) {
 	mux.matcher[muxINTERVAL].Add(pattern, d)
 }
 
+// SetHostBandwidth limits the bytes per second read from the host of urls
+// matching pattern, overriding Option.HostBandwidth.
+func (mux *Mux) SetHostBandwidth(pattern string, n int) {
+	mux.matcher[muxBANDWIDTH].Add(pattern, n)
+}
+
 // Dynamic tells crawler that a url corresponds to a dynamic page.
 func (mux *Mux) Dynamic(pattern string) {
 	mux.matcher[muxREQTYPE].Add(pattern, reqBROWSER)
@@ -248,6 +255,9 @@ func (mux *Mux) Prepare(req *crawler.Request) {
 			// TODO
 		}
 	}
+	if n, ok := mux.matcher[muxBANDWIDTH].Get(url); ok {
+		req.HostBandwidth = n.(int)
+	}
 	if f, ok := mux.matcher[muxPREPARE].Get(url); ok {
 		f.(Preparer).Prepare(req)
 	}
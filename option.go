@@ -1,6 +1,11 @@
 package crawler
 
-import "time"
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/fanyang01/crawler/dnscache"
+)
 
 const (
 	browserAgant = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/46.0.2490.71 Safari/537.36"
@@ -15,6 +20,56 @@ type Option struct {
 	NWorker        struct {
 		Maker, Fetcher, Handler, Scheduler int
 	}
+
+	// ObeyRobots enables robots.txt compliance, which is off by default.
+	// Disallowed URLs are rejected before requests are made, and URLs of
+	// sites whose robots.txt is unreachable are delayed until it can be
+	// fetched. Fetched robots.txt files are cached for RobotsTTL.
+	// Zero means 24 hours.
+	ObeyRobots bool
+	RobotsTTL  time.Duration
+	// SitemapDiscovery enables seeding from sitemaps. For each newly seen
+	// site, sitemaps listed in robots.txt and /sitemap.xml are walked in
+	// background, and URLs of the site in them are enqueued. The rules of
+	// robots.txt are not applied unless ObeyRobots is set.
+	SitemapDiscovery bool
+	// PreferCanonical collapses a page whose canonical URL differs from
+	// itself into the canonical URL: the canonical URL is enqueued
+	// instead of the links in the page, and the page will not be
+	// revisited. A page whose canonical URL has been collapsed itself is
+	// kept, so pages naming each other are not all dropped.
+	PreferCanonical bool
+	// MaxBodySize limits the size of response bodies. If TruncateBody is
+	// true, a larger body is cut off and Response.Truncated is set.
+	// Otherwise, reading the body fails with ErrBodyTooLarge, and a
+	// response whose Content-Length is larger is rejected before reading
+	// the body. MaxFetchTime limits the time from making a request to
+	// reading the end of the body in the same way, failing with
+	// ErrFetchTimeout. Zero means no limit. They can be overridden for
+	// each request by Controller.Prepare.
+	MaxBodySize  int64
+	MaxFetchTime time.Duration
+	TruncateBody bool
+	// Resolver, if not nil, looks up the hosts of newly queued URLs in
+	// background, so that their addresses are cached when requests are
+	// made. It should be the resolver used by the transport.
+	Resolver *dnscache.Resolver
+	// Bandwidth limits the number of bytes of response bodies read per
+	// second in total, and HostBandwidth limits that of each host. Bytes
+	// are counted after decoding, so the traffic on the wire doesn't
+	// exceed the limits. Zero means no limit. HostBandwidth can be
+	// overridden for each request by Controller.Prepare. Set
+	// download.Downloader.Bandwidth to Crawler.Bandwidth to share the
+	// limits with downloads.
+	Bandwidth     int
+	HostBandwidth int
+	// Probe enables probing the header of a URL whose path has no
+	// extension or an unknown one before fetching the body, if the
+	// controller implements ResponseAccepter.
+	Probe bool
+	// TLS, if not nil, is the TLS configuration of the client created by
+	// crawler when Config.Client is nil. See TLSOptions.
+	TLS *tls.Config
 }
 
 var (
@@ -22,6 +77,8 @@ var (
 		UserAgent:  browserAgant,
 		RobotAgent: "gocrawler",
 		MinDelay:   10 * time.Second,
+		RobotsTTL:  defaultRobotsTTL,
+		Resolver:   DefaultResolver,
 		NWorker: struct {
 			Maker, Fetcher, Handler, Scheduler int
 		}{
@@ -0,0 +1,142 @@
+package crawler
+
+import (
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// probedKey marks the context of a request whose probe has been accepted.
+type probedKey struct{}
+
+// needProbe reports whether the type of the content of req can't be told
+// before the body is fetched, i.e., its path has no extension or an
+// unknown one. Conditional requests are not probed, since the content has been fetched
+// before, and neither are requests whose probe has been accepted.
+func needProbe(req *Request) bool {
+	if ctx := req.ctx; ctx != nil && ctx.C != nil {
+		if probed, _ := ctx.Value(probedKey{}).(bool); probed {
+			// Probe it again on later visits.
+			ctx.WithValue(probedKey{}, false)
+			return false
+		}
+	}
+	if req.Method != "GET" || req.cancel ||
+		req.Header.Get("If-None-Match") != "" ||
+		req.Header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return false
+	}
+	ext := path.Ext(req.URL.Path)
+	return ext == "" || mime.TypeByExtension(ext) == ""
+}
+
+// probeRequest returns a copy of req with method. The header is copied.
+func probeRequest(req *Request, method string) *Request {
+	hreq := new(http.Request)
+	*hreq = *req.Request
+	hreq.Method = method
+	hreq.Header = make(http.Header, len(req.Header))
+	for k, vv := range req.Header {
+		hreq.Header[k] = vv
+	}
+	preq := *req
+	preq.Request = hreq
+	return &preq
+}
+
+// probe makes a HEAD request for req, or a GET request of the first byte
+// if HEAD is not allowed. The returned response has an empty body.
+func probe(req *Request) (*Response, error) {
+	r, err := req.Client.Do(probeRequest(req, "HEAD"))
+	if code := statusCode(err); code == http.StatusMethodNotAllowed ||
+		code == http.StatusNotImplemented {
+		preq := probeRequest(req, "GET")
+		preq.Header.Set("Range", "bytes=0-0")
+		if r, err = req.Client.Do(preq); err != nil {
+			return nil, err
+		}
+		io.Copy(ioutil.Discard, io.LimitReader(r.Body, 1))
+		if r.StatusCode == http.StatusPartialContent {
+			r.ContentLength = rangeTotal(r.Header.Get("Content-Range"))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.bodyCloser.Close()
+	return r, nil
+}
+
+// statusCode returns the status of an error returned by StdClient, or 0
+// if err is not a ResponseStatusError.
+func statusCode(err error) int {
+	if re, ok := err.(RetryableError); ok {
+		err = re.Err
+	}
+	if code, ok := err.(ResponseStatusError); ok {
+		return int(code)
+	}
+	return 0
+}
+
+// rangeTotal returns the complete length in Content-Range, or -1 if it's
+// unknown.
+func rangeTotal(s string) int64 {
+	i := strings.LastIndexByte(s, '/')
+	if i < 0 {
+		return -1
+	}
+	n, err := strconv.ParseInt(s[i+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// ProbeFilter is a ResponseAccepter that rejects content by its header.
+// Responses without the header are accepted.
+type ProbeFilter struct {
+	// Types lists the accepted media types. A type like "text/*" matches
+	// all its subtypes. Empty Types accepts all types.
+	Types []string
+	// MaxLength, if positive, is the maximum Content-Length.
+	MaxLength int64
+	// ModifiedSince, if not zero, rejects content whose Last-Modified is
+	// before it.
+	ModifiedSince time.Time
+}
+
+// AcceptResponse implements ResponseAccepter.
+func (f *ProbeFilter) AcceptResponse(r *Response) bool {
+	if f.MaxLength > 0 && r.ContentLength > f.MaxLength {
+		return false
+	}
+	if !f.ModifiedSince.IsZero() {
+		if t, err := http.ParseTime(r.Header.Get("Last-Modified")); err == nil &&
+			t.Before(f.ModifiedSince) {
+			return false
+		}
+	}
+	if len(f.Types) == 0 || r.Header.Get("Content-Type") == "" {
+		return true
+	}
+	typ, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == typ || (strings.HasSuffix(t, "/*") &&
+			strings.HasPrefix(typ, t[:len(t)-1])) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package crawler
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type probeController struct {
+	NopController
+	ProbeFilter
+	mu      sync.Mutex
+	handled []string
+}
+
+func (c *probeController) Handle(r *Response, _ chan<- *url.URL) {
+	c.mu.Lock()
+	c.handled = append(c.handled, r.URL.Path)
+	c.mu.Unlock()
+}
+
+func TestProbe(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Range"))
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/page.xview", "/index.html", "/about":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<p>hello</p>"))
+		case "/video.xstream", "/download":
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Write(make([]byte, 1000))
+		case "/archive.xdl":
+			if r.Method == "HEAD" {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(make([]byte, 1<<20)))
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := &probeController{ProbeFilter: ProbeFilter{
+		Types:     []string{"text/*"},
+		MaxLength: 1 << 10,
+	}}
+	opt := *DefaultOption
+	opt.ObeyRobots = false
+	opt.Probe = true
+	cw := New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(t, cw.Crawl(
+		ts.URL+"/page.xview", ts.URL+"/video.xstream", ts.URL+"/archive.xdl",
+		ts.URL+"/index.html", ts.URL+"/about", ts.URL+"/download?id=3",
+	))
+	cw.Wait()
+
+	sort.Strings(ctrl.handled)
+	assert.Equal(t, []string{"/about", "/index.html", "/page.xview"}, ctrl.handled)
+	for _, req := range requests {
+		if strings.HasPrefix(req, "GET ") && !strings.HasSuffix(req, "bytes=0-0") {
+			assert.Contains(t, []string{
+				"GET /page.xview ", "GET /index.html ", "GET /about ",
+			}, req)
+		}
+	}
+	assert.Contains(t, requests, "HEAD /page.xview ")
+	assert.Contains(t, requests, "HEAD /video.xstream ")
+	assert.Contains(t, requests, "GET /archive.xdl bytes=0-0")
+	assert.Contains(t, requests, "HEAD /about ")
+	assert.Contains(t, requests, "HEAD /download ")
+	assert.NotContains(t, requests, "HEAD /index.html ")
+}
+
+// reprobeController rejects old content and checks it again once. The
+// requests to a host are spaced by interval.
+type reprobeController struct {
+	probeController
+	interval time.Duration
+	mu       sync.Mutex
+	rescheds int
+}
+
+func (c *reprobeController) Interval(host string) time.Duration { return c.interval }
+
+func (c *reprobeController) Resched(r *Response) (bool, Ticket) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rescheds++
+	return c.rescheds > 1, Ticket{}
+}
+
+func TestProbeSchedule(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		mu       sync.Mutex
+		requests []string
+		times    []time.Time
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		times = append(times, time.Now())
+		mu.Unlock()
+		if r.URL.Path == "/old.xdl" {
+			w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	ctrl := &reprobeController{
+		probeController: probeController{ProbeFilter: ProbeFilter{
+			ModifiedSince: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		interval: 200 * time.Millisecond,
+	}
+	opt := *DefaultOption
+	opt.Probe = true
+	opt.MinDelay = 0
+	cw := New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(cw.Crawl(ts.URL + "/old.xdl"))
+	cw.Wait()
+	// The rejected URL is rescheduled rather than completed, and it's
+	// delayed by the interval since no time is given by Resched.
+	assert.Equal([]string{"HEAD /old.xdl", "HEAD /old.xdl"}, requests)
+	if len(times) == 2 {
+		assert.True(times[1].Sub(times[0]) >= ctrl.interval)
+	}
+	assert.Empty(ctrl.handled)
+
+	// The probe counts against the interval of the host.
+	mu.Lock()
+	requests, times = nil, nil
+	mu.Unlock()
+	cw = New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(cw.Crawl(ts.URL + "/new.xdl"))
+	cw.Wait()
+	assert.Equal([]string{"HEAD /new.xdl", "GET /new.xdl"}, requests)
+	if len(times) == 2 {
+		assert.True(times[1].Sub(times[0]) >= ctrl.interval)
+	}
+	assert.Equal([]string{"/new.xdl"}, ctrl.handled)
+}
+
+func TestProbeFilter(t *testing.T) {
+	assert := assert.New(t)
+	f := &ProbeFilter{
+		Types:         []string{"text/html", "image/*"},
+		MaxLength:     100,
+		ModifiedSince: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	accept := func(length int64, kv ...string) bool {
+		r := &Response{Response: &http.Response{
+			Header:        http.Header{},
+			ContentLength: length,
+		}}
+		for i := 0; i < len(kv); i += 2 {
+			r.Header.Set(kv[i], kv[i+1])
+		}
+		return f.AcceptResponse(r)
+	}
+	assert.True(accept(-1))
+	assert.True(accept(10, "Content-Type", "text/html; charset=utf-8"))
+	assert.True(accept(10, "Content-Type", "image/png"))
+	assert.False(accept(10, "Content-Type", "application/zip"))
+	assert.False(accept(1000, "Content-Type", "text/html"))
+	assert.False(accept(-1, "Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT"))
+	assert.True(accept(-1, "Last-Modified", "Mon, 02 Jan 2023 15:04:05 GMT"))
+}
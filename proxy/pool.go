@@ -0,0 +1,377 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/cache"
+)
+
+// ErrNoProxy is returned when all proxies in a pool are quarantined.
+var ErrNoProxy = errors.New("proxy: no available proxy")
+
+// Strategy decides which proxy is used for a request.
+type Strategy int
+
+// Strategies of selection.
+const (
+	RoundRobin Strategy = iota
+	Random
+	LeastFailures
+)
+
+// Proxy is a proxy in a pool.
+type Proxy struct {
+	Addr   string
+	Client *http.Client
+
+	std         *crawler.StdClient
+	requests    int // since admitted
+	blocked     int // responses of 403 or throttled since admitted
+	failures    int // consecutive failures
+	total       int // failures in total
+	quarantined bool
+	checking    bool
+	until       time.Time // end of quarantine
+}
+
+// Status is a snapshot of the state of a proxy.
+type Status struct {
+	Addr        string
+	Requests    int
+	Blocked     int
+	Failures    int
+	Quarantined bool
+}
+
+// Pool is a crawler.Client that makes requests through a set of proxies.
+// A proxy is quarantined after MaxFailures consecutive failures, or if
+// at least BlockRatio of at least MinSamples responses are 403 or of
+// class StatusThrottle in the status policy, e.g., 429.
+// After Quarantine, it's re-admitted if it passes the health check.
+type Pool struct {
+	Strategy Strategy
+	// Sticky returns the key of a request, e.g., StickyHost. Requests
+	// with the same key use the same proxy as long as it's available. If
+	// Sticky is nil or returns "", requests are not sticky.
+	Sticky func(req *crawler.Request) string
+
+	MaxFailures int
+	BlockRatio  float64
+	MinSamples  int
+	Quarantine  time.Duration
+	// Check checks whether a quarantined proxy works. If Check is nil,
+	// a proxy is re-admitted when its quarantine ends.
+	Check func(client *http.Client) error
+
+	cache   cache.Storage
+	tls     *tls.Config
+	policy  *crawler.StatusPolicy
+	mu      sync.Mutex
+	proxies []*Proxy
+	next    int
+	sticky  map[string]*Proxy
+	rand    *rand.Rand
+}
+
+// NewPool creates a pool of proxies. Responses are cached in storage if
+// it's not nil.
+func NewPool(addrs []string, storage cache.Storage) (*Pool, error) {
+	p := &Pool{
+		MaxFailures: 3,
+		BlockRatio:  0.5,
+		MinSamples:  10,
+		Quarantine:  5 * time.Minute,
+		cache:       storage,
+		sticky:      make(map[string]*Proxy),
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, addr := range addrs {
+		if err := p.Add(addr); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// SetTLSConfig sets the TLS configuration of connections to servers made
+// through the proxies, including those added later. It should be called
+// before the pool is used.
+func (p *Pool) SetTLSConfig(config *tls.Config) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tls = config
+	for _, px := range p.proxies {
+		px.Client.Transport.(*http.Transport).TLSClientConfig = config
+	}
+}
+
+// SetStatusPolicy sets the status policy of requests made through the
+// proxies, including those added later. Throttled statuses of the policy
+// count as blocked. It should be called before the pool is used.
+func (p *Pool) SetStatusPolicy(policy *crawler.StatusPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.policy = policy
+	for _, px := range p.proxies {
+		px.std.SetStatusPolicy(policy)
+	}
+}
+
+func (p *Pool) statusPolicy() *crawler.StatusPolicy {
+	if p.policy != nil {
+		return p.policy
+	}
+	return crawler.DefaultStatusPolicy
+}
+
+// Add adds a http/socks5 proxy to the pool.
+func (p *Pool) Add(addr string) error {
+	p.mu.Lock()
+	config := p.tls
+	p.mu.Unlock()
+	client, err := parseProxy(addr, config)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	std := crawler.NewStdClient(client, p.cache)
+	std.SetStatusPolicy(p.policy)
+	p.proxies = append(p.proxies, &Proxy{
+		Addr:   addr,
+		Client: client,
+		std:    std,
+	})
+	p.mu.Unlock()
+	return nil
+}
+
+// StickyHost makes requests to the same host use the same proxy.
+func StickyHost(req *crawler.Request) string { return req.URL.Host }
+
+// StickySession returns a function that makes requests in the same
+// session use the same proxy. The session of a request is the value of
+// key in its context.
+func StickySession(key interface{}) func(req *crawler.Request) string {
+	return func(req *crawler.Request) string {
+		ctx := req.Context()
+		if ctx == nil || ctx.C == nil {
+			return ""
+		}
+		s, _ := ctx.Value(key).(string)
+		return s
+	}
+}
+
+// HealthCheck returns a check that requests u and expects a 2xx status.
+func HealthCheck(u string) func(client *http.Client) error {
+	return func(client *http.Client) error {
+		resp, err := client.Get(u)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return crawler.ResponseStatusError(resp.StatusCode)
+		}
+		return nil
+	}
+}
+
+// Do implements crawler.Client.
+func (p *Pool) Do(req *crawler.Request) (*crawler.Response, error) {
+	px := p.pick(req)
+	if px == nil {
+		return nil, crawler.RetryableError{Err: ErrNoProxy}
+	}
+	r, err := px.std.Do(req)
+	p.report(px, r, err)
+	return r, err
+}
+
+// pick selects a proxy for req.
+func (p *Pool) pick(req *crawler.Request) *Proxy {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	var available []*Proxy
+	for _, px := range p.proxies {
+		if px.quarantined && !now.Before(px.until) {
+			p.readmit(px, now)
+		}
+		if !px.quarantined {
+			available = append(available, px)
+		}
+	}
+	if len(available) == 0 {
+		return nil
+	}
+
+	var key string
+	if p.Sticky != nil {
+		if key = p.Sticky(req); key != "" {
+			if px, ok := p.sticky[key]; ok && !px.quarantined {
+				return px
+			}
+		}
+	}
+	var px *Proxy
+	switch p.Strategy {
+	case Random:
+		px = available[p.rand.Intn(len(available))]
+	case LeastFailures:
+		for _, v := range available {
+			if px == nil || v.total < px.total ||
+				(v.total == px.total && v.requests < px.requests) {
+				px = v
+			}
+		}
+	default:
+		// The order of available proxies is stable, so count over all
+		// proxies to skip the quarantined ones.
+		for i := 0; i < len(p.proxies); i++ {
+			v := p.proxies[p.next%len(p.proxies)]
+			p.next++
+			if !v.quarantined {
+				px = v
+				break
+			}
+		}
+	}
+	if key != "" {
+		p.sticky[key] = px
+	}
+	return px
+}
+
+// readmit checks a proxy whose quarantine has ended. Without a check, it
+// is re-admitted immediately. Otherwise, it stays quarantined until the
+// check in background succeeds.
+func (p *Pool) readmit(px *Proxy, now time.Time) {
+	if p.Check == nil {
+		p.admit(px)
+		return
+	}
+	if px.checking {
+		return
+	}
+	px.checking = true
+	go func() {
+		err := p.Check(px.Client)
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		px.checking = false
+		if err != nil {
+			px.until = time.Now().Add(p.Quarantine)
+			return
+		}
+		p.admit(px)
+	}()
+}
+
+func (p *Pool) admit(px *Proxy) {
+	px.quarantined = false
+	px.requests, px.blocked, px.failures = 0, 0, 0
+}
+
+func (p *Pool) quarantine(px *Proxy) {
+	px.quarantined = true
+	px.until = time.Now().Add(p.Quarantine)
+	for k, v := range p.sticky {
+		if v == px {
+			delete(p.sticky, k)
+		}
+	}
+}
+
+// report updates the state of px with the result of a request.
+func (p *Pool) report(px *Proxy, r *crawler.Response, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	px.requests++
+	switch p.classify(r, err) {
+	case resultBlocked:
+		px.blocked++
+		px.failures = 0
+	case resultFailed:
+		px.failures++
+		px.total++
+	default:
+		px.failures = 0
+	}
+	if px.quarantined {
+		return
+	}
+	if p.MaxFailures > 0 && px.failures >= p.MaxFailures {
+		p.quarantine(px)
+	} else if px.requests >= p.MinSamples && p.BlockRatio > 0 &&
+		float64(px.blocked) >= p.BlockRatio*float64(px.requests) {
+		p.quarantine(px)
+	}
+}
+
+const (
+	resultOK = iota
+	resultBlocked
+	resultFailed
+)
+
+// classify tells whether the result of a request indicates the proxy is
+// blocked by the server or fails to work. Responses handled in spite of
+// their status, i.e., of class StatusHandle, are classified too.
+func (p *Pool) classify(r *crawler.Response, err error) int {
+	var status int
+	if err == nil {
+		if r == nil || r.Response == nil {
+			return resultOK
+		}
+		status = r.StatusCode
+	} else {
+		e := err
+		if re, ok := err.(crawler.RetryableError); ok {
+			e = re.Err
+		}
+		s, ok := e.(crawler.ResponseStatusError)
+		if !ok {
+			// Errors other than status are transport errors.
+			if _, retryable := err.(crawler.RetryableError); retryable {
+				return resultFailed
+			}
+			return resultOK
+		}
+		status = int(s)
+	}
+	switch {
+	case status == http.StatusForbidden ||
+		p.statusPolicy().Class(status) == crawler.StatusThrottle:
+		return resultBlocked
+	case status == http.StatusBadGateway || status == http.StatusGatewayTimeout ||
+		status == http.StatusProxyAuthRequired:
+		return resultFailed
+	}
+	return resultOK
+}
+
+// Status returns the states of proxies in the pool.
+func (p *Pool) Status() []Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := make([]Status, len(p.proxies))
+	for i, px := range p.proxies {
+		s[i] = Status{
+			Addr:        px.Addr,
+			Requests:    px.requests,
+			Blocked:     px.blocked,
+			Failures:    px.failures,
+			Quarantined: px.quarantined,
+		}
+	}
+	return s
+}
@@ -0,0 +1,162 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/stretchr/testify/assert"
+)
+
+// standIn is a HTTP proxy that answers requests itself.
+func standIn(name string, status *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s := atomic.LoadInt32(status); s != http.StatusOK {
+			w.WriteHeader(int(s))
+			return
+		}
+		fmt.Fprint(w, name)
+	}))
+}
+
+func get(p *Pool, u string) (string, error) {
+	hreq, _ := http.NewRequest("GET", u, nil)
+	r, err := p.Do(&crawler.Request{Request: hreq})
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	return string(b), err
+}
+
+func TestPool(t *testing.T) {
+	assert := assert.New(t)
+	var status [3]int32
+	var addrs []string
+	for i := range status {
+		status[i] = http.StatusOK
+		ts := standIn(fmt.Sprint(i), &status[i])
+		defer ts.Close()
+		addrs = append(addrs, ts.URL)
+	}
+	p, err := NewPool(addrs, nil)
+	assert.NoError(err)
+
+	// Round robin
+	for i := 0; i < 6; i++ {
+		s, err := get(p, "http://example.com/")
+		assert.NoError(err)
+		assert.Equal(fmt.Sprint(i%3), s)
+	}
+
+	// Sticky
+	p.Sticky = StickyHost
+	first, _ := get(p, "http://a.example.com/")
+	for i := 0; i < 3; i++ {
+		s, _ := get(p, "http://a.example.com/x")
+		assert.Equal(first, s)
+	}
+	other, _ := get(p, "http://b.example.com/")
+	assert.NotEqual(first, other)
+	p.Sticky = nil
+
+	// Proxy 1 is blocked.
+	atomic.StoreInt32(&status[1], http.StatusTooManyRequests)
+	p.MinSamples = 2
+	for i := 0; i < 12; i++ {
+		get(p, "http://example.com/")
+	}
+	assert.True(p.Status()[1].Quarantined)
+	for i := 0; i < 4; i++ {
+		s, err := get(p, "http://example.com/")
+		assert.NoError(err)
+		assert.NotEqual("1", s)
+	}
+
+	// Proxy 2 fails and all are quarantined.
+	p.MaxFailures = 1
+	atomic.StoreInt32(&status[0], http.StatusBadGateway)
+	atomic.StoreInt32(&status[2], http.StatusBadGateway)
+	for i := 0; i < 2; i++ {
+		get(p, "http://example.com/")
+	}
+	_, err = get(p, "http://example.com/")
+	assert.Equal(crawler.RetryableError{Err: ErrNoProxy}, err)
+
+	// Re-admitted after health check.
+	atomic.StoreInt32(&status[2], http.StatusOK)
+	check := make(chan string, 3)
+	p.Check = func(client *http.Client) error {
+		resp, err := client.Get("http://example.com/")
+		if err != nil {
+			return err
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		check <- string(b)
+		if resp.StatusCode != http.StatusOK {
+			return crawler.ResponseStatusError(resp.StatusCode)
+		}
+		return nil
+	}
+	p.mu.Lock()
+	for _, px := range p.proxies {
+		px.until = time.Now()
+	}
+	p.mu.Unlock()
+	get(p, "http://example.com/") // trigger checks
+	for i := 0; i < 3; i++ {
+		<-check
+	}
+	time.Sleep(10 * time.Millisecond)
+	s, err := get(p, "http://example.com/")
+	assert.NoError(err)
+	assert.Equal("2", s)
+	st := p.Status()
+	assert.True(st[0].Quarantined)
+	assert.True(st[1].Quarantined)
+	assert.False(st[2].Quarantined)
+}
+
+func TestLeastFailures(t *testing.T) {
+	assert := assert.New(t)
+	bad, good := int32(http.StatusBadGateway), int32(http.StatusOK)
+	ts0, ts1 := standIn("0", &bad), standIn("1", &good)
+	defer ts0.Close()
+	defer ts1.Close()
+	p, _ := NewPool([]string{ts0.URL, ts1.URL}, nil)
+	p.Strategy = LeastFailures
+	p.MaxFailures = 0
+	get(p, "http://example.com/")
+	for i := 0; i < 3; i++ {
+		s, err := get(p, "http://example.com/")
+		assert.NoError(err)
+		assert.Equal("1", s)
+	}
+}
+
+func TestPoolStatusPolicy(t *testing.T) {
+	assert := assert.New(t)
+	denied, good := int32(999), int32(http.StatusOK)
+	ts0, ts1 := standIn("0", &denied), standIn("1", &good)
+	defer ts0.Close()
+	defer ts1.Close()
+	p, _ := NewPool([]string{ts0.URL, ts1.URL}, nil)
+	p.MinSamples = 2
+	// 999 is a soft block, which is throttled by the policy.
+	p.SetStatusPolicy(&crawler.StatusPolicy{
+		Classes: map[int]crawler.StatusClass{999: crawler.StatusThrottle},
+	})
+	for i := 0; i < 4; i++ {
+		get(p, "http://example.com/")
+	}
+	st := p.Status()
+	assert.Equal(2, st[0].Blocked)
+	assert.True(st[0].Quarantined)
+	assert.False(st[1].Quarantined)
+}
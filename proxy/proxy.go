@@ -1,7 +1,9 @@
-// Package proxy provides http clients that use a http/socks5 proxy.
+// Package proxy provides http clients that use a http/socks5 proxy, and
+// a pool of proxies that rotates among them.
 package proxy
 
 import (
+	"crypto/tls"
 	"errors"
 	"net"
 	"net/http"
@@ -12,10 +14,16 @@ import (
 )
 
 func New(addr string) (*http.Client, error) {
-	return parseProxy(addr)
+	return parseProxy(addr, nil)
 }
 
-func parseProxy(addr string) (*http.Client, error) {
+// NewTLS is like New, but the client uses config for TLS connections to
+// servers, e.g., one made by crawler.TLSOptions.
+func NewTLS(addr string, config *tls.Config) (*http.Client, error) {
+	return parseProxy(addr, config)
+}
+
+func parseProxy(addr string, config *tls.Config) (*http.Client, error) {
 	u, err := url.Parse(addr)
 	if err != nil {
 		return nil, err
@@ -39,6 +47,7 @@ func parseProxy(addr string) (*http.Client, error) {
 		transport := &http.Transport{
 			Dial:                dialer.Dial,
 			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     config,
 		}
 		return &http.Client{
 			Transport: transport,
@@ -51,6 +60,7 @@ func parseProxy(addr string) (*http.Client, error) {
 				KeepAlive: 30 * time.Second,
 			}).Dial,
 			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     config,
 		}
 		return &http.Client{
 			Transport: transport,
@@ -104,6 +104,13 @@ type Interface interface {
 	Close() error
 }
 
+// Limiter is an optional interface implemented by host-based rate limit
+// queues. The crawler uses it to set the interval declared by a site,
+// e.g., the Crawl-delay in robots.txt.
+type Limiter interface {
+	SetInterval(host string, d time.Duration)
+}
+
 type channel struct {
 	Interface
 	quit chan struct{}
@@ -164,13 +171,22 @@ func (q *channel) Close() error {
 	return q.Interface.Close()
 }
 
+type limiterChannel struct {
+	*channel
+	Limiter
+}
+
 // WithChannel provides a wrapper for those who don't implement a Channel
-// method.
+// method. The wrapper implements Limiter if q does.
 func WithChannel(q Interface) WaitQueue {
-	return &channel{
+	c := &channel{
 		Interface: q,
 		quit:      make(chan struct{}),
 	}
+	if l, ok := q.(Limiter); ok {
+		return &limiterChannel{channel: c, Limiter: l}
+	}
+	return c
 }
 
 // Heap implements heap.Interface.
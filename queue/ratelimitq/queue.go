@@ -105,6 +105,7 @@ type RateLimitQueue struct {
 	// TODO: use a background goroutine to clean timewait periodically
 	timewait map[string]time.Time
 	interval func(string) time.Duration
+	declared map[string]time.Duration
 	err      error
 }
 
@@ -138,6 +139,7 @@ func New(opt *Option) *RateLimitQueue {
 		secondary: opt.Secondary,
 		interval:  opt.Limit,
 		timewait:  make(map[string]time.Time),
+		declared:  make(map[string]time.Duration),
 	}
 	q.popCond = sync.NewCond(&q.mu)
 	q.pushCond = sync.NewCond(&q.mu)
@@ -151,6 +153,34 @@ func maxTime(a, b time.Time) time.Time {
 	return b
 }
 
+// limit returns the larger one of Option.Limit(host) and the interval
+// declared by SetInterval.
+func (q *RateLimitQueue) limit(host string) time.Duration {
+	d := q.interval(host)
+	if declared := q.declared[host]; declared > d {
+		return declared
+	}
+	return d
+}
+
+// SetInterval implements queue.Limiter. The interval given by Option.Limit
+// takes precedence only when it is larger than d.
+func (q *RateLimitQueue) SetInterval(host string, d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if d <= 0 {
+		delete(q.declared, host)
+	} else {
+		q.declared[host] = d
+	}
+	if _, ok := q.primary.M[host]; ok {
+		if q.err = q.update(host, q.limit(host)); q.err == nil {
+			q.popCond.Signal()
+		}
+	}
+}
+
 func (q *RateLimitQueue) create(host string) {
 	if _, ok := q.primary.M[host]; ok {
 		return
@@ -194,7 +224,7 @@ func (q *RateLimitQueue) Push(item *queue.Item) error {
 	host := item.URL.Host
 	q.create(host)
 	q.secondary.Push(host, item)
-	if q.err = q.update(host, q.interval(host)); q.err != nil {
+	if q.err = q.update(host, q.limit(host)); q.err != nil {
 		return q.err
 	}
 	q.popCond.Signal()
@@ -228,7 +258,7 @@ WAIT:
 	if pi.Next.Before(now) {
 		var (
 			host     = pi.Host
-			interval = q.interval(host)
+			interval = q.limit(host)
 			len      int
 		)
 		if item, q.err = q.secondary.Pop(host); q.err != nil {
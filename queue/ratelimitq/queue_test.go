@@ -175,3 +175,33 @@ func TestRateLimit(t *testing.T) {
 	defer os.Remove(name)
 	testRateLimit(t, newDiskHeap(t, name, 3))
 }
+
+func TestSetInterval(t *testing.T) {
+	assert := assert.New(t)
+	f := func(host string) time.Duration {
+		if host == "b.example.com" {
+			return 50 * time.Millisecond
+		}
+		return 0
+	}
+	wq := New(&Option{MaxHosts: 100, Limit: f})
+	wq.SetInterval("a.example.com", 50*time.Millisecond)
+	// The stricter interval given by Limit takes precedence.
+	wq.SetInterval("b.example.com", 10*time.Millisecond)
+	assert.Equal(50*time.Millisecond, wq.limit("a.example.com"))
+	assert.Equal(50*time.Millisecond, wq.limit("b.example.com"))
+	wq.SetInterval("a.example.com", 0)
+	assert.Equal(time.Duration(0), wq.limit("a.example.com"))
+
+	now := time.Now()
+	wq.Push(&queue.Item{Next: now, URL: mustParseURL("http://a.example.com/1")})
+	wq.Push(&queue.Item{Next: now, URL: mustParseURL("http://a.example.com/2")})
+	wq.Pop()
+	wq.SetInterval("a.example.com", 50*time.Millisecond)
+	item, _ := wq.Pop()
+	assert.Equal("/2", item.URL.Path)
+	assert.True(time.Since(now) >= 50*time.Millisecond)
+
+	_, ok := NewWaitQueue(nil).(queue.Limiter)
+	assert.True(ok)
+}
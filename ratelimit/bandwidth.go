@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/time/rate"
+)
+
+// ErrClosed is returned by readers of a closed Bandwidth that have to wait.
+var ErrClosed = errors.New("ratelimit: bandwidth limiter closed")
+
+// maxHosts bounds the number of hosts whose limiters are kept.
+const maxHosts = 4096
+
+// Bandwidth limits the number of bytes read per second, in total and for
+// each host.
+type Bandwidth struct {
+	mu     sync.Mutex
+	global *rate.Limiter
+	hosts  map[string]*hostLimiter
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type hostLimiter struct {
+	*rate.Limiter
+	used time.Time
+}
+
+// NewBandwidth creates a bandwidth limiter. max is the total number of
+// bytes per second of all readers. Zero means no limit.
+func NewBandwidth(max int) *Bandwidth {
+	b := &Bandwidth{hosts: make(map[string]*hostLimiter)}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	if max > 0 {
+		b.global = rate.NewLimiter(rate.Limit(max), max)
+	}
+	return b
+}
+
+// Reader returns a reader that reads from r within the total limit and
+// the limit of host, which is max bytes per second. Readers of the same
+// host share the limit, which is updated by the latest reader whose max
+// is different. Zero max means no limit for host.
+func (b *Bandwidth) Reader(r io.Reader, host string, max int) io.Reader {
+	if b.global == nil && max <= 0 {
+		return r
+	}
+	return &reader{r: r, b: b, host: host, max: max}
+}
+
+// Close wakes up the readers waiting for the limits. They, and the later
+// reads that have to wait, return ErrClosed.
+func (b *Bandwidth) Close() { b.cancel() }
+
+func (b *Bandwidth) host(host string, max int) *rate.Limiter {
+	if max <= 0 {
+		return nil
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	h, ok := b.hosts[host]
+	if !ok {
+		if len(b.hosts) >= maxHosts {
+			b.evict(now)
+		}
+		// A burst of one second.
+		h = &hostLimiter{Limiter: rate.NewLimiter(rate.Limit(max), max)}
+		b.hosts[host] = h
+	} else if h.Burst() != max {
+		// Updated in place, so that the readers of the host keep
+		// sharing the tokens.
+		h.SetLimitAt(now, rate.Limit(max))
+		h.SetBurstAt(now, max)
+	}
+	h.used = now
+	return h.Limiter
+}
+
+// evict makes room for a new host. A limiter unused for its burst of one
+// second is full, so it's dropped without loss. b.mu is held.
+func (b *Bandwidth) evict(now time.Time) {
+	for host, h := range b.hosts {
+		if now.Sub(h.used) > time.Second {
+			delete(b.hosts, host)
+		}
+	}
+	for host := range b.hosts {
+		if len(b.hosts) < maxHosts {
+			break
+		}
+		delete(b.hosts, host)
+	}
+}
+
+type reader struct {
+	r    io.Reader
+	b    *Bandwidth
+	host string
+	max  int
+}
+
+func (r *reader) Read(p []byte) (n int, err error) {
+	limiters := [...]*rate.Limiter{r.b.global, r.b.host(r.host, r.max)}
+	// Read no more than the burst, so that WaitN can succeed.
+	for _, l := range limiters {
+		if l != nil && len(p) > l.Burst() {
+			p = p[:l.Burst()]
+		}
+	}
+	n, err = r.r.Read(p)
+	for _, l := range limiters {
+		if l != nil && wait(r.b.ctx, l, n) != nil && err == nil {
+			err = ErrClosed
+		}
+	}
+	return
+}
+
+// wait waits for n tokens of l until ctx is done. The burst may have been
+// lowered since the read, so the tokens are taken in bursts.
+func wait(ctx context.Context, l *rate.Limiter, n int) error {
+	for n > 0 {
+		k := n
+		if burst := l.Burst(); k > burst {
+			k = burst
+		}
+		if err := l.WaitN(ctx, k); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
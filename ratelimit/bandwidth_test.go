@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readAll(rs ...io.Reader) time.Duration {
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, r := range rs {
+		wg.Add(1)
+		go func(r io.Reader) {
+			defer wg.Done()
+			io.Copy(ioutil.Discard, r)
+		}(r)
+	}
+	wg.Wait()
+	return time.Since(start)
+}
+
+func TestBandwidth(t *testing.T) {
+	assert := assert.New(t)
+	data := func() io.Reader { return bytes.NewReader(make([]byte, 10000)) }
+
+	// The burst of one second is free, and the rest takes one second.
+	b := NewBandwidth(10000)
+	d := readAll(b.Reader(data(), "a", 0), b.Reader(data(), "b", 0))
+	assert.True(d > 900*time.Millisecond, d)
+
+	b = NewBandwidth(0)
+	r := data()
+	assert.True(r == b.Reader(r, "a", 0))
+	d = readAll(b.Reader(data(), "a", 10000), b.Reader(data(), "a", 10000))
+	assert.True(d > 900*time.Millisecond, d)
+	d = readAll(b.Reader(data(), "b", 20000), b.Reader(data(), "c", 20000))
+	assert.True(d < 500*time.Millisecond, d)
+}
+
+func TestBandwidthHosts(t *testing.T) {
+	assert := assert.New(t)
+	b := NewBandwidth(0)
+	l := b.host("a", 100)
+	// The limiter of a host is updated rather than replaced.
+	assert.True(l == b.host("a", 200))
+	assert.Equal(200, l.Burst())
+
+	for i := 0; i < maxHosts; i++ {
+		b.host(fmt.Sprint(i), 100)
+	}
+	assert.Equal(maxHosts, len(b.hosts))
+	for _, h := range b.hosts {
+		h.used = h.used.Add(-2 * time.Second)
+	}
+	b.host("b", 100)
+	b.host("a", 100)
+	assert.Equal(2, len(b.hosts))
+}
+
+func TestBandwidthClose(t *testing.T) {
+	assert := assert.New(t)
+	b := NewBandwidth(1000)
+	r := b.Reader(bytes.NewReader(make([]byte, 100000)), "a", 0)
+	time.AfterFunc(200*time.Millisecond, b.Close)
+	start := time.Now()
+	_, err := io.Copy(ioutil.Discard, r)
+	assert.Equal(ErrClosed, err)
+	assert.True(time.Since(start) < time.Second)
+}
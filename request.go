@@ -1,13 +1,38 @@
 package crawler
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+
+	"github.com/fanyang01/crawler/ratelimit"
+)
 
 // Request is a HTTP request to be made.
 type Request struct {
 	*http.Request
 	Client Client
+	// Limits of the response, which are initialized from Option. See
+	// Option.MaxBodySize and Option.MaxFetchTime.
+	MaxBodySize  int64
+	MaxFetchTime time.Duration
+	TruncateBody bool
+	// HostBandwidth is the limit of bytes per second of the host, which is
+	// initialized from Option.HostBandwidth. The host shares the limit of
+	// its latest request.
+	HostBandwidth int
+	// Session selects the cookie jar used by StdClient. Requests of
+	// different sessions don't share cookies or cached responses. See
+	// StdClient.SetSessions.
+	Session string
+
 	ctx    *Context
 	cancel bool
+	// stored is set if the validators in the header are added from the
+	// store rather than by the controller.
+	stored bool
+	// bandwidth, if not nil, limits the bodies read by StdClient in
+	// background.
+	bandwidth *ratelimit.Bandwidth
 }
 
 func (r *Request) Context() *Context {
@@ -35,4 +60,13 @@ func (r *Request) SetUserAgent(agent string) {
 	r.Header.Set("User-Agent", agent)
 }
 
+// Cancel cancels the request. The URL is completed and won't be visited
+// again.
 func (r *Request) Cancel() { r.cancel = true }
+
+// Skip cancels the request without completing the URL, which is visited
+// again as scheduled by t. Skipping doesn't count as a visit or a retry.
+func (r *Request) Skip(t Ticket) {
+	r.cancel = true
+	r.ctx.skip = &t
+}
@@ -2,12 +2,9 @@ package crawler
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
+	"crypto/x509"
 	"errors"
-	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"net/url"
 	"sync"
@@ -16,6 +13,7 @@ import (
 	"golang.org/x/text/encoding"
 
 	"github.com/fanyang01/crawler/cache"
+	"github.com/fanyang01/crawler/robots"
 )
 
 const (
@@ -33,6 +31,17 @@ type Response struct {
 	Timestamp time.Time
 
 	CacheControl *cache.Control
+	// NotModified is true if the server responded 304 to a conditional
+	// request made with the validators stored in URL, either directly or
+	// to revalidate the cached copy of the last visit. The body is empty
+	// and the content is unchanged since the last visit.
+	NotModified bool
+	// PeerCertificates, NegotiatedProtocol(ALPN, e.g., "h2") and
+	// TLSVersion describe the TLS connection of the response. They are
+	// empty for responses not made over TLS or served from cache.
+	PeerCertificates   []*x509.Certificate
+	NegotiatedProtocol string
+	TLSVersion         uint16
 
 	ContentLocation *url.URL
 	ContentType     string
@@ -41,17 +50,31 @@ type Response struct {
 		Seconds int
 		URL     *url.URL
 	}
+	// Robots holds the directives found in X-Robots-Tag headers and
+	// <meta name="robots"> tags.
+	Robots robots.Directives
+	// WebLinks are the links in Link headers and <link> elements in
+	// <head>. Canonical, Next and Prev are the normalized targets of the
+	// canonical, next and prev relations among them.
+	WebLinks   []WebLink
+	Canonical  *url.URL
+	Next, Prev *url.URL
 
 	bodyCloser io.ReadCloser
 	Body       io.Reader
 	BodyStatus int
+	// Truncated is true if the body has been cut off at the maximum size
+	// or download time of the request.
+	Truncated bool
 
 	Charset        string
 	CertainCharset bool
 	Encoding       encoding.Encoding
 
-	ctx   *Context
-	links []*url.URL
+	ctx       *Context
+	links     []*Link
+	duplicate bool // collapsed into the canonical URL
+	limit     *limitedBody
 }
 
 var (
@@ -68,6 +91,9 @@ func NewResponse() *Response {
 }
 
 func (r *Response) free() {
+	if r.limit != nil {
+		r.limit.stop()
+	}
 	links := r.links
 	if len(links) > perPage {
 		links = nil
@@ -82,6 +108,23 @@ func (r *Response) free() {
 
 func (r *Response) Context() *Context { return r.ctx }
 
+// NoFollow reports whether links in the page should not be followed, i.e.,
+// the page is marked as nofollow and Option.ObeyRobots is set. Redirect
+// and refresh targets are followed anyway.
+func (r *Response) NoFollow() bool {
+	return r.Robots.NoFollow && r.ctx != nil && r.ctx.cw.opt.ObeyRobots
+}
+
+// isRedirect reports whether u is the redirect or refresh target of r.
+func (r *Response) isRedirect(u *url.URL) bool {
+	s := u.String()
+	if s == r.URL.String() {
+		return false
+	}
+	return s == r.NewURL.String() ||
+		(r.Refresh.URL != nil && s == r.Refresh.URL.String())
+}
+
 type bodyReader struct {
 	err    error
 	rc     *io.ReadCloser
@@ -160,37 +203,12 @@ func (resp *Response) InitBody(body io.ReadCloser) {
 	}()
 
 	// Uncompress http compression
-	// We prefer Content-Encoding than Tranfer-Encoding
-	var encoding string
-	if encoding = resp.Header.Get("Content-Encoding"); encoding == "" {
-		if len(resp.TransferEncoding) == 0 {
-			encoding = "identity"
-		} else if len(resp.TransferEncoding) == 1 {
-			encoding = resp.TransferEncoding[0]
-		} else {
-			brc.err = fmt.Errorf("too many encodings: %v", resp.TransferEncoding)
-			return
-		}
-	}
-
-	switch encoding {
-	case "identity", "chunked":
-		// Do nothing
-	case "gzip":
-		// TODO: Normally gzip encoding is auto-decoded by http package,
-		// so this case may be needless.
-		r, err := gzip.NewReader(body)
-		if err != nil {
-			brc.err = err
-			return
-		}
-		brc.rc = ioutil.NopCloser(r)
-	case "deflate":
-		brc.rc = flate.NewReader(body)
-	default:
-		brc.err = fmt.Errorf("unsupported content encoding: %s", encoding)
+	rc, err := decode(body, contentCodings(resp.Response))
+	if err != nil {
+		brc.err = err
+	} else if rc != nil {
+		brc.rc = rc
 	}
-	return
 }
 
 func (resp *Response) preview(size int) ([]byte, error) {
@@ -198,7 +216,7 @@ func (resp *Response) preview(size int) ([]byte, error) {
 	preview := make([]byte, size)
 	n, err := io.ReadFull(r, preview)
 	switch {
-	case err == io.ErrUnexpectedEOF:
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
 		preview = preview[:n]
 		r = bytes.NewReader(preview)
 	case err != nil:
@@ -0,0 +1,180 @@
+// Package revisit provides a controller that schedules revisits according
+// to how often the content of a page changes.
+package revisit
+
+import (
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/fanyang01/crawler"
+)
+
+// DefaultMax is the maximum revisit interval used when Controller.Max is
+// zero.
+const DefaultMax = 7 * 24 * time.Hour
+
+// Controller wraps a crawler.Controller and sets the time of the next
+// visit of a page using the estimated change rate of the page. The content
+// hash and the history of changes of each URL are kept in the store as
+// crawler.URL.Changes, so they persist across restarts if the store does.
+//
+// Whether a URL should be revisited is still decided by the wrapped
+// controller: Controller only overrides Ticket.At when the wrapped
+// controller's Resched is not done.
+type Controller struct {
+	crawler.Forward
+	// Min and Max bound the revisit interval. If Max is zero, DefaultMax
+	// is used.
+	Min, Max time.Duration
+	// Initial is the revisit interval used before the page has been
+	// visited twice. If Initial is zero, Min is used.
+	Initial time.Duration
+}
+
+// New creates a controller that revisits pages in the range [min, max].
+func New(ctrl crawler.Controller, min, max time.Duration) *Controller {
+	if ctrl == nil {
+		ctrl = crawler.NopController{}
+	}
+	return &Controller{
+		Forward: crawler.Forward{Controller: ctrl},
+		Min:     min,
+		Max:     max,
+	}
+}
+
+// delayKey is the key of the delay computed by Handle in the context of
+// the response.
+type delayKey struct{}
+
+// Handle implements crawler.Controller. It computes the hash of the
+// response body while the wrapped controller is reading it. The unread
+// part of the body is consumed after the wrapped controller returns.
+// A response to a conditional request that is not modified is observed
+// as unchanged.
+func (c *Controller) Handle(r *crawler.Response, ch chan<- *url.URL) {
+	c.handle(r, func() { c.Controller.Handle(r, ch) })
+}
+
+// HandleLink implements crawler.LinkHandler. It's like Handle, but calls
+// crawler.HandleLink with the wrapped controller.
+func (c *Controller) HandleLink(r *crawler.Response, ch chan<- *crawler.Link) {
+	c.handle(r, func() { crawler.HandleLink(c.Controller, r, ch) })
+}
+
+func (c *Controller) handle(r *crawler.Response, handle func()) {
+	var observe func(*crawler.Changes)
+	if r.NotModified {
+		handle()
+		observe = func(ch *crawler.Changes) { ObserveUnchanged(ch, r.Timestamp) }
+	} else {
+		h := fnv.New64a()
+		tee := io.TeeReader(r.Body, h)
+		r.Body = tee
+		handle()
+		if _, err := io.Copy(ioutil.Discard, tee); err != nil {
+			return // incomplete content, no observation
+		}
+		observe = func(ch *crawler.Changes) { Observe(ch, r.Timestamp, h.Sum64()) }
+	}
+	ctx := r.Context()
+	if ctx == nil {
+		return
+	}
+	var changes crawler.Changes
+	if err := ctx.UpdateURL(func(u *crawler.URL) {
+		observe(&u.Changes)
+		changes = u.Changes
+	}); err != nil {
+		return
+	}
+	ctx.WithValue(delayKey{}, c.Delay(changes, r.Timestamp))
+}
+
+// Observe records in ch that the content hash was hash at time t.
+func Observe(ch *crawler.Changes, t time.Time, hash uint64) {
+	if ch.First.IsZero() {
+		*ch = crawler.Changes{Hash: hash, First: t}
+		return
+	}
+	if ch.Hash != hash {
+		ch.Changed++
+		ch.Hash = hash
+	}
+	ch.Count++
+}
+
+// ObserveUnchanged records in ch that the content has not changed at time
+// t. It does nothing if the content has not been observed.
+func ObserveUnchanged(ch *crawler.Changes, t time.Time) {
+	if !ch.First.IsZero() {
+		ch.Count++
+	}
+}
+
+// Rate returns the estimated number of changes per second of the content
+// observed until t. ok is false if it has not been observed at least
+// twice.
+func Rate(ch crawler.Changes, t time.Time) (rate float64, ok bool) {
+	if ch.Count < 1 || !t.After(ch.First) {
+		return 0, false
+	}
+	return estimate(ch.Count, ch.Changed, t.Sub(ch.First)), true
+}
+
+// estimate computes the change rate of a Poisson process observed n times
+// at an average interval of d/n, of which x times a change was detected.
+// See Cho and Garcia-Molina, "Estimating Frequency of Change", 2003.
+func estimate(n, x int, d time.Duration) float64 {
+	interval := d.Seconds() / float64(n)
+	return -math.Log((float64(n-x)+0.5)/(float64(n)+0.5)) / interval
+}
+
+func (c *Controller) max() time.Duration {
+	if c.Max > 0 {
+		return c.Max
+	}
+	return DefaultMax
+}
+
+// Delay returns the time to wait after t before the next visit of a page
+// whose history until t is ch.
+func (c *Controller) Delay(ch crawler.Changes, t time.Time) time.Duration {
+	rate, ok := Rate(ch, t)
+	switch {
+	case !ok:
+		if c.Initial > 0 {
+			return c.Initial
+		}
+		return c.Min
+	case rate <= 0:
+		return c.max()
+	}
+	d := time.Duration(float64(time.Second) / rate)
+	if d < c.Min {
+		d = c.Min
+	} else if d > c.max() {
+		d = c.max()
+	}
+	return d
+}
+
+// Resched implements crawler.Controller.
+func (c *Controller) Resched(r *crawler.Response) (done bool, t crawler.Ticket) {
+	if done, t = c.Controller.Resched(r); done {
+		return
+	}
+	var d time.Duration
+	if ctx := r.Context(); ctx != nil {
+		d, _ = ctx.Value(delayKey{}).(time.Duration)
+	}
+	if d == 0 {
+		d = c.Delay(crawler.Changes{}, r.Timestamp)
+	}
+	t.At = r.Timestamp.Add(d)
+	return
+}
@@ -0,0 +1,121 @@
+package revisit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ crawler.Controller       = &Controller{}
+	_ crawler.LinkHandler      = &Controller{}
+	_ crawler.LinkAccepter     = &Controller{}
+	_ crawler.LinkScheduler    = &Controller{}
+	_ crawler.SitemapReceiver  = &Controller{}
+	_ crawler.ResponseAccepter = &Controller{}
+)
+
+func TestDelay(t *testing.T) {
+	assert := assert.New(t)
+	c := New(nil, time.Minute, 24*time.Hour)
+	var (
+		hot, warm, static crawler.Changes
+		start             = time.Now()
+		end               = start.Add(9 * time.Hour)
+	)
+	assert.Equal(time.Minute, c.Delay(hot, start))
+
+	for i := 0; i < 10; i++ {
+		tm := start.Add(time.Duration(i) * time.Hour)
+		Observe(&hot, tm, uint64(i))
+		Observe(&warm, tm, uint64(i/3))
+		Observe(&static, tm, 0)
+	}
+	assert.Equal(9, hot.Count)
+	assert.Equal(9, hot.Changed)
+	assert.Equal(3, warm.Changed)
+	assert.Equal(0, static.Changed)
+	assert.True(c.Delay(hot, end) < c.Delay(warm, end))
+	assert.True(c.Delay(warm, end) < c.Delay(static, end))
+	assert.True(c.Delay(hot, end) >= time.Minute)
+	assert.Equal(24*time.Hour, c.Delay(static, end))
+
+	c.Max = 0
+	assert.Equal(DefaultMax, c.Delay(static, end))
+
+	var unseen crawler.Changes
+	ObserveUnchanged(&unseen, start)
+	_, ok := Rate(unseen, end)
+	assert.False(ok)
+	Observe(&unseen, start, 1)
+	ObserveUnchanged(&unseen, end)
+	rate, ok := Rate(unseen, end)
+	assert.True(ok)
+	assert.Equal(0.0, rate)
+}
+
+// countController revisits pages until they are visited n times.
+type countController struct {
+	crawler.NopController
+	n int
+}
+
+func (c countController) Resched(r *crawler.Response) (bool, crawler.Ticket) {
+	cnt, err := r.Context().NumVisit()
+	return err != nil || cnt >= c.n, crawler.Ticket{}
+}
+
+func TestCrawl(t *testing.T) {
+	assert := assert.New(t)
+	var (
+		mu    sync.Mutex
+		visit int
+		at    []time.Time
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visit++
+		at = append(at, time.Now())
+		// The content changes at the second visit only.
+		content := "old"
+		if visit > 1 {
+			content = "new"
+		}
+		mu.Unlock()
+		fmt.Fprint(w, content)
+	}))
+	defer ts.Close()
+
+	store := crawler.NewMemStore()
+	opt := *crawler.DefaultOption
+	opt.ObeyRobots = false
+	opt.MinDelay = 0
+	ctrl := New(countController{n: 4}, 50*time.Millisecond, 100*time.Millisecond)
+	cw := crawler.New(&crawler.Config{
+		Controller: ctrl,
+		Store:      store,
+		Option:     &opt,
+	})
+	assert.NoError(cw.Crawl(ts.URL))
+	cw.Wait()
+
+	assert.Equal(4, visit)
+	for i := 1; i < len(at); i++ {
+		assert.True(at[i].Sub(at[i-1]) >= 50*time.Millisecond)
+	}
+	u, err := url.Parse(ts.URL)
+	assert.NoError(err)
+	uu, err := store.Get(u)
+	if assert.NoError(err) {
+		assert.Equal(3, uu.Changes.Count)
+		assert.Equal(1, uu.Changes.Changed)
+		assert.False(uu.Changes.First.IsZero())
+	}
+}
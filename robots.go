@@ -0,0 +1,228 @@
+package crawler
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/fanyang01/crawler/queue"
+	"github.com/fanyang01/crawler/robots"
+)
+
+// robotsRetry is the delay before refetching an unreachable robots.txt.
+var robotsRetry = 10 * time.Minute
+
+// defaultRobotsTTL is used when Option.RobotsTTL is not set.
+const defaultRobotsTTL = 24 * time.Hour
+
+type robotsEntry struct {
+	ready  chan struct{} // closed after robots and expire are set
+	robots *robots.Robots
+	expire time.Time
+	// unreachable is set if robots.txt can't be fetched and there is no
+	// previous copy, in which case robots is DisallowAll.
+	unreachable bool
+}
+
+// robotsCache fetches and caches robots.txt files per site.
+type robotsCache struct {
+	cw    *Crawler
+	mu    sync.Mutex
+	m     map[string]*robotsEntry
+	delay map[string]time.Duration // keyed by host
+}
+
+func (cw *Crawler) newRobotsCache() *robotsCache {
+	return &robotsCache{
+		cw:    cw,
+		m:     make(map[string]*robotsEntry),
+		delay: make(map[string]time.Duration),
+	}
+}
+
+func robotsURL(u *url.URL) *url.URL {
+	return &url.URL{
+		Scheme: u.Scheme,
+		Host:   u.Host,
+		Path:   "/robots.txt",
+	}
+}
+
+// Allow reports whether u can be fetched according to the robots.txt of
+// its site.
+func (c *robotsCache) Allow(u *url.URL) bool {
+	ok, _ := c.Check(u)
+	return ok
+}
+
+// Check is like Allow, but if u is not allowed because the robots.txt of
+// its site is unreachable, retry is the time when it will be fetched
+// again.
+func (c *robotsCache) Check(u *url.URL) (ok bool, retry time.Time) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return true, time.Time{}
+	}
+	e := c.entry(u)
+	if e.unreachable {
+		return false, e.expire
+	}
+	return e.robots.Allow(c.cw.opt.RobotAgent, u), time.Time{}
+}
+
+// Get returns the robots.txt of the site of u. It will be fetched if it's
+// not in the cache or has expired. Concurrent callers for the same site
+// share one fetch.
+func (c *robotsCache) Get(u *url.URL) *robots.Robots {
+	return c.entry(u).robots
+}
+
+func (c *robotsCache) entry(u *url.URL) *robotsEntry {
+	var (
+		key  = u.Scheme + "://" + u.Host
+		prev *robots.Robots
+	)
+	c.mu.Lock()
+	e, ok := c.m[key]
+	if ok {
+		select {
+		case <-e.ready:
+			if time.Now().After(e.expire) {
+				prev, ok = e.robots, false
+			}
+		default:
+		}
+	}
+	if ok {
+		c.mu.Unlock()
+		<-e.ready
+		return e
+	}
+	e = &robotsEntry{ready: make(chan struct{})}
+	c.m[key] = e
+	c.mu.Unlock()
+
+	c.fetch(e, robotsURL(u), prev)
+	close(e.ready)
+	// robots.txt is also fetched for sitemaps, but its rules are
+	// ignored unless they are obeyed.
+	if c.cw.opt.ObeyRobots {
+		c.setDelay(u.Host, e.robots.Delay(c.cw.opt.RobotAgent))
+	}
+	return e
+}
+
+// Delay returns the crawl delay of host declared in its robots.txt. It
+// doesn't fetch robots.txt.
+func (c *robotsCache) Delay(host string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.delay[host]
+}
+
+// setDelay records the crawl delay of host and passes it to the wait queue
+// if the queue implements queue.Limiter.
+func (c *robotsCache) setDelay(host string, d time.Duration) {
+	c.mu.Lock()
+	prev, ok := c.delay[host]
+	c.delay[host] = d
+	c.mu.Unlock()
+	if ok && prev == d {
+		return
+	}
+	if l, ok := c.cw.scheduler.queue.(queue.Limiter); ok {
+		l.SetInterval(host, d)
+	}
+}
+
+// fetch sets the entry according to RFC 9309: 4xx means that there is no
+// restriction, while 5xx, 429 and network errors mean that the site is
+// unreachable and everything is disallowed until robots.txt is fetched
+// again. If a previous copy exists, it is used when the site is
+// unreachable.
+func (c *robotsCache) fetch(e *robotsEntry, u *url.URL, prev *robots.Robots) {
+	var (
+		logger          = c.cw.logger.New("url", u)
+		now             = time.Now()
+		rb, status, err = c.get(u)
+	)
+	switch {
+	case err == nil:
+		e.robots, e.expire = rb, now.Add(c.ttl())
+	case status >= 400 && status < 500 && status != http.StatusTooManyRequests:
+		e.robots, e.expire = robots.AllowAll, now.Add(c.ttl())
+	default:
+		logger.Error("fetch robots.txt", "err", err)
+		if e.robots = prev; e.robots == nil {
+			e.robots, e.unreachable = robots.DisallowAll, true
+		}
+		e.expire = now.Add(robotsRetry)
+	}
+}
+
+// ttl returns Option.RobotsTTL, or defaultRobotsTTL if it's not set.
+func (c *robotsCache) ttl() time.Duration {
+	if ttl := c.cw.opt.RobotsTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultRobotsTTL
+}
+
+func (c *robotsCache) get(u *url.URL) (rb *robots.Robots, status int, err error) {
+	status, err = c.cw.get(u, func(body io.Reader) (err error) {
+		rb, err = robots.Parse(body)
+		return
+	})
+	return
+}
+
+// get fetches u using the client of crawler outside of the processing
+// flow, and calls f with the response body if the status is 2xx. The
+// returned status is 0 if no response is received or f fails.
+func (cw *Crawler) get(u *url.URL, f func(body io.Reader) error) (status int, err error) {
+	hreq, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return
+	}
+	if agent := cw.opt.UserAgent; agent != "" {
+		hreq.Header.Set("User-Agent", agent)
+	}
+	hreq.Header.Set("Accept-Encoding", AcceptEncoding)
+	r, err := cw.client.Do(&Request{
+		Request:       hreq,
+		HostBandwidth: cw.opt.HostBandwidth,
+		bandwidth:     cw.bandwidth,
+	})
+	if err != nil {
+		return statusOf(err), err
+	}
+	defer func() {
+		if r.bodyCloser != nil {
+			r.bodyCloser.Close()
+		}
+		r.free()
+	}()
+	if status = r.StatusCode; status < 200 || status >= 300 {
+		return status, ResponseStatusError(status)
+	}
+	body := cw.bandwidth.Reader(r.Body, u.Host, cw.opt.HostBandwidth)
+	if err = f(body); err != nil {
+		status = 0
+	}
+	return
+}
+
+// statusOf returns the response status carried by err, or 0 if there is
+// none.
+func statusOf(err error) int {
+	switch e := err.(type) {
+	case ResponseStatusError:
+		return int(e)
+	case RetryableError:
+		return statusOf(e.Err)
+	case *RetryableError:
+		return statusOf(e.Err)
+	}
+	return 0
+}
@@ -0,0 +1,112 @@
+package robots
+
+import (
+	"strings"
+	"time"
+)
+
+// Directives are page-level directives specified by <meta name="robots">
+// tags and X-Robots-Tag headers.
+type Directives struct {
+	NoIndex  bool
+	NoFollow bool
+	// NoArchive asks not to keep a copy of the page. The crawler itself
+	// stores nothing; it's honored by download.Downloader.HandleResponse
+	// only, and other controllers that save pages should check it.
+	NoArchive        bool
+	UnavailableAfter time.Time
+}
+
+var dateLayouts = []string{
+	time.RFC850,
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC3339,
+	"2 Jan 2006 15:04:05 MST",
+	"2-Jan-2006 15:04:05 MST",
+	"2006-01-02",
+}
+
+func parseDate(s string) (t time.Time, ok bool) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return
+}
+
+// hasValue reports whether name is a directive with a value, which is
+// separated by a colon like a user agent.
+func hasValue(name string) bool {
+	switch name {
+	case "unavailable_after", "max-snippet", "max-image-preview", "max-video-preview":
+		return true
+	}
+	return false
+}
+
+// Parse parses a comma-separated list of directives, e.g., the content of
+// a meta tag. Unknown directives are ignored.
+func (d *Directives) Parse(s string) {
+	for s != "" {
+		var tok string
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			tok, s = s[:i], s[i+1:]
+		} else {
+			tok, s = s, ""
+		}
+		tok = strings.TrimSpace(tok)
+		switch strings.ToLower(tok) {
+		case "noindex":
+			d.NoIndex = true
+		case "nofollow":
+			d.NoFollow = true
+		case "none":
+			d.NoIndex, d.NoFollow = true, true
+		case "noarchive", "nocache":
+			d.NoArchive = true
+		default:
+			i := strings.IndexByte(tok, ':')
+			if i < 0 || strings.ToLower(strings.TrimSpace(tok[:i])) != "unavailable_after" {
+				continue
+			}
+			// The date may contain a comma, e.g., in RFC 850 format.
+			v := tok[i+1:]
+			if t, ok := parseDate(v); ok {
+				d.UnavailableAfter = t
+			} else if t, ok := parseDate(v + "," + s); ok {
+				d.UnavailableAfter, s = t, ""
+			}
+		}
+	}
+}
+
+// ParseHeader parses the value of an X-Robots-Tag header. If the value
+// is prefixed by a user agent, e.g., "gocrawler: noindex", it's ignored
+// unless the user agent is agent.
+func (d *Directives) ParseHeader(agent, value string) {
+	first := value
+	if i := strings.IndexByte(first, ','); i >= 0 {
+		first = first[:i]
+	}
+	if i := strings.IndexByte(first, ':'); i >= 0 {
+		name := strings.ToLower(strings.TrimSpace(first[:i]))
+		if !hasValue(name) {
+			if name != strings.ToLower(agent) {
+				return
+			}
+			value = value[i+1:]
+		}
+	}
+	d.Parse(value)
+}
+
+// NoIndexAt reports whether the page should not be indexed at t.
+func (d *Directives) NoIndexAt(t time.Time) bool {
+	if d.NoIndex {
+		return true
+	}
+	return !d.UnavailableAfter.IsZero() && !t.Before(d.UnavailableAfter)
+}
@@ -0,0 +1,35 @@
+package robots
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDirectives(t *testing.T) {
+	assert := assert.New(t)
+
+	var d Directives
+	d.Parse("NoIndex, nofollow")
+	assert.Equal(Directives{NoIndex: true, NoFollow: true}, d)
+
+	d = Directives{}
+	d.Parse("none,noarchive,unknown")
+	assert.Equal(Directives{NoIndex: true, NoFollow: true, NoArchive: true}, d)
+
+	d = Directives{}
+	d.Parse("noarchive, unavailable_after: Friday, 25-Jun-10 15:00:00 PST")
+	assert.True(d.NoArchive)
+	assert.Equal(time.June, d.UnavailableAfter.Month())
+	assert.False(d.NoIndexAt(time.Date(2010, 6, 1, 0, 0, 0, 0, time.UTC)))
+	assert.True(d.NoIndexAt(time.Date(2010, 7, 1, 0, 0, 0, 0, time.UTC)))
+
+	d = Directives{}
+	d.ParseHeader("gocrawler", "googlebot: noindex, nofollow")
+	assert.Equal(Directives{}, d)
+	d.ParseHeader("gocrawler", "GoCrawler: nofollow")
+	assert.Equal(Directives{NoFollow: true}, d)
+	d.ParseHeader("gocrawler", "unavailable_after: 2010-06-25")
+	assert.Equal(time.Date(2010, 6, 25, 0, 0, 0, 0, time.UTC), d.UnavailableAfter)
+}
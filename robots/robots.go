@@ -0,0 +1,294 @@
+// Package robots implements the Robots Exclusion Protocol (RFC 9309).
+package robots
+
+import (
+	"bufio"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxSize is the maximum number of bytes of a robots.txt file that will be
+// parsed. Content after the limit is ignored.
+const MaxSize = 500 << 10
+
+type rule struct {
+	allow   bool
+	pattern string
+}
+
+// Group is a group of rules that applies to a set of user agents.
+type Group struct {
+	Agents     []string
+	CrawlDelay time.Duration
+	// RequestRate is the interval derived from a Request-rate directive,
+	// e.g., "1/5s" gives 5 seconds.
+	RequestRate time.Duration
+	rules       []rule
+}
+
+// Robots is a parsed robots.txt file.
+type Robots struct {
+	Groups   []*Group
+	Sitemaps []string
+	// all is set for AllowAll and DisallowAll.
+	all *bool
+}
+
+var (
+	allow    = true
+	disallow = false
+	// AllowAll allows access to any path. It is used when robots.txt is
+	// unavailable(status 4xx).
+	AllowAll = &Robots{all: &allow}
+	// DisallowAll disallows access to any path. It is used when
+	// robots.txt is unreachable(status 5xx or network errors).
+	DisallowAll = &Robots{all: &disallow}
+)
+
+// Parse parses a robots.txt file. At most MaxSize bytes are read.
+func Parse(r io.Reader) (*Robots, error) {
+	var (
+		robots  = &Robots{}
+		group   *Group
+		inRules bool
+		scanner = bufio.NewScanner(io.LimitReader(r, MaxSize))
+	)
+	scanner.Buffer(make([]byte, 4096), MaxSize)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "user-agent":
+			if group == nil || inRules {
+				group = &Group{}
+				robots.Groups = append(robots.Groups, group)
+				inRules = false
+			}
+			group.Agents = append(group.Agents, strings.ToLower(val))
+		case "allow", "disallow":
+			if group == nil {
+				continue
+			}
+			inRules = true
+			if val == "" { // empty disallow means allowing anything
+				continue
+			}
+			group.rules = append(group.rules, rule{
+				allow:   key == "allow",
+				pattern: normalizePattern(val),
+			})
+		case "crawl-delay":
+			if group == nil {
+				continue
+			}
+			inRules = true
+			if sec, err := strconv.ParseFloat(val, 64); err == nil && sec >= 0 {
+				group.CrawlDelay = time.Duration(sec * float64(time.Second))
+			}
+		case "request-rate":
+			if group == nil {
+				continue
+			}
+			inRules = true
+			if d, ok := parseRate(val); ok {
+				group.RequestRate = d
+			}
+		case "sitemap":
+			if u, err := url.Parse(val); err == nil && u.IsAbs() {
+				robots.Sitemaps = append(robots.Sitemaps, u.String())
+			}
+		}
+	}
+	return robots, scanner.Err()
+}
+
+// parseRate parses a request rate in the form of "n/t", where t is a
+// number optionally followed by a unit of s, m, h or d. A trailing visit
+// time window, e.g., "1/5s 0600-0845", is ignored.
+func parseRate(s string) (time.Duration, bool) {
+	if fields := strings.Fields(s); len(fields) > 0 {
+		s = fields[0]
+	}
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	t, unit := strings.ToLower(s[i+1:]), time.Second
+	if k := len(t) - 1; k >= 0 {
+		switch t[k] {
+		case 's':
+			t = t[:k]
+		case 'm':
+			t, unit = t[:k], time.Minute
+		case 'h':
+			t, unit = t[:k], time.Hour
+		case 'd':
+			t, unit = t[:k], 24*time.Hour
+		}
+	}
+	sec, err := strconv.ParseFloat(t, 64)
+	if err != nil || sec < 0 {
+		return 0, false
+	}
+	return time.Duration(sec / n * float64(unit)), true
+}
+
+// normalizePattern uppercases percent-encoded octets so that patterns and
+// paths are compared in the same form.
+func normalizePattern(s string) string {
+	b := []byte(s)
+	for i := 0; i+2 < len(b); i++ {
+		if b[i] != '%' {
+			continue
+		}
+		for j := i + 1; j <= i+2; j++ {
+			if 'a' <= b[j] && b[j] <= 'f' {
+				b[j] -= 'a' - 'A'
+			}
+		}
+	}
+	return string(b)
+}
+
+// Group returns the group of rules for agent, which should be the product
+// token of a crawler, e.g., "gocrawler". Multiple groups matching agent
+// are merged. If none of the groups matches agent, the group of "*" is
+// returned. The returned group is nil if no group applies.
+func (r *Robots) Group(agent string) *Group {
+	agent = strings.ToLower(agent)
+	if g := r.merge(agent); g != nil {
+		return g
+	}
+	return r.merge("*")
+}
+
+func (r *Robots) merge(agent string) (merged *Group) {
+	for _, g := range r.Groups {
+		for _, a := range g.Agents {
+			if a != agent {
+				continue
+			}
+			if merged == nil {
+				merged = &Group{Agents: []string{agent}}
+			}
+			merged.rules = append(merged.rules, g.rules...)
+			if g.CrawlDelay > merged.CrawlDelay {
+				merged.CrawlDelay = g.CrawlDelay
+			}
+			if g.RequestRate > merged.RequestRate {
+				merged.RequestRate = g.RequestRate
+			}
+			break
+		}
+	}
+	return
+}
+
+// Delay returns the minimum interval between two requests of agent
+// declared by the site, or 0 if there is none.
+func (r *Robots) Delay(agent string) time.Duration {
+	if r.all != nil {
+		return 0
+	}
+	if g := r.Group(agent); g != nil {
+		return g.Delay()
+	}
+	return 0
+}
+
+// Allow reports whether agent is allowed to access u.
+func (r *Robots) Allow(agent string, u *url.URL) bool {
+	if r.all != nil {
+		return *r.all
+	}
+	if u.EscapedPath() == "/robots.txt" {
+		return true
+	}
+	g := r.Group(agent)
+	if g == nil {
+		return true
+	}
+	return g.Allow(u)
+}
+
+// Delay returns the larger one of CrawlDelay and RequestRate.
+func (g *Group) Delay() time.Duration {
+	if g.RequestRate > g.CrawlDelay {
+		return g.RequestRate
+	}
+	return g.CrawlDelay
+}
+
+// Allow reports whether u is allowed by the group. The longest matching
+// rule wins, and allow rules win in case of a tie.
+func (g *Group) Allow(u *url.URL) bool {
+	pth := u.EscapedPath()
+	if pth == "" {
+		pth = "/"
+	}
+	if u.RawQuery != "" {
+		pth += "?" + u.RawQuery
+	}
+	pth = normalizePattern(pth)
+
+	var (
+		allowed = true
+		longest = -1
+	)
+	for _, r := range g.rules {
+		if !match(r.pattern, pth) {
+			continue
+		}
+		if n := len(r.pattern); n > longest || (n == longest && r.allow) {
+			longest = n
+			allowed = r.allow
+		}
+	}
+	return allowed
+}
+
+// match reports whether the path matches the pattern, in which '*' matches
+// any sequence of characters and a trailing '$' matches the end of path.
+func match(pattern, pth string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	if anchored {
+		pattern = pattern[:len(pattern)-1]
+	}
+	parts := strings.Split(pattern, "*")
+	// The first part is a prefix.
+	if !strings.HasPrefix(pth, parts[0]) {
+		return false
+	}
+	pth = pth[len(parts[0]):]
+	if len(parts) == 1 {
+		return !anchored || pth == ""
+	}
+	for i, part := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(pth, part)
+		}
+		j := strings.Index(pth, part)
+		if j < 0 {
+			return false
+		}
+		pth = pth[j+len(part):]
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+package robots
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+const robotsTxt = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/public
+Disallow: /*.pdf$
+Disallow: /search?
+
+User-agent: GoCrawler
+User-agent: other
+Crawl-delay: 2.5
+Request-rate: 1/5s 0600-0845
+Disallow: /tmp/ # trailing comment
+Allow: /tmp/ok
+
+User-agent: gocrawler
+Disallow: /cgi-bin
+Disallow:
+
+Sitemap: http://example.com/sitemap.xml
+Sitemap: /relative.xml
+`
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+	r, err := Parse(strings.NewReader(robotsTxt))
+	assert.NoError(err)
+	assert.Equal(3, len(r.Groups))
+	assert.Equal([]string{"http://example.com/sitemap.xml"}, r.Sitemaps)
+
+	g := r.Group("GOCRAWLER")
+	assert.NotNil(g)
+	assert.Equal(2500*time.Millisecond, g.CrawlDelay)
+	assert.Equal(5*time.Second, g.RequestRate)
+	assert.Equal(5*time.Second, r.Delay("gocrawler"))
+	assert.Equal(3, len(g.rules))
+
+	g = r.Group("unknown")
+	assert.NotNil(g)
+	assert.Equal([]string{"*"}, g.Agents)
+	assert.Equal(time.Duration(0), g.Delay())
+	assert.Equal(time.Duration(0), AllowAll.Delay("unknown"))
+	assert.Nil((&Robots{}).Group("unknown"))
+}
+
+func TestAllow(t *testing.T) {
+	assert := assert.New(t)
+	r, err := Parse(strings.NewReader(robotsTxt))
+	assert.NoError(err)
+
+	data := []struct {
+		agent string
+		url   string
+		allow bool
+	}{
+		{"bot", "http://example.com/", true},
+		{"bot", "http://example.com/private", false},
+		{"bot", "http://example.com/private/x", false},
+		{"bot", "http://example.com/private/public/x", true},
+		{"bot", "http://example.com/doc/a.pdf", false},
+		{"bot", "http://example.com/doc/a.pdf?x=1", true},
+		{"bot", "http://example.com/search?q=go", false},
+		{"bot", "http://example.com/search", true},
+		{"bot", "http://example.com/robots.txt", true},
+		{"gocrawler", "http://example.com/private", true},
+		{"gocrawler", "http://example.com/tmp/x", false},
+		{"gocrawler", "http://example.com/tmp/ok", true},
+		{"gocrawler", "http://example.com/cgi-bin/x", false},
+		{"other", "http://example.com/cgi-bin/x", true},
+	}
+	for _, v := range data {
+		assert.Equal(v.allow, r.Allow(v.agent, mustParse(v.url)), "%s %s", v.agent, v.url)
+	}
+	assert.True(AllowAll.Allow("bot", mustParse("http://example.com/private")))
+	assert.False(DisallowAll.Allow("bot", mustParse("http://example.com/")))
+}
+
+func TestMatch(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(match("/", "/anything"))
+	assert.True(match("/*", "/anything"))
+	assert.True(match("/a*b*c", "/axxbyyc"))
+	assert.True(match("/a*b*c", "/axxbyycd"))
+	assert.False(match("/a*b*c$", "/axxbyycd"))
+	assert.True(match("/a*b*c$", "/axxbcyyc"))
+	assert.True(match("/a$", "/a"))
+	assert.False(match("/a$", "/ab"))
+	assert.True(match("/%E4%BD%A0", normalizePattern("/%e4%bd%a0")))
+}
+
+func TestParseRate(t *testing.T) {
+	assert := assert.New(t)
+	for _, v := range []struct {
+		s  string
+		d  time.Duration
+		ok bool
+	}{
+		{"1/5", 5 * time.Second, true},
+		{"2/1m", 30 * time.Second, true},
+		{"1/1h 0600-0845", time.Hour, true},
+		{"10/1d", 144 * time.Minute, true},
+		{"0/5", 0, false},
+		{"5", 0, false},
+		{"1/x", 0, false},
+	} {
+		d, ok := parseRate(v.s)
+		assert.Equal(v.ok, ok, v.s)
+		assert.Equal(v.d, d, v.s)
+	}
+}
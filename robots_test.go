@@ -0,0 +1,232 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler/queue"
+	"github.com/fanyang01/crawler/queue/ratelimitq"
+	"github.com/stretchr/testify/assert"
+)
+
+type robotsController struct {
+	NopController
+}
+
+func (c robotsController) Handle(r *Response, ch chan<- *url.URL) {
+	ExtractHref(r.NewURL, r.Body, ch)
+}
+
+func robotsOption() *Option {
+	opt := *DefaultOption
+	opt.ObeyRobots = true
+	return &opt
+}
+
+func TestRobots(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		visited = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprint(w, "User-agent: gocrawler\nDisallow: /private\n")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/public">public</a><a href="/private">private</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	cw := New(&Config{Controller: robotsController{}, Option: robotsOption()})
+	assert.NoError(t, cw.Crawl(ts.URL))
+	cw.Wait()
+
+	assert.Equal(t, map[string]int{
+		"/robots.txt": 1,
+		"/":           1,
+		"/public":     1,
+	}, visited)
+}
+
+func TestRobotsStatus(t *testing.T) {
+	assert := assert.New(t)
+	status := 0
+	mux := http.NewServeMux()
+	mux.Handle("/robots.txt", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	u := mustParseURL(ts.URL + "/page")
+	for _, v := range []struct {
+		status int
+		allow  bool
+	}{
+		{404, true},
+		{403, true},
+		{429, false},
+		{500, false},
+		{503, false},
+	} {
+		status = v.status
+		cw := New(nil)
+		assert.Equal(v.allow, cw.robots.Allow(u), "status %d", v.status)
+	}
+}
+
+func TestRobotsDefaultTTL(t *testing.T) {
+	n := 0
+	mux := http.NewServeMux()
+	mux.Handle("/robots.txt", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n++
+		fmt.Fprint(w, "User-agent: *\nDisallow: /private\n")
+	}))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	// RobotsTTL is left unset.
+	cw := New(&Config{Option: &Option{ObeyRobots: true}})
+	assert.True(t, cw.robots.Allow(mustParseURL(ts.URL+"/public")))
+	assert.False(t, cw.robots.Allow(mustParseURL(ts.URL+"/private")))
+	assert.Equal(t, 1, n)
+}
+
+func TestRobotsUnreachable(t *testing.T) {
+	defer func(d time.Duration) { robotsRetry = d }(robotsRetry)
+	robotsRetry = 200 * time.Millisecond
+
+	var (
+		mu      sync.Mutex
+		visited = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		visited[r.URL.Path]++
+		if r.URL.Path == "/robots.txt" && visited[r.URL.Path] == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	start := time.Now()
+	cw := New(&Config{Controller: robotsController{}, Option: robotsOption()})
+	assert.NoError(t, cw.Crawl(ts.URL+"/"))
+	cw.Wait()
+	assert.True(t, time.Since(start) >= robotsRetry)
+	assert.Equal(t, map[string]int{
+		"/robots.txt": 2,
+		"/":           1,
+	}, visited)
+}
+
+type intervalController struct {
+	NopController
+}
+
+func (intervalController) Interval(_ string) time.Duration { return 2 * time.Second }
+
+func TestRobotsDelay(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nCrawl-delay: 1\nRequest-rate: 1/3s\n")
+		}
+	}))
+	defer ts.Close()
+	u := mustParseURL(ts.URL)
+
+	wq := ratelimitq.New(nil)
+	cw := New(&Config{Queue: queue.WithChannel(wq), Option: robotsOption()})
+	assert.NoError(cw.Crawl(ts.URL))
+	cw.Wait()
+	assert.Equal(3*time.Second, cw.Interval(u.Host))
+
+	opt := *DefaultOption
+	opt.ObeyRobots = false
+	cw = New(&Config{Controller: intervalController{}, Option: &opt})
+	assert.Equal(2*time.Second, cw.Interval(u.Host))
+}
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		last time.Time
+		gaps []time.Duration
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			fmt.Fprint(w, "User-agent: *\nCrawl-delay: 1\n")
+			return
+		}
+		mu.Lock()
+		if !last.IsZero() {
+			gaps = append(gaps, time.Since(last))
+		}
+		last = time.Now()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+	}))
+	defer ts.Close()
+
+	// The default wait queue doesn't limit the rate by itself.
+	opt := robotsOption()
+	opt.MinDelay = 0
+	cw := New(&Config{Controller: robotsController{}, Option: opt})
+	assert.NoError(t, cw.Crawl(ts.URL+"/"))
+	cw.Wait()
+	assert.Len(t, gaps, 2)
+	for _, d := range gaps {
+		assert.True(t, d >= 900*time.Millisecond, d)
+	}
+}
+
+func TestNoFollow(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		visited = map[string]int{}
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		visited[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/":
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+		case "/a":
+			fmt.Fprint(w, `<meta name="robots" content="nofollow">
+<meta http-equiv="refresh" content="0; url=/e"><a href="/c">c</a>`)
+		case "/b":
+			w.Header().Set("X-Robots-Tag", "gocrawler: nofollow")
+			fmt.Fprint(w, `<a href="/d">d</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	// The refresh target of a nofollow page is still followed.
+	opt := robotsOption()
+	opt.FollowRedirect = true
+	cw := New(&Config{Controller: robotsController{}, Option: opt})
+	assert.NoError(t, cw.Crawl(ts.URL+"/"))
+	cw.Wait()
+	assert.Equal(t, map[string]int{
+		"/robots.txt": 1,
+		"/":           1,
+		"/a":          1,
+		"/b":          1,
+		"/e":          1,
+	}, visited)
+}
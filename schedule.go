@@ -29,8 +29,15 @@ type scheduler struct {
 
 	stop chan struct{}
 	once sync.Once // used for closing Out
+
+	mu   sync.Mutex
+	last map[string]time.Time // time of the latest request to host
 }
 
+// maxLastHosts is the number of hosts in scheduler.last above which the
+// hosts whose interval has passed are removed.
+const maxLastHosts = 4096
+
 func (cw *Crawler) newScheduler(wq queue.WaitQueue) *scheduler {
 	nworker := cw.opt.NWorker.Scheduler
 	queueIn, queueOut, queueErr := wq.Channel()
@@ -51,6 +58,7 @@ func (cw *Crawler) newScheduler(wq queue.WaitQueue) *scheduler {
 		queueErr: queueErr,
 
 		stop: make(chan struct{}),
+		last: make(map[string]time.Time),
 	}
 
 	cw.initWorker("scheduler", this, nworker)
@@ -83,15 +91,19 @@ func (sd *scheduler) work() {
 		select {
 		// Input:
 		case u := <-sd.NewIn:
-			item = sd.sched(nil, u)
+			item = sd.sched(nil, &Link{URL: u})
 			waiting = append(waiting, item)
 			continue
 		case u := <-sd.RecoverIn:
-			item = sd.sched(nil, u)
+			item = sd.sched(nil, &Link{URL: u})
 			waiting = append(waiting, item)
 			continue
 
 		case ctx := <-sd.CancelIn:
+			if ctx.skip != nil {
+				waiting = append(waiting, sd.skip(ctx))
+				continue
+			}
 			if err = sd.cw.store.Complete(ctx.url); err != nil {
 				goto ERROR
 			}
@@ -127,8 +139,8 @@ func (sd *scheduler) work() {
 				return // closed
 			}
 			sd.cw.store.IncVisitCount()
-			for _, url := range resp.links {
-				item = sd.sched(resp, url)
+			for _, link := range resp.links {
+				item = sd.sched(resp, link)
 				waiting = append(waiting, item)
 			}
 			item, done, err = sd.resched(resp)
@@ -142,8 +154,8 @@ func (sd *scheduler) work() {
 			// NOTE: even if an error occured, links found in the response
 			// should still be enqueued, because the state of storage has
 			// been changed.
-			for _, url := range resp.links {
-				item = sd.sched(resp, url)
+			for _, link := range resp.links {
+				item = sd.sched(resp, link)
 				waiting = append(waiting, item)
 			}
 			switch resp.ctx.err.(type) {
@@ -171,6 +183,11 @@ func (sd *scheduler) work() {
 			if item == nil { // queue has been closed
 				return
 			}
+			if next, ok := sd.throttle(item.URL); !ok {
+				item.Next = next
+				waiting = append(waiting, item)
+				continue
+			}
 			var ctx *Context
 			if ctx, err = sd.cw.newContext(item.URL, item.Ctx); err != nil {
 				goto ERROR
@@ -189,6 +206,9 @@ func (sd *scheduler) work() {
 			}
 
 		// Control:
+		case <-sd.cw.sitemaps.done:
+			// A discovery has finished, check below whether the crawler
+			// has finished.
 		case err = <-sd.queueErr:
 			if err != nil {
 				goto ERROR
@@ -202,7 +222,7 @@ func (sd *scheduler) work() {
 
 		if ok, err = sd.cw.store.IsFinished(); err != nil {
 			goto ERROR
-		} else if ok {
+		} else if ok && !sd.cw.sitemaps.Busy() {
 			sd.exit()
 			return
 		}
@@ -232,14 +252,52 @@ func (sd *scheduler) exit() {
 	sd.once.Do(func() { close(sd.stop) })
 }
 
-func (sd *scheduler) sched(r *Response, u *url.URL) *queue.Item {
+// throttle reports whether a request to u can be made now according to
+// Crawler.Interval of its host. If not, next is the earliest time to
+// make it. Queues implementing queue.Limiter are trusted to space
+// requests themselves.
+func (sd *scheduler) throttle(u *url.URL) (next time.Time, ok bool) {
+	if _, limiter := sd.queue.(queue.Limiter); limiter {
+		return time.Time{}, true
+	}
+	now := time.Now()
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if last, seen := sd.last[u.Host]; seen {
+		if next = last.Add(sd.cw.Interval(u.Host)); now.Before(next) {
+			return next, false
+		}
+	} else if len(sd.last) >= maxLastHosts {
+		for host, last := range sd.last {
+			if !now.Before(last.Add(sd.cw.Interval(host))) {
+				delete(sd.last, host)
+			}
+		}
+	}
+	sd.last[u.Host] = now
+	return time.Time{}, true
+}
+
+// spaced reports whether requests to host are spaced, either by the queue
+// or by throttle.
+func (sd *scheduler) spaced(host string) bool {
+	if _, limiter := sd.queue.(queue.Limiter); limiter {
+		return true
+	}
+	return sd.cw.Interval(host) > 0
+}
+
+func (sd *scheduler) sched(r *Response, link *Link) *queue.Item {
 	item := queue.NewItem()
-	item.URL = u
-	t := sd.cw.ctrl.Sched(r, u)
+	item.URL = link.URL
+	t := SchedLink(sd.cw.ctrl, r, link)
 	if t.Ctx == nil {
 		t.Ctx = context.Background()
 	}
 	item.Next, item.Score, item.Ctx = t.At, t.Score, t.Ctx
+	if sd.cw.opt.Resolver != nil {
+		sd.cw.opt.Resolver.Prefetch(link.URL.Hostname())
+	}
 	return item
 }
 
@@ -257,12 +315,18 @@ func (sd *scheduler) resched(r *Response) (
 		u.NumRetry = 0
 		last = u.Last
 		u.Last = r.Timestamp
+		u.setValidators(r)
 	}); err != nil {
 		return
 	}
 
 	var t Ticket
-	done, t = sd.cw.ctrl.Resched(r)
+	if r.duplicate {
+		// The page has been collapsed into its canonical URL.
+		done = true
+	} else {
+		done, t = sd.cw.ctrl.Resched(r)
+	}
 	if done {
 		err = sd.cw.store.Complete(r.URL)
 		return
@@ -280,6 +344,22 @@ func (sd *scheduler) resched(r *Response) (
 	return
 }
 
+// skip schedules the URL of a skipped request by its ticket.
+func (sd *scheduler) skip(ctx *Context) *queue.Item {
+	defer ctx.free()
+	t := ctx.skip
+	if t.Ctx == nil {
+		t.Ctx = ctx.C
+	}
+	if t.Ctx == nil {
+		t.Ctx = context.Background()
+	}
+	item := queue.NewItem()
+	item.URL = ctx.url
+	item.Next, item.Score, item.Ctx = t.At, t.Score, t.Ctx
+	return item
+}
+
 func (sd *scheduler) retry(ctx *Context) (*queue.Item, bool, error) {
 	defer ctx.free()
 
@@ -292,6 +372,16 @@ func (sd *scheduler) retry(ctx *Context) (*queue.Item, bool, error) {
 	}
 
 	delay, max := sd.cw.ctrl.Retry(ctx)
+	switch err := ctx.err.(type) {
+	case RetryableError:
+		if err.After > delay {
+			delay = err.After
+		}
+	case *RetryableError:
+		if err.After > delay {
+			delay = err.After
+		}
+	}
 	if cnt >= max {
 		sd.logger.Error(
 			"exceed maximum number of retries",
@@ -0,0 +1,42 @@
+package crawler
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/fanyang01/crawler/urlx"
+)
+
+// SchemeHandler makes requests of a URL scheme other than http and
+// https, e.g., the handlers in package scheme. The responses it returns
+// are processed like those of HTTP, so they should have a status code and
+// headers like Content-Type where possible.
+type SchemeHandler interface {
+	Client
+	// Normalize normalizes URLs of the scheme.
+	Normalize(u *url.URL) error
+}
+
+var schemeHandlers = struct {
+	sync.RWMutex
+	m map[string]SchemeHandler
+}{m: make(map[string]SchemeHandler)}
+
+// RegisterScheme registers the handler of scheme. Requests of the scheme
+// made by StdClient are passed to the handler, and URLs of the scheme are
+// accepted by urlx.Normalize.
+func RegisterScheme(scheme string, h SchemeHandler) {
+	scheme = strings.ToLower(scheme)
+	schemeHandlers.Lock()
+	schemeHandlers.m[scheme] = h
+	schemeHandlers.Unlock()
+	urlx.RegisterScheme(scheme, h.Normalize)
+}
+
+func schemeHandler(scheme string) (SchemeHandler, bool) {
+	schemeHandlers.RLock()
+	defer schemeHandlers.RUnlock()
+	h, ok := schemeHandlers.m[scheme]
+	return h, ok
+}
@@ -0,0 +1,78 @@
+package scheme
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/urlx"
+)
+
+// Data serves data URLs defined by RFC 2397.
+type Data struct{}
+
+// Normalize implements crawler.SchemeHandler.
+func (Data) Normalize(u *url.URL) error { return urlx.NormalizeData(u) }
+
+// Do implements crawler.Client.
+func (Data) Do(req *crawler.Request) (*crawler.Response, error) {
+	typ, b, err := ParseData(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", typ)
+	return newResponse(req, nil, header, int64(len(b)),
+		ioutil.NopCloser(bytes.NewReader(b))), nil
+}
+
+// ParseData returns the media type and content of a data URL. A "?" in the
+// content is parsed by package url as the start of a query, which is put
+// back.
+func ParseData(u *url.URL) (typ string, content []byte, err error) {
+	opaque := u.Opaque
+	if u.RawQuery != "" || u.ForceQuery {
+		opaque += "?" + u.RawQuery
+	}
+	i := strings.IndexByte(opaque, ',')
+	if u.Scheme != "data" || i < 0 {
+		return "", nil, fmt.Errorf("scheme: invalid data URL: %q", u.String())
+	}
+	typ, data := opaque[:i], opaque[i+1:]
+	if data, err = url.PathUnescape(data); err != nil {
+		return "", nil, err
+	}
+
+	encoded := false
+	if strings.HasSuffix(strings.ToLower(typ), ";base64") {
+		typ, encoded = typ[:len(typ)-len(";base64")], true
+	}
+	if typ, err = url.PathUnescape(typ); err != nil {
+		return "", nil, err
+	}
+	switch {
+	case typ == "":
+		typ = "text/plain;charset=US-ASCII"
+	case strings.HasPrefix(typ, ";"):
+		typ = "text/plain" + typ
+	}
+
+	if !encoded {
+		return typ, []byte(data), nil
+	}
+	data = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, data)
+	if content, err = base64.StdEncoding.DecodeString(data); err != nil {
+		content, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	}
+	return typ, content, err
+}
@@ -0,0 +1,105 @@
+package scheme
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/urlx"
+)
+
+// File serves file URLs from the local file system. A directory is served
+// as its index.html, or a listing of its entries if there's none.
+type File struct {
+	// Root, if not empty, is the directory that the paths of URLs are
+	// relative to. Files outside Root can't be accessed, except through
+	// symbolic links.
+	Root string
+	// NoIndex lists directories even if they have an index.html.
+	NoIndex bool
+	// Policy classifies the statuses of missing and forbidden files,
+	// 404 and 403. If nil, crawler.DefaultStatusPolicy is used.
+	Policy *crawler.StatusPolicy
+}
+
+// Normalize implements crawler.SchemeHandler.
+func (f *File) Normalize(u *url.URL) error { return urlx.NormalizeFile(u) }
+
+// Do implements crawler.Client.
+func (f *File) Do(req *crawler.Request) (*crawler.Response, error) {
+	p := path.Clean("/" + req.URL.Path)
+	name := filepath.Join(f.Root, filepath.FromSlash(p))
+	fi, err := os.Stat(name)
+	if err != nil {
+		return failure(req, f.Policy, fileError(err))
+	}
+
+	var newURL *url.URL
+	if fi.IsDir() {
+		if !strings.HasSuffix(req.URL.Path, "/") {
+			newURL = dirURL(req.URL)
+		}
+		index := filepath.Join(name, "index.html")
+		if ifi, err := os.Stat(index); err == nil && !ifi.IsDir() && !f.NoIndex {
+			name, fi = index, ifi
+		} else {
+			return f.list(req, newURL, name, p)
+		}
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return failure(req, f.Policy, fileError(err))
+	}
+	header := http.Header{}
+	if t := mime.TypeByExtension(filepath.Ext(name)); t != "" {
+		header.Set("Content-Type", t)
+	}
+	header.Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	return newResponse(req, newURL, header, fi.Size(), file), nil
+}
+
+func (f *File) list(
+	req *crawler.Request, newURL *url.URL, name, dir string,
+) (*crawler.Response, error) {
+	d, err := os.Open(name)
+	if err != nil {
+		return failure(req, f.Policy, fileError(err))
+	}
+	fis, err := d.Readdir(-1)
+	d.Close()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(fis))
+	for _, fi := range fis {
+		if fi.IsDir() {
+			names = append(names, fi.Name()+"/")
+		} else {
+			names = append(names, fi.Name())
+		}
+	}
+	sort.Strings(names)
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	header, length, body := listing(dir, names)
+	return newResponse(req, newURL, header, length, body), nil
+}
+
+// fileError converts errors of missing or forbidden files to statuses.
+func fileError(err error) error {
+	switch {
+	case os.IsNotExist(err):
+		return crawler.ResponseStatusError(http.StatusNotFound)
+	case os.IsPermission(err):
+		return crawler.ResponseStatusError(http.StatusForbidden)
+	}
+	return err
+}
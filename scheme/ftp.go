@@ -0,0 +1,340 @@
+package scheme
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/urlx"
+)
+
+// ErrControlChar is returned for ftp URLs whose path or credentials contain
+// control characters, which would inject commands into the session.
+var ErrControlChar = errors.New("scheme: control character in ftp URL")
+
+// FTP serves ftp URLs in passive mode. A directory is served as a listing
+// of its entries. The user and password in URLs are used to log in, or
+// the anonymous login is used if there's none.
+type FTP struct {
+	// Timeout limits dialing and each command. Zero means 30 seconds.
+	Timeout time.Duration
+	// Policy classifies the statuses of missing files and failed logins,
+	// 404 and 403. If nil, crawler.DefaultStatusPolicy is used.
+	Policy *crawler.StatusPolicy
+}
+
+// Normalize implements crawler.SchemeHandler.
+func (f *FTP) Normalize(u *url.URL) error { return urlx.NormalizeFTP(u) }
+
+// Do implements crawler.Client.
+func (f *FTP) Do(req *crawler.Request) (r *crawler.Response, err error) {
+	if err = checkFTP(req.URL); err != nil {
+		return nil, err
+	}
+	c, err := f.dial(req.URL)
+	if err != nil {
+		return failure(req, f.Policy, ftpError(err))
+	}
+	defer func() {
+		if err != nil {
+			c.Close()
+			r, err = failure(req, f.Policy, ftpError(err))
+		}
+	}()
+
+	p := req.URL.Path
+	if p == "" {
+		p = "/"
+	}
+	isDir := strings.HasSuffix(p, "/")
+	if !isDir {
+		if _, _, err := c.cmd(250, "CWD %s", p); err == nil {
+			isDir = true
+		}
+	}
+	if isDir {
+		return f.list(req, c, p)
+	}
+
+	data, err := c.open("RETR %s", p)
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	if t := mime.TypeByExtension(path.Ext(p)); t != "" {
+		header.Set("Content-Type", t)
+	}
+	return newResponse(req, nil, header, -1, &ftpBody{Conn: data, c: c}), nil
+}
+
+func (f *FTP) list(req *crawler.Request, c *ftpConn, dir string) (*crawler.Response, error) {
+	var newURL *url.URL
+	if !strings.HasSuffix(dir, "/") {
+		newURL = dirURL(req.URL)
+		dir += "/"
+	}
+	data, err := c.open("LIST %s", dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	s := bufio.NewScanner(data)
+	for s.Scan() {
+		if name, ok := parseList(s.Text()); ok {
+			names = append(names, name)
+		}
+	}
+	data.Close()
+	// On errors, c is closed by Do.
+	if err = s.Err(); err == nil {
+		err = c.quit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Close()
+	sort.Strings(names)
+	header, length, body := listing(dir, names)
+	return newResponse(req, newURL, header, length, body), nil
+}
+
+// parseList parses a line of LIST in the format of Unix ls or MS-DOS dir.
+// The name of a directory ends with "/".
+func parseList(line string) (name string, ok bool) {
+	fields := strings.Fields(line)
+	switch {
+	case len(fields) >= 4 && isDOSDate(fields[0]):
+		// 01-16-02  11:14AM  <DIR>  name
+		name = strings.Join(fields[3:], " ")
+		if fields[2] == "<DIR>" {
+			name += "/"
+		}
+	case len(fields) >= 9:
+		// drwxr-xr-x 2 user group 4096 Jan 1 00:00 name
+		i := 0
+		for n := 0; n < 8; n++ {
+			i += strings.Index(line[i:], fields[n]) + len(fields[n])
+		}
+		name = strings.TrimLeft(line[i:], " ")
+		switch fields[0][0] {
+		case 'd':
+			name += "/"
+		case 'l':
+			if j := strings.Index(name, " -> "); j >= 0 {
+				name = name[:j]
+			}
+		}
+	}
+	if name == "" || name == "./" || name == "../" {
+		return "", false
+	}
+	return name, true
+}
+
+func isDOSDate(s string) bool {
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFTP rejects u if its path or credentials contain control
+// characters, e.g., "%0D%0A", which end a command line.
+func checkFTP(u *url.URL) error {
+	s := u.Path
+	if u.User != nil {
+		p, _ := u.User.Password()
+		s += u.User.Username() + p
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return ErrControlChar
+		}
+	}
+	return nil
+}
+
+// ftpConn is a control connection.
+type ftpConn struct {
+	*textproto.Conn
+	nc      net.Conn
+	host    string
+	timeout time.Duration
+}
+
+func (f *FTP) dial(u *url.URL) (*ftpConn, error) {
+	timeout := f.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), "21")
+	}
+	nc, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &ftpConn{
+		Conn:    textproto.NewConn(nc),
+		nc:      nc,
+		host:    u.Hostname(),
+		timeout: timeout,
+	}
+	nc.SetDeadline(time.Now().Add(timeout))
+	if _, _, err = c.ReadResponse(220); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		code, _, err = c.cmd(0, "PASS %s", pass)
+	}
+	if err == nil && code != 230 {
+		err = &textproto.Error{Code: code, Msg: "login failed"}
+	}
+	if err == nil {
+		_, _, err = c.cmd(200, "TYPE I")
+	}
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// cmd sends a command and reads the response, which is checked against
+// expect like textproto.Conn.ReadResponse.
+func (c *ftpConn) cmd(expect int, format string, args ...interface{}) (int, string, error) {
+	c.nc.SetDeadline(time.Now().Add(c.timeout))
+	if err := c.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.ReadResponse(expect)
+}
+
+// open opens a passive data connection for the command.
+func (c *ftpConn) open(format string, args ...interface{}) (net.Conn, error) {
+	port, err := c.passive()
+	if err != nil {
+		return nil, err
+	}
+	data, err := net.DialTimeout("tcp", net.JoinHostPort(c.host, port), c.timeout)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err = c.cmd(1, format, args...); err != nil {
+		data.Close()
+		return nil, err
+	}
+	c.nc.SetDeadline(time.Time{})
+	return data, nil
+}
+
+// passive enters the passive mode and returns the port of the data
+// connection. The address in the response of PASV is ignored, since it's
+// often wrong behind NAT.
+func (c *ftpConn) passive() (string, error) {
+	if _, msg, err := c.cmd(229, "EPSV"); err == nil {
+		// Entering Extended Passive Mode (|||port|)
+		i := strings.Index(msg, "(|||")
+		j := strings.LastIndex(msg, "|)")
+		if i >= 0 && j > i+4 {
+			return msg[i+4 : j], nil
+		}
+	}
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	i, j := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if i < 0 || j < i {
+		return "", fmt.Errorf("scheme: invalid PASV response: %q", msg)
+	}
+	parts := strings.Split(msg[i+1:j], ",")
+	if len(parts) != 6 {
+		return "", fmt.Errorf("scheme: invalid PASV response: %q", msg)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(parts[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(parts[5]))
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("scheme: invalid PASV response: %q", msg)
+	}
+	return strconv.Itoa(p1<<8 | p2), nil
+}
+
+// quit ends the session after the transfer on data is done. c is not
+// closed.
+func (c *ftpConn) quit() error {
+	c.nc.SetDeadline(time.Now().Add(c.timeout))
+	_, _, err := c.ReadResponse(2)
+	c.PrintfLine("QUIT")
+	return err
+}
+
+// ftpBody is the data connection of a transfer.
+type ftpBody struct {
+	net.Conn
+	c      *ftpConn
+	closed bool
+}
+
+// Close closes the data connection and the session.
+func (b *ftpBody) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	b.Conn.Close()
+	err := b.c.quit()
+	b.c.Close()
+	return err
+}
+
+// ftpError converts errors to those of crawler. Missing files and failed
+// logins are converted to statuses, which are classified by the status
+// policy. Transient FTP errors and network errors are retryable.
+func ftpError(err error) error {
+	if te, ok := err.(*textproto.Error); ok {
+		switch {
+		case te.Code == 550:
+			return crawler.ResponseStatusError(http.StatusNotFound)
+		case te.Code == 530:
+			return crawler.ResponseStatusError(http.StatusForbidden)
+		case te.Code >= 400 && te.Code < 500:
+			return crawler.RetryableError{Err: err}
+		}
+		return err
+	}
+	if _, ok := err.(net.Error); ok || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return crawler.RetryableError{Err: err}
+	}
+	return err
+}
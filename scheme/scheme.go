@@ -0,0 +1,122 @@
+// Package scheme provides handlers of file, ftp and data URLs, which can
+// be registered by crawler.RegisterScheme:
+//
+//	crawler.RegisterScheme("file", &scheme.File{Root: "/srv/docs"})
+//	crawler.RegisterScheme("ftp", &scheme.FTP{})
+//	crawler.RegisterScheme("data", scheme.Data{})
+//
+// Directories are served as HTML listings, so that the crawler follows
+// their entries like links in a page.
+package scheme
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/fanyang01/crawler"
+)
+
+// failure returns a response of the status of err if it's a status that
+// policy lets be handled, e.g., 404 of class crawler.StatusHandle for
+// reporting broken links. Otherwise, it returns the error of the status
+// given by policy, or err itself if it's not a status. If policy is nil,
+// crawler.DefaultStatusPolicy is used.
+func failure(
+	req *crawler.Request, policy *crawler.StatusPolicy, err error,
+) (*crawler.Response, error) {
+	code, ok := err.(crawler.ResponseStatusError)
+	if !ok {
+		return nil, err
+	}
+	if policy == nil {
+		policy = crawler.DefaultStatusPolicy
+	}
+	r := newResponse(req, nil, http.Header{}, 0, ioutil.NopCloser(bytes.NewReader(nil)))
+	r.StatusCode = int(code)
+	r.Status = strconv.Itoa(int(code)) + " " + http.StatusText(int(code))
+	if err = policy.Check(r.Response); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newResponse returns a successful response of req. If newURL is not nil,
+// the request is treated as redirected to it.
+func newResponse(
+	req *crawler.Request, newURL *url.URL, header http.Header,
+	length int64, body io.ReadCloser,
+) *crawler.Response {
+	hreq := req.Request
+	if newURL != nil {
+		copied := *hreq
+		copied.URL = newURL
+		hreq = &copied
+	}
+	if length >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(length, 10))
+	}
+	r := crawler.NewResponse()
+	r.Response = &http.Response{
+		Status:        "200 OK",
+		StatusCode:    200,
+		Proto:         "HTTP/1.0",
+		ProtoMajor:    1,
+		Header:        header,
+		ContentLength: length,
+		Body:          body,
+		Request:       hreq,
+	}
+	r.URL = req.URL
+	r.NewURL = hreq.URL
+	r.InitBody(body)
+	return r
+}
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><title>Index of {{.Dir}}</title></head><body>
+<h1>Index of {{.Dir}}</h1>
+<ul>{{range .Entries}}
+<li><a href="{{.Href}}">{{.Name}}</a></li>{{end}}
+</ul></body></html>
+`))
+
+type entry struct {
+	Name string
+	Href string
+}
+
+// listing renders a HTML page that links to the entries of dir. Names of
+// subdirectories end with "/".
+func listing(dir string, names []string) (header http.Header, length int64, body io.ReadCloser) {
+	data := struct {
+		Dir     string
+		Entries []entry
+	}{Dir: dir}
+	for _, name := range names {
+		data.Entries = append(data.Entries, entry{
+			Name: name,
+			Href: (&url.URL{Path: name}).String(),
+		})
+	}
+	var buf bytes.Buffer
+	listTemplate.Execute(&buf, data)
+	header = http.Header{}
+	header.Set("Content-Type", "text/html; charset=utf-8")
+	return header, int64(buf.Len()), ioutil.NopCloser(&buf)
+}
+
+// dirURL returns u with a trailing slash, so that relative links in the
+// listing are resolved in the directory.
+func dirURL(u *url.URL) *url.URL {
+	uu := *u
+	uu.Path += "/"
+	if uu.RawPath != "" {
+		uu.RawPath += "/"
+	}
+	return &uu
+}
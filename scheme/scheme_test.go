@@ -0,0 +1,263 @@
+package scheme
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/fanyang01/crawler"
+	"github.com/stretchr/testify/assert"
+)
+
+func get(c crawler.Client, u string) (*crawler.Response, string, error) {
+	hreq, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := c.Do(&crawler.Request{Request: hreq})
+	if err != nil {
+		return nil, "", err
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	return r, string(b), err
+}
+
+func TestFile(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "scheme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "docs", "api"), 0755)
+	os.MkdirAll(filepath.Join(dir, "site"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "docs", "a b.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "site", "index.html"), []byte("<p>index</p>"), 0644)
+
+	f := &File{Root: dir}
+	r, b, err := get(f, "file:///docs/a%20b.txt")
+	assert.NoError(err)
+	assert.Equal("hello", b)
+	assert.Equal("text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+	assert.Equal(int64(5), r.ContentLength)
+
+	r, b, err = get(f, "file:///docs")
+	assert.NoError(err)
+	assert.Equal("file:///docs/", r.NewURL.String())
+	assert.Contains(b, `<a href="a%20b.txt">a b.txt</a>`)
+	assert.Contains(b, `<a href="api/">api/</a>`)
+
+	_, b, err = get(f, "file:///site/")
+	assert.NoError(err)
+	assert.Equal("<p>index</p>", b)
+	f.NoIndex = true
+	_, b, _ = get(f, "file:///site/")
+	assert.Contains(b, "index.html")
+
+	_, _, err = get(f, "file:///missing")
+	assert.Equal(crawler.ResponseStatusError(404), err)
+	// The root can't be escaped.
+	_, _, err = get(f, "file:///../"+filepath.Base(dir)+"/docs/a%20b.txt")
+	assert.Error(err)
+
+	// A missing file is handled if the policy says so.
+	f.Policy = &crawler.StatusPolicy{
+		Classes: map[int]crawler.StatusClass{404: crawler.StatusHandle},
+	}
+	r, b, err = get(f, "file:///missing")
+	if assert.NoError(err) {
+		assert.Equal(404, r.StatusCode)
+		assert.Equal("", b)
+	}
+}
+
+func TestData(t *testing.T) {
+	assert := assert.New(t)
+	for _, v := range []struct{ url, typ, content string }{
+		{"data:,A%20brief%20note", "text/plain;charset=US-ASCII", "A brief note"},
+		{"data:;charset=utf-8,x", "text/plain;charset=utf-8", "x"},
+		{"data:text/html;base64,PGI+aGk8L2I+", "text/html", "<b>hi</b>"},
+		{"data:text/plain;base64,aGk", "text/plain", "hi"},
+		{"data:,what?%20why?", "text/plain;charset=US-ASCII", "what? why?"},
+		{"data:,a?", "text/plain;charset=US-ASCII", "a?"},
+	} {
+		r, b, err := get(Data{}, v.url)
+		if assert.NoError(err, v.url) {
+			assert.Equal(v.typ, r.Header.Get("Content-Type"))
+			assert.Equal(v.content, b)
+		}
+	}
+	_, _, err := get(Data{}, "data:text/plain;base64,%%%")
+	assert.Error(err)
+}
+
+// fakeFTP serves files in passive mode.
+func fakeFTP(t *testing.T, files map[string]string) net.Listener {
+	dirs := map[string]bool{"/": true}
+	for p := range files {
+		for d := path.Dir(p); d != "/"; d = path.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(nc net.Conn) {
+		defer nc.Close()
+		c := textproto.NewConn(nc)
+		var data net.Listener
+		transfer := func(content string) {
+			c.PrintfLine("150 Opening data connection")
+			if dc, err := data.Accept(); err == nil {
+				fmt.Fprint(dc, content)
+				dc.Close()
+			}
+			data.Close()
+			c.PrintfLine("226 Transfer complete")
+		}
+		c.PrintfLine("220 Ready")
+		for {
+			line, err := c.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg := line, ""
+			if i := strings.IndexByte(line, ' '); i >= 0 {
+				cmd, arg = line[:i], line[i+1:]
+			}
+			switch cmd {
+			case "USER":
+				c.PrintfLine("331 Password required")
+			case "PASS":
+				if arg == "wrong" {
+					c.PrintfLine("530 Login incorrect")
+				} else {
+					c.PrintfLine("230 Logged in")
+				}
+			case "TYPE":
+				c.PrintfLine("200 Type set")
+			case "CWD":
+				if dirs[arg] {
+					c.PrintfLine("250 OK")
+				} else {
+					c.PrintfLine("550 No such directory")
+				}
+			case "EPSV":
+				data, _ = net.Listen("tcp", "127.0.0.1:0")
+				_, port, _ := net.SplitHostPort(data.Addr().String())
+				c.PrintfLine("229 Entering Extended Passive Mode (|||%s|)", port)
+			case "RETR":
+				if content, ok := files[arg]; ok {
+					transfer(content)
+				} else {
+					data.Close()
+					c.PrintfLine("550 No such file")
+				}
+			case "LIST":
+				dir := strings.TrimSuffix(arg, "/")
+				var lines []string
+				for p := range files {
+					if path.Dir(p) == dir {
+						lines = append(lines, "-rw-r--r-- 1 1000 1000 5 Jan 1 00:00 "+path.Base(p))
+					}
+				}
+				for d := range dirs {
+					if d != "/" && path.Dir(d) == path.Clean("/"+dir) {
+						lines = append(lines, "drwxr-xr-x 2 1000 1000 4096 Jan 1 00:00 "+path.Base(d))
+					}
+				}
+				sort.Strings(lines)
+				transfer(strings.Join(lines, "\r\n") + "\r\n")
+			case "QUIT":
+				c.PrintfLine("221 Bye")
+				return
+			default:
+				c.PrintfLine("502 Not implemented")
+			}
+		}
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(nc)
+		}
+	}()
+	return ln
+}
+
+func TestFTP(t *testing.T) {
+	assert := assert.New(t)
+	ln := fakeFTP(t, map[string]string{
+		"/pub/hello.txt":     "hello",
+		"/pub/sub/world.txt": "world",
+	})
+	defer ln.Close()
+	base := "ftp://" + ln.Addr().String()
+	f := &FTP{}
+
+	r, b, err := get(f, base+"/pub/hello.txt")
+	assert.NoError(err)
+	assert.Equal("hello", b)
+	assert.Equal("text/plain; charset=utf-8", r.Header.Get("Content-Type"))
+
+	r, b, err = get(f, base+"/pub")
+	assert.NoError(err)
+	assert.Equal(base+"/pub/", r.NewURL.String())
+	assert.Contains(b, `<a href="hello.txt">hello.txt</a>`)
+	assert.Contains(b, `<a href="sub/">sub/</a>`)
+
+	_, _, err = get(f, base+"/pub/missing.txt")
+	assert.Equal(crawler.ResponseStatusError(404), err)
+	_, _, err = get(f, "ftp://user:wrong@"+ln.Addr().String()+"/pub/hello.txt")
+	assert.Equal(crawler.RetryableError{Err: crawler.ResponseStatusError(403)}, err)
+
+	// Commands can't be injected by the path or credentials.
+	_, _, err = get(f, base+"/pub/a%0D%0ADELE%20hello.txt")
+	assert.Equal(ErrControlChar, err)
+	_, _, err = get(f, "ftp://user%0D%0ADELE%20x:p@"+ln.Addr().String()+"/pub/")
+	assert.Equal(ErrControlChar, err)
+	_, _, err = get(f, "ftp://user:p%0A@"+ln.Addr().String()+"/pub/")
+	assert.Equal(ErrControlChar, err)
+
+	f.Policy = &crawler.StatusPolicy{
+		Classes: map[int]crawler.StatusClass{
+			404: crawler.StatusHandle,
+			403: crawler.StatusFail,
+		},
+	}
+	r, b, err = get(f, base+"/pub/missing.txt")
+	if assert.NoError(err) {
+		assert.Equal(404, r.StatusCode)
+		assert.Equal("", b)
+	}
+	_, _, err = get(f, "ftp://user:wrong@"+ln.Addr().String()+"/pub/hello.txt")
+	assert.Equal(crawler.ResponseStatusError(403), err)
+}
+
+func TestParseList(t *testing.T) {
+	assert := assert.New(t)
+	for line, name := range map[string]string{
+		"drwxr-xr-x  2 1000 1000 4096 Jan  1 00:00 my dir": "my dir/",
+		"-rw-r--r--  1 ftp  ftp    12 Jan  1  2020 a.txt":  "a.txt",
+		"lrwxrwxrwx  1 ftp  ftp     3 Jan  1 00:00 l -> x": "l",
+		"01-16-02  11:14AM       <DIR>          docs":      "docs/",
+		"01-16-02  11:14AM                 1024 b c.txt":   "b c.txt",
+		"drwxr-xr-x  2 ftp  ftp  4096 Jan  1 00:00 ..":     "",
+		"total 8": "",
+	} {
+		got, _ := parseList(line)
+		assert.Equal(name, got, line)
+	}
+}
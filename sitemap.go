@@ -0,0 +1,186 @@
+package crawler
+
+import (
+	"io"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/fanyang01/crawler/sitemap"
+)
+
+// sitemapWorkers is the maximum number of sites whose sitemaps are walked
+// at the same time.
+const sitemapWorkers = 4
+
+// sitemapFinder discovers sitemaps of newly seen sites and enqueues URLs
+// listed in them.
+type sitemapFinder struct {
+	cw      *Crawler
+	mu      sync.Mutex
+	seen    map[string]bool
+	sem     chan struct{}
+	pending int32 // number of sites being discovered
+	// done is notified when a discovery finishes, so that the scheduler
+	// can check whether the crawler has finished.
+	done chan struct{}
+}
+
+func (cw *Crawler) newSitemapFinder() *sitemapFinder {
+	return &sitemapFinder{
+		cw:   cw,
+		seen: make(map[string]bool),
+		sem:  make(chan struct{}, sitemapWorkers),
+		done: make(chan struct{}, 1),
+	}
+}
+
+// Busy reports whether some sites are being discovered.
+func (f *sitemapFinder) Busy() bool {
+	return atomic.LoadInt32(&f.pending) > 0
+}
+
+// sitemapURLs returns locations of sitemaps of the site of u, which are
+// listed in robots.txt, and /sitemap.xml.
+func (f *sitemapFinder) sitemapURLs(u *url.URL) (urls []*url.URL) {
+	seen := map[string]bool{}
+	add := func(s string) {
+		if seen[s] {
+			return
+		}
+		seen[s] = true
+		if u, err := url.Parse(s); err == nil {
+			urls = append(urls, u)
+		}
+	}
+	for _, s := range f.cw.robots.Get(u).Sitemaps {
+		add(s)
+	}
+	add((&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/sitemap.xml"}).String())
+	return
+}
+
+// Discover walks the sitemaps of the site of u in background if the site
+// has not been seen. No more than sitemapWorkers sites are walked at the
+// same time. URLs in the sitemaps are stored with depth+1 and sent to the
+// scheduler.
+func (f *sitemapFinder) Discover(u *url.URL, depth int) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	key := u.Scheme + "://" + u.Host
+	f.mu.Lock()
+	seen := f.seen[key]
+	f.seen[key] = true
+	f.mu.Unlock()
+	if seen {
+		return
+	}
+	site := *u
+	atomic.AddInt32(&f.pending, 1)
+	go func() {
+		defer func() {
+			atomic.AddInt32(&f.pending, -1)
+			select {
+			case f.done <- struct{}{}:
+			default:
+			}
+		}()
+		select {
+		case f.sem <- struct{}{}:
+			defer func() { <-f.sem }()
+		case <-f.cw.quit:
+			return
+		}
+		f.discover(&site, depth)
+	}()
+}
+
+func (f *sitemapFinder) discover(u *url.URL, depth int) {
+	var (
+		queue   = f.sitemapURLs(u)
+		visited = map[string]bool{}
+	)
+	for len(queue) > 0 {
+		sm := queue[0]
+		queue = queue[1:]
+		if visited[sm.String()] {
+			continue
+		}
+		visited[sm.String()] = true
+		if f.cw.opt.ObeyRobots && !f.cw.robots.Allow(sm) {
+			continue
+		}
+		children, ok := f.walk(u, sm, depth, f.cw.quit)
+		if !ok {
+			return
+		}
+		queue = append(queue, children...)
+	}
+}
+
+// walk fetches a sitemap and enqueues the URLs in it. Locations of
+// sitemaps are returned if it's a sitemap index.
+func (f *sitemapFinder) walk(
+	site, sm *url.URL, depth int, quit <-chan struct{},
+) (children []*url.URL, ok bool) {
+	var (
+		cw     = f.cw
+		logger = cw.logger.New("sitemap", sm)
+	)
+	ok = true
+	status, err := cw.get(sm, func(body io.Reader) error {
+		d, err := sitemap.NewDecoder(body)
+		if err != nil {
+			return err
+		}
+		for {
+			entry, err := d.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			loc := entry.Loc
+			if err := cw.normalize(&loc); err != nil {
+				continue
+			}
+			// Only URLs and sitemaps of the same site are trusted.
+			if loc.Scheme != site.Scheme || loc.Host != site.Host {
+				continue
+			}
+			if d.Format() == sitemap.FormatIndex {
+				children = append(children, &loc)
+				continue
+			}
+			entry.Loc = loc
+			AddSitemapEntry(cw.ctrl, entry)
+			if ok, err = f.enqueue(&loc, depth+1, quit); err != nil || !ok {
+				return err
+			}
+		}
+	})
+	switch {
+	case err == nil:
+	case status == 404 && sm.Path == "/sitemap.xml":
+		logger.Debug("no sitemap.xml")
+	default:
+		logger.Error("fetch sitemap", "err", err)
+	}
+	return
+}
+
+func (f *sitemapFinder) enqueue(u *url.URL, depth int, quit <-chan struct{}) (bool, error) {
+	if ok, err := f.cw.store.PutNX(&URL{
+		URL:   *u,
+		Depth: depth,
+	}); err != nil || !ok {
+		return true, err
+	}
+	select {
+	case f.cw.scheduler.NewIn <- u:
+		return true, nil
+	case <-quit:
+		return false, nil
+	}
+}
@@ -0,0 +1,285 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Limits defined by the sitemap protocol.
+const (
+	MaxURLs = 50000    // maximum number of URLs in a sitemap
+	MaxSize = 50 << 20 // maximum uncompressed size of a sitemap
+)
+
+var (
+	ErrTooManyURLs   = errors.New("sitemap: too many URLs")
+	ErrTooLarge      = errors.New("sitemap: file too large")
+	ErrUnknownFormat = errors.New("sitemap: unknown format")
+)
+
+// Format is the format of a sitemap.
+type Format int
+
+const (
+	FormatUnknown Format = iota
+	FormatURLSet         // <urlset>
+	FormatIndex          // <sitemapindex>
+	FormatText           // one URL per line
+	FormatRSS            // RSS 2.0
+	FormatAtom           // Atom 1.0
+)
+
+func (f Format) String() string {
+	switch f {
+	case FormatURLSet:
+		return "urlset"
+	case FormatIndex:
+		return "sitemapindex"
+	case FormatText:
+		return "text"
+	case FormatRSS:
+		return "rss"
+	case FormatAtom:
+		return "atom"
+	}
+	return "unknown"
+}
+
+// limitReader returns ErrTooLarge after reading n bytes.
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
+
+// Decoder reads URLs from a sitemap one by one. Gzipped input is detected
+// and decompressed automatically.
+type Decoder struct {
+	format Format
+	xd     *xml.Decoder
+	text   *bufio.Scanner
+	elem   string // name of elements containing URLs
+	n      int
+	err    error
+}
+
+// NewDecoder creates a decoder reading from r. The format of the sitemap
+// is detected from the content. ErrUnknownFormat is returned if it's not
+// a sitemap.
+func NewDecoder(r io.Reader) (*Decoder, error) {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		br = bufio.NewReader(zr)
+	}
+	br = bufio.NewReader(&limitReader{r: br, n: MaxSize})
+
+	d := &Decoder{}
+	if isXML(br) {
+		d.xd = xml.NewDecoder(br)
+		d.xd.Strict = false
+		d.xd.CharsetReader = charset.NewReaderLabel
+		return d, d.detect()
+	}
+	d.format = FormatText
+	d.text = bufio.NewScanner(br)
+	return d, nil
+}
+
+// isXML reports whether the first non-space character is '<'.
+func isXML(br *bufio.Reader) bool {
+	for n := 512; ; n *= 2 {
+		b, err := br.Peek(n)
+		if t := bytes.TrimLeft(b, " \t\r\n\ufeff"); len(t) > 0 {
+			return t[0] == '<'
+		}
+		if err != nil {
+			return false
+		}
+	}
+}
+
+func (d *Decoder) detect() error {
+	for {
+		tok, err := d.xd.Token()
+		if err != nil {
+			if err == io.EOF {
+				err = ErrUnknownFormat
+			}
+			return err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "urlset":
+			d.format, d.elem = FormatURLSet, "url"
+		case "sitemapindex":
+			d.format, d.elem = FormatIndex, "sitemap"
+		case "rss":
+			d.format, d.elem = FormatRSS, "item"
+		case "feed":
+			d.format, d.elem = FormatAtom, "entry"
+		default:
+			return ErrUnknownFormat
+		}
+		return nil
+	}
+}
+
+// Format returns the format of the sitemap.
+func (d *Decoder) Format() Format { return d.format }
+
+// Next returns the next URL in the sitemap. For a sitemap index, each URL
+// is the location of a sitemap. io.EOF is returned at the end of input.
+// ErrTooManyURLs and ErrTooLarge are returned if the sitemap exceeds the
+// limits of the protocol.
+func (d *Decoder) Next() (u *URL, err error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.format == FormatText {
+		u, err = d.nextText()
+	} else {
+		u, err = d.nextXML()
+	}
+	if err == nil {
+		if d.n++; d.n > MaxURLs {
+			u, err = nil, ErrTooManyURLs
+		}
+	}
+	if err != nil {
+		d.err = err
+	}
+	return
+}
+
+func (d *Decoder) nextText() (*URL, error) {
+	for d.text.Scan() {
+		line := strings.TrimSpace(d.text.Text())
+		if line == "" {
+			continue
+		}
+		if u, err := url.Parse(line); err == nil && u.IsAbs() {
+			return &URL{Loc: *u}, nil
+		}
+	}
+	if err := d.text.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func (d *Decoder) nextXML() (*URL, error) {
+	for {
+		tok, err := d.xd.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != d.elem {
+			continue
+		}
+		u := &URL{}
+		switch d.format {
+		case FormatURLSet:
+			err = d.xd.DecodeElement(u, &start)
+		case FormatIndex:
+			err = d.decodeIndex(u, &start)
+		case FormatRSS:
+			err = d.decodeRSS(u, &start)
+		case FormatAtom:
+			err = d.decodeAtom(u, &start)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if u.Loc.String() == "" {
+			continue
+		}
+		return u, nil
+	}
+}
+
+// setLoc sets the location of u. An invalid location is left empty, so
+// that the entry is skipped.
+func setLoc(u *URL, s string) {
+	if p, err := url.Parse(strings.TrimSpace(s)); err == nil {
+		u.Loc = *p
+	}
+}
+
+func (d *Decoder) decodeIndex(u *URL, start *xml.StartElement) error {
+	var tmp struct {
+		Loc          string `xml:"loc"`
+		LastModified string `xml:"lastmod"`
+	}
+	if err := d.xd.DecodeElement(&tmp, start); err != nil {
+		return err
+	}
+	u.LastModified, _ = parseTime(tmp.LastModified)
+	setLoc(u, tmp.Loc)
+	return nil
+}
+
+func (d *Decoder) decodeRSS(u *URL, start *xml.StartElement) error {
+	var tmp struct {
+		Link    string `xml:"link"`
+		PubDate string `xml:"pubDate"`
+	}
+	if err := d.xd.DecodeElement(&tmp, start); err != nil {
+		return err
+	}
+	// Ignore malformed dates, which are common in feeds.
+	u.LastModified, _ = parseTime(tmp.PubDate)
+	setLoc(u, tmp.Link)
+	return nil
+}
+
+func (d *Decoder) decodeAtom(u *URL, start *xml.StartElement) error {
+	var tmp struct {
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Updated string `xml:"updated"`
+	}
+	if err := d.xd.DecodeElement(&tmp, start); err != nil {
+		return err
+	}
+	u.LastModified, _ = parseTime(tmp.Updated)
+	for _, link := range tmp.Links {
+		if link.Rel == "" || link.Rel == "alternate" {
+			setLoc(u, link.Href)
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeAll(r io.Reader) (Format, []*URL, error) {
+	d, err := NewDecoder(r)
+	if err != nil {
+		return FormatUnknown, nil, err
+	}
+	var urls []*URL
+	for {
+		u, err := d.Next()
+		if err == io.EOF {
+			return d.Format(), urls, nil
+		} else if err != nil {
+			return d.Format(), urls, err
+		}
+		urls = append(urls, u)
+	}
+}
+
+func TestDecodeURLSet(t *testing.T) {
+	assert := assert.New(t)
+	XML := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"
+	xmlns:news="http://www.google.com/schemas/sitemap-news/0.9"
+	xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"
+	xmlns:video="http://www.google.com/schemas/sitemap-video/1.1">
+<url>
+	<loc>http://www.example.com/news.html</loc>
+	<news:news>
+		<news:publication>
+			<news:name>The Example Times</news:name>
+			<news:language>en</news:language>
+		</news:publication>
+		<news:publication_date>2008-12-23</news:publication_date>
+		<news:title>Companies A, B in Merger Talks</news:title>
+	</news:news>
+	<image:image>
+		<image:loc>http://example.com/image.jpg</image:loc>
+	</image:image>
+	<image:image>
+		<image:loc>http://example.com/photo.jpg</image:loc>
+	</image:image>
+	<video:video>
+		<video:thumbnail_loc>http://www.example.com/thumb.jpg</video:thumbnail_loc>
+		<video:title>Grilling steaks</video:title>
+		<video:content_loc>http://www.example.com/video.mp4</video:content_loc>
+		<video:duration>600</video:duration>
+	</video:video>
+</url>
+<url><loc> http://www.example.com/plain </loc></url>
+</urlset>`
+	format, urls, err := decodeAll(strings.NewReader(XML))
+	assert.NoError(err)
+	assert.Equal(FormatURLSet, format)
+	assert.Equal(2, len(urls))
+
+	u := urls[0]
+	assert.Equal("http://www.example.com/news.html", u.Loc.String())
+	assert.Equal("The Example Times", u.News.Publication.Name)
+	assert.Equal("en", u.News.Publication.Language)
+	assert.Equal(time.Date(2008, 12, 23, 0, 0, 0, 0, time.UTC), u.News.PublicationDate.Time)
+	assert.Equal(2, len(u.Images))
+	assert.Equal("http://example.com/photo.jpg", u.Images[1].Loc)
+	assert.Equal(1, len(u.Videos))
+	assert.Equal(600, u.Videos[0].Duration)
+	assert.Equal("Grilling steaks", u.Videos[0].Title)
+
+	assert.Equal("http://www.example.com/plain", urls[1].Loc.String())
+	assert.Nil(urls[1].News)
+}
+
+func TestDecodeBadEntry(t *testing.T) {
+	assert := assert.New(t)
+	XML := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url>
+	<loc>http://www.example.com/a</loc>
+	<changefreq>daily</changefreq>
+</url>
+<url>
+	<loc>http://www.example.com/b</loc>
+	<changefreq>sometimes</changefreq>
+	<lastmod>yesterday</lastmod>
+	<priority>high</priority>
+</url>
+<url>
+	<loc>http://www.example.com/c</loc>
+	<lastmod>2005-01-01</lastmod>
+</url>
+</urlset>`
+	format, urls, err := decodeAll(strings.NewReader(XML))
+	assert.NoError(err)
+	assert.Equal(FormatURLSet, format)
+	assert.Equal(3, len(urls))
+	assert.Equal(24*time.Hour, urls[0].ChangeFreq)
+	assert.Equal("http://www.example.com/b", urls[1].Loc.String())
+	assert.Equal(time.Duration(0), urls[1].ChangeFreq)
+	assert.True(urls[1].LastModified.IsZero())
+	assert.Equal(0.0, urls[1].Priority)
+	assert.Equal("http://www.example.com/c", urls[2].Loc.String())
+	assert.Equal(time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC), urls[2].LastModified)
+}
+
+func TestDecodeIndexGzip(t *testing.T) {
+	assert := assert.New(t)
+	XML := `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap>
+	<loc>http://www.example.com/sitemap1.xml.gz</loc>
+	<lastmod>2004-10-01T18:23:17+00:00</lastmod>
+</sitemap>
+<sitemap>
+	<loc>http://www.example.com/sitemap2.xml.gz</loc>
+</sitemap>
+</sitemapindex>`
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(XML))
+	w.Close()
+
+	format, urls, err := decodeAll(&buf)
+	assert.NoError(err)
+	assert.Equal(FormatIndex, format)
+	assert.Equal(2, len(urls))
+	assert.Equal("http://www.example.com/sitemap1.xml.gz", urls[0].Loc.String())
+	assert.Equal(time.Date(2004, 10, 1, 18, 23, 17, 0, time.UTC), urls[0].LastModified.UTC())
+	assert.True(urls[1].LastModified.IsZero())
+}
+
+func TestDecodeText(t *testing.T) {
+	assert := assert.New(t)
+	format, urls, err := decodeAll(strings.NewReader(`
+http://www.example.com/a
+
+  http://www.example.com/b
+not-a-url
+`))
+	assert.NoError(err)
+	assert.Equal(FormatText, format)
+	assert.Equal(2, len(urls))
+	assert.Equal("http://www.example.com/b", urls[1].Loc.String())
+}
+
+func TestDecodeFeed(t *testing.T) {
+	assert := assert.New(t)
+	RSS := `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+	<title>Example</title>
+	<link>http://www.example.com/</link>
+	<item>
+		<title>A</title>
+		<link>http://www.example.com/a</link>
+		<pubDate>Tue, 10 Jun 2003 04:00:00 GMT</pubDate>
+	</item>
+	<item>
+		<title>No link</title>
+	</item>
+</channel>
+</rss>`
+	format, urls, err := decodeAll(strings.NewReader(RSS))
+	assert.NoError(err)
+	assert.Equal(FormatRSS, format)
+	assert.Equal(1, len(urls))
+	assert.Equal("http://www.example.com/a", urls[0].Loc.String())
+	assert.Equal(time.Date(2003, 6, 10, 4, 0, 0, 0, time.UTC), urls[0].LastModified.UTC())
+
+	Atom := `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<link href="http://example.org/"/>
+	<entry>
+		<link rel="edit" href="http://example.org/edit/1"/>
+		<link href="http://example.org/2003/12/13/atom03"/>
+		<updated>2003-12-13T18:30:02Z</updated>
+	</entry>
+</feed>`
+	format, urls, err = decodeAll(strings.NewReader(Atom))
+	assert.NoError(err)
+	assert.Equal(FormatAtom, format)
+	assert.Equal(1, len(urls))
+	assert.Equal("http://example.org/2003/12/13/atom03", urls[0].Loc.String())
+	assert.Equal(time.Date(2003, 12, 13, 18, 30, 2, 0, time.UTC), urls[0].LastModified)
+}
+
+func TestDecodeLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	_, _, err := decodeAll(strings.NewReader(`<html></html>`))
+	assert.Equal(ErrUnknownFormat, err)
+
+	var buf bytes.Buffer
+	for i := 0; i <= MaxURLs; i++ {
+		fmt.Fprintf(&buf, "http://www.example.com/%d\n", i)
+	}
+	_, urls, err := decodeAll(&buf)
+	assert.Equal(ErrTooManyURLs, err)
+	assert.Equal(MaxURLs, len(urls))
+
+	buf.Reset()
+	buf.WriteString("http://www.example.com/\n")
+	buf.Write(bytes.Repeat([]byte{'\n'}, MaxSize))
+	_, urls, err = decodeAll(&buf)
+	assert.Equal(ErrTooLarge, err)
+	assert.Equal(1, len(urls))
+}
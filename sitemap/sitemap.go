@@ -1,92 +1,116 @@
-// Package sitemap provides method to unmarshal sitemaps in XML format.
+// Package sitemap provides methods to decode sitemaps in XML, text, RSS
+// and Atom formats.
 package sitemap
 
 import (
 	"encoding/xml"
 	"errors"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Never is the change frequency of archived URLs.
+const Never time.Duration = 1<<63 - 1
+
 type Freq struct {
 	time.Duration
 }
 
 func (freq *Freq) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	var s string
-	if err := d.DecodeElement(&s, &start); err != nil {
+	var err error
+	if err = d.DecodeElement(&s, &start); err != nil {
 		return err
 	}
-	switch s {
+	freq.Duration, err = parseFreq(s)
+	return err
+}
+
+func parseFreq(s string) (time.Duration, error) {
+	switch strings.TrimSpace(s) {
 	case "":
-		*freq = Freq{0}
+		return 0, nil
 	case "always":
 		// Use second as the minimum unit of change frequence
-		*freq = Freq{time.Second}
+		return time.Second, nil
 	case "hourly":
-		*freq = Freq{time.Hour}
+		return time.Hour, nil
 	case "daily":
-		*freq = Freq{time.Hour * 24}
+		return time.Hour * 24, nil
 	case "weekly":
-		*freq = Freq{time.Hour * 24 * 7}
+		return time.Hour * 24 * 7, nil
 	case "monthly":
-		*freq = Freq{time.Hour * 24 * 30}
+		return time.Hour * 24 * 30, nil
 	case "yearly":
-		*freq = Freq{time.Hour * 24 * 365}
+		return time.Hour * 24 * 365, nil
 	case "never":
-		// time.Duration is int64
-		*freq = Freq{1<<63 - 1}
-	default:
-		return errors.New("invalid frequence: " + s)
+		return Never, nil
 	}
-	return nil
+	return 0, errors.New("invalid frequence: " + s)
 }
 
 type Time struct {
 	time.Time
 }
 
-func (t *Time) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	layouts := []string{
-		"2006-01-02",
-		"2006-01-02T15:04Z07:00",
-		time.RFC3339,
-		time.RFC3339Nano,
-		"2006-01",
-		"2006",
+var layouts = []string{
+	"2006-01-02",
+	"2006-01-02T15:04Z07:00",
+	time.RFC3339,
+	time.RFC3339Nano,
+	"2006-01",
+	"2006",
+	// RSS
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC822Z,
+	time.RFC822,
+}
+
+func parseTime(s string) (t time.Time, err error) {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err = time.Parse(layout, s); err == nil {
+			break
+		}
 	}
+	return
+}
+
+func (t *Time) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	var s string
 	var err error
 	if err = d.DecodeElement(&s, &start); err != nil {
 		return err
 	}
-	for _, layout := range layouts {
-		if t.Time, err = time.Parse(layout, s); err == nil {
-			break
-		}
-	}
+	t.Time, err = parseTime(s)
 	return err
 }
 
 func (u *URL) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	var tmp struct {
 		Loc          string  `xml:"loc"`
-		Priority     float64 `xml:"priority"`
-		ChangeFreq   Freq    `xml:"changefreq"`
-		LastModified Time    `xml:"lastmod"`
-	}
-	var err error
-	if err = d.DecodeElement(&tmp, &start); err != nil {
-		return err
+		Priority     string  `xml:"priority"`
+		ChangeFreq   string  `xml:"changefreq"`
+		LastModified string  `xml:"lastmod"`
+		News         *News   `xml:"news"`
+		Images       []Image `xml:"image"`
+		Videos       []Video `xml:"video"`
 	}
-	var p *url.URL
-	if p, err = url.Parse(tmp.Loc); err != nil {
+	if err := d.DecodeElement(&tmp, &start); err != nil {
 		return err
 	}
-	u.Loc = *p
-	u.LastModified = tmp.LastModified.Time
-	u.ChangeFreq = tmp.ChangeFreq.Duration
-	u.Priority = tmp.Priority
+	// A malformed field is left zero rather than failing the sitemap,
+	// and an entry without valid location is skipped by Decoder.
+	setLoc(u, tmp.Loc)
+	u.LastModified, _ = parseTime(tmp.LastModified)
+	u.ChangeFreq, _ = parseFreq(tmp.ChangeFreq)
+	u.Priority, _ = strconv.ParseFloat(strings.TrimSpace(tmp.Priority), 64)
+	u.News = tmp.News
+	u.Images = tmp.Images
+	u.Videos = tmp.Videos
 	return nil
 }
 
@@ -95,6 +119,43 @@ type URL struct {
 	Priority     float64
 	ChangeFreq   time.Duration
 	LastModified time.Time
+
+	// Extensions
+	News   *News
+	Images []Image
+	Videos []Video
+}
+
+// News is the Google news extension of a URL.
+type News struct {
+	Publication struct {
+		Name     string `xml:"name"`
+		Language string `xml:"language"`
+	} `xml:"publication"`
+	PublicationDate Time   `xml:"publication_date"`
+	Title           string `xml:"title"`
+	Keywords        string `xml:"keywords"`
+}
+
+// Image is the Google image extension of a URL.
+type Image struct {
+	Loc         string `xml:"loc"`
+	Caption     string `xml:"caption"`
+	Title       string `xml:"title"`
+	GeoLocation string `xml:"geo_location"`
+	License     string `xml:"license"`
+}
+
+// Video is the Google video extension of a URL.
+type Video struct {
+	ThumbnailLoc    string `xml:"thumbnail_loc"`
+	Title           string `xml:"title"`
+	Description     string `xml:"description"`
+	ContentLoc      string `xml:"content_loc"`
+	PlayerLoc       string `xml:"player_loc"`
+	Duration        int    `xml:"duration"` // in seconds
+	PublicationDate Time   `xml:"publication_date"`
+	FamilyFriendly  string `xml:"family_friendly"`
 }
 
 type Sitemap struct {
@@ -0,0 +1,197 @@
+// Package sitemapctrl provides a controller that schedules URLs using the
+// priority, change frequency and last modification time found in sitemaps.
+package sitemapctrl
+
+import (
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/sitemap"
+	"github.com/fanyang01/crawler/urlx"
+)
+
+// DefaultPriority is the priority of a URL that is listed in a sitemap
+// without one, as defined by the sitemap protocol.
+const DefaultPriority = 0.5
+
+// DefaultMaxEntries is the default of Controller.MaxEntries.
+const DefaultMaxEntries = 1 << 20
+
+// MaxScore is the score of a URL with priority 1.0.
+const MaxScore = 1000
+
+// DefaultInterval is the interval to check again a URL whose lastmod has
+// not moved, if it has no change frequency.
+const DefaultInterval = 24 * time.Hour
+
+// Controller wraps a crawler.Controller. URLs listed in the added sitemaps
+// are scored by their priority and revisited by their change frequency.
+// A URL whose lastmod has not moved since the last visit is not fetched,
+// but checked again after its change frequency.
+//
+// Whether a URL should be revisited is still decided by the wrapped
+// controller, except that a URL whose change frequency is "never" is done
+// after the first visit.
+//
+// Controller implements crawler.SitemapReceiver, so sitemaps found by
+// crawler.Option.SitemapDiscovery are added automatically.
+type Controller struct {
+	crawler.Forward
+	// Normalize is used to normalize sitemap locations so that they
+	// match URLs in the crawler. If nil, urlx.Normalize is used.
+	Normalize func(*url.URL) error
+	// MaxEntries bounds the number of sitemap entries kept in memory.
+	// When it's reached, arbitrary entries are dropped to make room, and
+	// their URLs are scheduled by the wrapped controller alone. Zero
+	// means DefaultMaxEntries.
+	MaxEntries int
+
+	mu sync.RWMutex
+	m  map[string]*sitemap.URL
+}
+
+// New creates a sitemap controller wrapping ctrl.
+func New(ctrl crawler.Controller) *Controller {
+	if ctrl == nil {
+		ctrl = crawler.NopController{}
+	}
+	return &Controller{
+		Forward: crawler.Forward{Controller: ctrl},
+		m:       make(map[string]*sitemap.URL),
+	}
+}
+
+func (c *Controller) key(u *url.URL) string {
+	normalize := c.Normalize
+	if normalize == nil {
+		normalize = urlx.Normalize
+	}
+	uu := *u
+	if err := normalize(&uu); err != nil {
+		return u.String()
+	}
+	return uu.String()
+}
+
+func (c *Controller) maxEntries() int {
+	if c.MaxEntries > 0 {
+		return c.MaxEntries
+	}
+	return DefaultMaxEntries
+}
+
+// Add adds an entry of a sitemap. It replaces the previous entry with the
+// same location. Only the fields used for scheduling are kept, i.e., the
+// extensions are dropped. The entry is also passed to the wrapped
+// controller if it's a crawler.SitemapReceiver.
+func (c *Controller) Add(entry *sitemap.URL) {
+	k := c.key(&entry.Loc)
+	e := &sitemap.URL{
+		Loc:          entry.Loc,
+		Priority:     entry.Priority,
+		ChangeFreq:   entry.ChangeFreq,
+		LastModified: entry.LastModified,
+	}
+	c.mu.Lock()
+	if _, ok := c.m[k]; !ok {
+		for kk := range c.m {
+			if len(c.m) < c.maxEntries() {
+				break
+			}
+			delete(c.m, kk)
+		}
+	}
+	c.m[k] = e
+	c.mu.Unlock()
+	crawler.AddSitemapEntry(c.Controller, entry)
+}
+
+// AddSitemap adds all entries of sm.
+func (c *Controller) AddSitemap(sm *sitemap.Sitemap) {
+	for i := range sm.URLSet {
+		c.Add(&sm.URLSet[i])
+	}
+}
+
+// Lookup returns the sitemap entry of u.
+func (c *Controller) Lookup(u *url.URL) (entry *sitemap.URL, ok bool) {
+	k := c.key(u)
+	c.mu.RLock()
+	entry, ok = c.m[k]
+	c.mu.RUnlock()
+	return
+}
+
+// Score maps the priority of entry to a ticket score in [0, MaxScore]. An
+// entry without a positive priority has DefaultPriority.
+func Score(entry *sitemap.URL) int {
+	p := entry.Priority
+	if p <= 0 {
+		p = DefaultPriority
+	} else if p > 1 {
+		p = 1
+	}
+	return int(p * MaxScore)
+}
+
+// Prepare implements crawler.Controller. A request is skipped if the URL
+// has been visited and its lastmod is not after the last visit. The URL
+// is checked again after its change frequency, or DefaultInterval, when
+// the sitemap may have been updated.
+func (c *Controller) Prepare(req *crawler.Request) {
+	c.Controller.Prepare(req)
+	entry, ok := c.Lookup(req.URL)
+	if !ok || entry.LastModified.IsZero() || req.Context() == nil {
+		return
+	}
+	last, err := req.Context().LastTime()
+	if err != nil || last.IsZero() {
+		return
+	}
+	if !entry.LastModified.After(last) {
+		d := entry.ChangeFreq
+		if d <= 0 || d == sitemap.Never {
+			d = DefaultInterval
+		}
+		req.Skip(crawler.Ticket{At: time.Now().Add(d), Score: Score(entry)})
+	}
+}
+
+// Sched implements crawler.Controller.
+func (c *Controller) Sched(r *crawler.Response, u *url.URL) crawler.Ticket {
+	return c.score(u, c.Controller.Sched(r, u))
+}
+
+// SchedLink implements crawler.LinkScheduler. It's like Sched, but calls
+// crawler.SchedLink with the wrapped controller.
+func (c *Controller) SchedLink(r *crawler.Response, link *crawler.Link) crawler.Ticket {
+	return c.score(link.URL, crawler.SchedLink(c.Controller, r, link))
+}
+
+func (c *Controller) score(u *url.URL, t crawler.Ticket) crawler.Ticket {
+	if entry, ok := c.Lookup(u); ok {
+		t.Score = Score(entry)
+	}
+	return t
+}
+
+// Resched implements crawler.Controller.
+func (c *Controller) Resched(r *crawler.Response) (done bool, t crawler.Ticket) {
+	if done, t = c.Controller.Resched(r); done {
+		return
+	}
+	entry, ok := c.Lookup(r.URL)
+	if !ok {
+		return
+	}
+	if entry.ChangeFreq == sitemap.Never {
+		return true, t
+	}
+	t.Score = Score(entry)
+	if entry.ChangeFreq > 0 {
+		t.At = r.Timestamp.Add(entry.ChangeFreq)
+	}
+	return
+}
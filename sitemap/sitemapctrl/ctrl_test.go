@@ -0,0 +1,181 @@
+package sitemapctrl
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/sitemap"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ crawler.Controller       = &Controller{}
+	_ crawler.LinkHandler      = &Controller{}
+	_ crawler.LinkAccepter     = &Controller{}
+	_ crawler.LinkScheduler    = &Controller{}
+	_ crawler.SitemapReceiver  = &Controller{}
+	_ crawler.ResponseAccepter = &Controller{}
+	_ crawler.LinkHandler      = &Recorder{}
+	_ crawler.LinkAccepter     = &Recorder{}
+	_ crawler.LinkScheduler    = &Recorder{}
+	_ crawler.SitemapReceiver  = &Recorder{}
+	_ crawler.ResponseAccepter = &Recorder{}
+)
+
+type foreverController struct {
+	crawler.NopController
+}
+
+func (foreverController) Resched(_ *crawler.Response) (bool, crawler.Ticket) {
+	return false, crawler.Ticket{}
+}
+
+func mustParse(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestSchedule(t *testing.T) {
+	assert := assert.New(t)
+	var cnt int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&cnt, 1)
+		fmt.Fprint(w, "<html></html>")
+	}))
+	defer ts.Close()
+
+	var sm sitemap.Sitemap
+	assert.NoError(xml.Unmarshal([]byte(fmt.Sprintf(`
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url>
+	<loc>%s/</loc>
+	<lastmod>2005-01-01</lastmod>
+	<changefreq>always</changefreq>
+	<priority>0.8</priority>
+</url>
+<url>
+	<loc>%s/archive</loc>
+	<changefreq>never</changefreq>
+</url>
+</urlset>`, ts.URL, ts.URL)), &sm))
+
+	ctrl := New(foreverController{})
+	ctrl.AddSitemap(&sm)
+
+	assert.Equal(800, ctrl.Sched(nil, mustParse(ts.URL+"/")).Score)
+	assert.Equal(500, ctrl.Sched(nil, mustParse(ts.URL+"/archive")).Score)
+	assert.Equal(0, ctrl.Sched(nil, mustParse(ts.URL+"/unknown")).Score)
+
+	now := time.Now()
+	done, ticket := ctrl.Resched(&crawler.Response{URL: mustParse(ts.URL + "/"), Timestamp: now})
+	assert.False(done)
+	assert.Equal(now.Add(time.Second), ticket.At)
+	done, _ = ctrl.Resched(&crawler.Response{URL: mustParse(ts.URL + "/archive"), Timestamp: now})
+	assert.True(done)
+
+	// The page is not modified after the first visit, so it should not be
+	// fetched again, though it is still checked after its change frequency.
+	opt := *crawler.DefaultOption
+	opt.MinDelay = 0
+	store := crawler.NewMemStore()
+	cw := crawler.New(&crawler.Config{
+		Controller: ctrl,
+		Store:      store,
+		Option:     &opt,
+	})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	time.Sleep(2500 * time.Millisecond)
+	cw.Stop()
+	assert.Equal(int32(1), atomic.LoadInt32(&cnt))
+	u, err := store.Get(mustParse(ts.URL + "/"))
+	if assert.NoError(err) {
+		assert.False(u.Done)
+	}
+}
+
+func TestScore(t *testing.T) {
+	assert := assert.New(t)
+	var sm sitemap.Sitemap
+	assert.NoError(xml.Unmarshal([]byte(`
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>http://example.com/a</loc><priority>0.0</priority></url>
+<url><loc>http://example.com/b</loc></url>
+<url><loc>http://example.com/c</loc><priority>1.5</priority></url>
+</urlset>`), &sm))
+	var scores []int
+	for i := range sm.URLSet {
+		scores = append(scores, Score(&sm.URLSet[i]))
+	}
+	assert.Equal([]int{500, 500, 1000}, scores)
+}
+
+func TestMaxEntries(t *testing.T) {
+	assert := assert.New(t)
+	ctrl := New(nil)
+	ctrl.MaxEntries = 10
+	for i := 0; i < 100; i++ {
+		ctrl.Add(&sitemap.URL{Loc: *mustParse(fmt.Sprintf("http://example.com/%d", i))})
+	}
+	assert.Equal(10, len(ctrl.m))
+	_, ok := ctrl.Lookup(mustParse("http://example.com/99"))
+	assert.True(ok)
+}
+
+// linkCtrl implements the link interfaces, which should not be hidden by
+// the wrappers.
+type linkCtrl struct {
+	crawler.NopController
+	mu      sync.Mutex
+	handled []string
+	sched   []string
+}
+
+func (c *linkCtrl) HandleLink(r *crawler.Response, ch chan<- *crawler.Link) {
+	c.mu.Lock()
+	c.handled = append(c.handled, r.URL.Path)
+	c.mu.Unlock()
+	crawler.ExtractLinks(r.NewURL, r.Body, ch)
+}
+
+func (c *linkCtrl) AcceptLink(_ *crawler.Response, link *crawler.Link) bool {
+	return link.Text != "skip"
+}
+
+func (c *linkCtrl) SchedLink(_ *crawler.Response, link *crawler.Link) crawler.Ticket {
+	c.mu.Lock()
+	c.sched = append(c.sched, link.URL.Path)
+	c.mu.Unlock()
+	return crawler.Ticket{}
+}
+
+func TestWrapLinkInterfaces(t *testing.T) {
+	assert := assert.New(t)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">skip</a>`)
+		}
+	}))
+	defer ts.Close()
+
+	inner := &linkCtrl{}
+	ctrl := New(NewRecorder(inner))
+	cw := crawler.New(&crawler.Config{Controller: ctrl})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+	sort.Strings(inner.handled)
+	assert.Equal([]string{"/", "/a"}, inner.handled)
+	assert.Equal([]string{"/", "/a"}, inner.sched)
+}
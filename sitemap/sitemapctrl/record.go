@@ -0,0 +1,89 @@
+package sitemapctrl
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/media"
+	"github.com/fanyang01/crawler/sitemap"
+)
+
+// Recorder wraps a crawler.Controller and marks pages that should be
+// listed in a sitemap, i.e., HTML pages with status 200 that are not
+// marked as noindex, as crawler.URL.Indexable in the store. After
+// crawling, the sitemap can be written from the store by WriteSitemap.
+type Recorder struct {
+	crawler.Forward
+}
+
+// NewRecorder creates a recorder wrapping ctrl.
+func NewRecorder(ctrl crawler.Controller) *Recorder {
+	if ctrl == nil {
+		ctrl = crawler.NopController{}
+	}
+	return &Recorder{Forward: crawler.Forward{Controller: ctrl}}
+}
+
+// Handle implements crawler.Controller.
+func (rc *Recorder) Handle(r *crawler.Response, ch chan<- *url.URL) {
+	rc.Controller.Handle(r, ch)
+	rc.Record(r)
+}
+
+// HandleLink implements crawler.LinkHandler.
+func (rc *Recorder) HandleLink(r *crawler.Response, ch chan<- *crawler.Link) {
+	crawler.HandleLink(rc.Controller, r, ch)
+	rc.Record(r)
+}
+
+// Record marks whether r should be listed in a sitemap. A redirected page
+// is not listed, since its target is visited as another URL. A response
+// that is not modified keeps the previous mark.
+func (rc *Recorder) Record(r *crawler.Response) {
+	ctx := r.Context()
+	if ctx == nil || r.NotModified {
+		return
+	}
+	indexable := r.StatusCode == http.StatusOK && media.IsHTML(r.ContentType) &&
+		!r.Robots.NoIndexAt(r.Timestamp) && r.NewURL.String() == r.URL.String()
+	ctx.UpdateURL(func(u *crawler.URL) { u.Indexable = indexable })
+}
+
+// WriteSitemap writes the visited indexable pages in store, sorted by
+// location, to w. The lastmod of a page is its Last-Modified header, or
+// the time of the latest visit if there is none. It doesn't close w.
+func WriteSitemap(w *sitemap.Writer, store crawler.WalkableStore) error {
+	var entries []*sitemap.URL
+	if err := store.Walk(func(u *crawler.URL) error {
+		if !u.Indexable || u.NumVisit == 0 {
+			return nil
+		}
+		entry := &sitemap.URL{
+			Loc:          u.URL,
+			LastModified: u.LastModified,
+		}
+		if entry.LastModified.IsZero() {
+			entry.LastModified = u.Last
+		}
+		entries = append(entries, entry)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sort.Sort(byLoc(entries))
+	for _, entry := range entries {
+		if err := w.Write(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type byLoc []*sitemap.URL
+
+func (s byLoc) Len() int           { return len(s) }
+func (s byLoc) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byLoc) Less(i, j int) bool { return s[i].Loc.String() < s[j].Loc.String() }
@@ -0,0 +1,99 @@
+package sitemapctrl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/fanyang01/crawler"
+	"github.com/fanyang01/crawler/sitemap"
+	"github.com/stretchr/testify/assert"
+)
+
+type linkController struct {
+	crawler.NopController
+}
+
+func (linkController) Handle(r *crawler.Response, ch chan<- *url.URL) {
+	crawler.ExtractHref(r.NewURL, r.Body, ch)
+}
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestRecorder(t *testing.T) {
+	assert := assert.New(t)
+	lastmod := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/old">a</a><a href="/noindex">b</a>
+<a href="/missing">c</a><a href="/data.json">d</a>
+<a href="/expired">e</a>`)
+		case "/old":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Last-Modified", lastmod.Format(http.TimeFormat))
+			fmt.Fprint(w, `<html></html>`)
+		case "/noindex":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("X-Robots-Tag", "noarchive, noindex")
+			fmt.Fprint(w, `<html></html>`)
+		case "/expired":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			fmt.Fprint(w, `<meta name="robots" content="unavailable_after: 2010-01-01">`)
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	rc := NewRecorder(linkController{})
+	store := crawler.NewMemStore()
+	start := time.Now()
+	cw := crawler.New(&crawler.Config{Controller: rc, Store: store})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+
+	files := map[string]*bytes.Buffer{}
+	create := func(name string) (io.WriteCloser, error) {
+		files[name] = &bytes.Buffer{}
+		return nopCloser{files[name]}, nil
+	}
+	w := &sitemap.Writer{Create: create, Name: "sitemap"}
+	assert.NoError(WriteSitemap(w, store))
+	assert.NoError(w.Close())
+	assert.Equal([]string{"sitemap1.xml"}, w.Files())
+	assert.Contains(files, "sitemap_index.xml")
+
+	d, err := sitemap.NewDecoder(files["sitemap1.xml"])
+	assert.NoError(err)
+	u, err := d.Next()
+	assert.NoError(err)
+	assert.Equal(ts.URL+"/", u.Loc.String())
+	assert.False(u.LastModified.Before(start.Truncate(time.Second)))
+	u, err = d.Next()
+	assert.NoError(err)
+	assert.Equal(ts.URL+"/old", u.Loc.String())
+	assert.Equal(lastmod, u.LastModified.UTC())
+	_, err = d.Next()
+	assert.Equal(io.EOF, err)
+
+	// Nothing is written without indexable pages.
+	files = map[string]*bytes.Buffer{}
+	w = &sitemap.Writer{Create: create, Name: "sitemap"}
+	assert.NoError(WriteSitemap(w, crawler.NewMemStore()))
+	assert.NoError(w.Close())
+	assert.Empty(files)
+}
@@ -0,0 +1,257 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	urlsetHeader = xml.Header + `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"` +
+		` xmlns:news="http://www.google.com/schemas/sitemap-news/0.9"` +
+		` xmlns:image="http://www.google.com/schemas/sitemap-image/1.1"` +
+		` xmlns:video="http://www.google.com/schemas/sitemap-video/1.1">` + "\n"
+	urlsetFooter = "</urlset>\n"
+	indexHeader  = xml.Header + `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n"
+	indexFooter  = "</sitemapindex>\n"
+)
+
+// ErrWriterClosed is returned when writing to a closed writer.
+var ErrWriterClosed = errors.New("sitemap: writer is closed")
+
+// Writer generates a set of sitemaps. URLs are split into files of at most
+// MaxURLs URLs and MaxSize bytes, and an index listing all the files is
+// written when the writer is closed, unless there is none.
+type Writer struct {
+	// Base is the URL of the directory where the sitemaps are published,
+	// which should end with a slash.
+	Base *url.URL
+	// Create creates a file to write a sitemap.
+	Create func(name string) (io.WriteCloser, error)
+	// Name is the prefix of file names. Files are named as Name1.xml,
+	// Name2.xml, ..., and the index is named as Name_index.xml.
+	Name string
+	// Gzip enables gzip compression, which appends ".gz" to file names.
+	Gzip bool
+
+	files  []string
+	f      io.WriteCloser
+	gz     *gzip.Writer
+	w      io.Writer
+	n      int // number of URLs in current file
+	size   int // uncompressed size of current file
+	buf    bytes.Buffer
+	closed bool
+}
+
+// NewWriter creates a writer that writes gzipped sitemaps into dir. base is
+// the URL of dir.
+func NewWriter(dir string, base *url.URL) *Writer {
+	return &Writer{
+		Base: base,
+		Create: func(name string) (io.WriteCloser, error) {
+			return os.Create(filepath.Join(dir, name))
+		},
+		Name: "sitemap",
+		Gzip: true,
+	}
+}
+
+func (w *Writer) filename(s string) string {
+	s = w.Name + s + ".xml"
+	if w.Gzip {
+		s += ".gz"
+	}
+	return s
+}
+
+func (w *Writer) open(name string, header string) (err error) {
+	if w.f, err = w.Create(name); err != nil {
+		return
+	}
+	w.w = w.f
+	if w.Gzip {
+		w.gz = gzip.NewWriter(w.f)
+		w.w = w.gz
+	}
+	w.n, w.size = 0, 0
+	return w.write([]byte(header))
+}
+
+func (w *Writer) write(b []byte) error {
+	w.size += len(b)
+	_, err := w.w.Write(b)
+	return err
+}
+
+func (w *Writer) finish(footer string) error {
+	err := w.write([]byte(footer))
+	if w.gz != nil {
+		if e := w.gz.Close(); err == nil {
+			err = e
+		}
+		w.gz = nil
+	}
+	if e := w.f.Close(); err == nil {
+		err = e
+	}
+	w.f, w.w = nil, nil
+	return err
+}
+
+// Write adds u to the sitemaps.
+func (w *Writer) Write(u *URL) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.buf.Reset()
+	u.appendXML(&w.buf)
+	if w.f != nil && (w.n >= MaxURLs ||
+		w.size+w.buf.Len()+len(urlsetFooter) > MaxSize) {
+		if err := w.finish(urlsetFooter); err != nil {
+			return err
+		}
+	}
+	if w.f == nil {
+		name := w.filename(strconv.Itoa(len(w.files) + 1))
+		w.files = append(w.files, name)
+		if err := w.open(name, urlsetHeader); err != nil {
+			return err
+		}
+	}
+	w.n++
+	return w.write(w.buf.Bytes())
+}
+
+// Files returns names of the sitemaps that have been created, not
+// including the index.
+func (w *Writer) Files() []string { return w.files }
+
+// Index returns the name of the index.
+func (w *Writer) Index() string { return w.filename("_index") }
+
+// Close finishes the current sitemap and writes the index. The index is
+// not written if no sitemap has been created.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.f != nil {
+		if err := w.finish(urlsetFooter); err != nil {
+			return err
+		}
+	}
+	if len(w.files) == 0 {
+		return nil
+	}
+	if err := w.open(w.Index(), indexHeader); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, name := range w.files {
+		loc := name
+		if w.Base != nil {
+			loc = w.Base.ResolveReference(&url.URL{Path: name}).String()
+		}
+		w.buf.Reset()
+		w.buf.WriteString("<sitemap><loc>")
+		xml.EscapeText(&w.buf, []byte(loc))
+		w.buf.WriteString("</loc><lastmod>")
+		w.buf.WriteString(now.Format(time.RFC3339))
+		w.buf.WriteString("</lastmod></sitemap>\n")
+		if err := w.write(w.buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return w.finish(indexFooter)
+}
+
+// FreqString returns the change frequency closest to d, or "" if d is 0.
+func FreqString(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d == Never:
+		return "never"
+	case d <= time.Second:
+		return "always"
+	case d <= time.Hour:
+		return "hourly"
+	case d <= 24*time.Hour:
+		return "daily"
+	case d <= 7*24*time.Hour:
+		return "weekly"
+	case d <= 30*24*time.Hour:
+		return "monthly"
+	}
+	return "yearly"
+}
+
+func element(buf *bytes.Buffer, name, value string) {
+	if value == "" {
+		return
+	}
+	fmt.Fprintf(buf, "<%s>", name)
+	xml.EscapeText(buf, []byte(value))
+	fmt.Fprintf(buf, "</%s>", name)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (u *URL) appendXML(buf *bytes.Buffer) {
+	buf.WriteString("<url>")
+	element(buf, "loc", u.Loc.String())
+	element(buf, "lastmod", formatTime(u.LastModified))
+	element(buf, "changefreq", FreqString(u.ChangeFreq))
+	if u.Priority > 0 {
+		element(buf, "priority", strconv.FormatFloat(u.Priority, 'f', -1, 64))
+	}
+	if n := u.News; n != nil {
+		buf.WriteString("<news:news><news:publication>")
+		element(buf, "news:name", n.Publication.Name)
+		element(buf, "news:language", n.Publication.Language)
+		buf.WriteString("</news:publication>")
+		element(buf, "news:publication_date", formatTime(n.PublicationDate.Time))
+		element(buf, "news:title", n.Title)
+		element(buf, "news:keywords", n.Keywords)
+		buf.WriteString("</news:news>")
+	}
+	for _, img := range u.Images {
+		buf.WriteString("<image:image>")
+		element(buf, "image:loc", img.Loc)
+		element(buf, "image:caption", img.Caption)
+		element(buf, "image:title", img.Title)
+		element(buf, "image:geo_location", img.GeoLocation)
+		element(buf, "image:license", img.License)
+		buf.WriteString("</image:image>")
+	}
+	for _, v := range u.Videos {
+		buf.WriteString("<video:video>")
+		element(buf, "video:thumbnail_loc", v.ThumbnailLoc)
+		element(buf, "video:title", v.Title)
+		element(buf, "video:description", v.Description)
+		element(buf, "video:content_loc", v.ContentLoc)
+		element(buf, "video:player_loc", v.PlayerLoc)
+		if v.Duration > 0 {
+			element(buf, "video:duration", strconv.Itoa(v.Duration))
+		}
+		element(buf, "video:publication_date", formatTime(v.PublicationDate.Time))
+		element(buf, "video:family_friendly", v.FamilyFriendly)
+		buf.WriteString("</video:video>")
+	}
+	buf.WriteString("</url>\n")
+}
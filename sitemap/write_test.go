@@ -0,0 +1,82 @@
+package sitemap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type nopCloser struct {
+	*bytes.Buffer
+}
+
+func (nopCloser) Close() error { return nil }
+
+func TestWriter(t *testing.T) {
+	assert := assert.New(t)
+	files := map[string]*bytes.Buffer{}
+	base, _ := url.Parse("http://www.example.com/sitemaps/")
+	w := &Writer{
+		Base: base,
+		Create: func(name string) (io.WriteCloser, error) {
+			buf := &bytes.Buffer{}
+			files[name] = buf
+			return nopCloser{buf}, nil
+		},
+		Name: "sitemap",
+		Gzip: true,
+	}
+	lastmod := time.Date(2005, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i <= MaxURLs; i++ {
+		u := &URL{
+			Loc:          mustParseURL(fmt.Sprintf("http://www.example.com/%d?a=1&b=2", i)),
+			LastModified: lastmod,
+			ChangeFreq:   7 * 24 * time.Hour,
+			Priority:     0.8,
+		}
+		if i == 0 {
+			u.Images = []Image{{Loc: "http://www.example.com/a.jpg"}}
+		}
+		assert.NoError(w.Write(u))
+	}
+	assert.NoError(w.Close())
+	assert.Equal(ErrWriterClosed, w.Write(&URL{}))
+	assert.Equal([]string{"sitemap1.xml.gz", "sitemap2.xml.gz"}, w.Files())
+	assert.Equal(3, len(files))
+
+	format, urls, err := decodeAll(files[w.Index()])
+	assert.NoError(err)
+	assert.Equal(FormatIndex, format)
+	assert.Equal(2, len(urls))
+	assert.Equal("http://www.example.com/sitemaps/sitemap2.xml.gz", urls[1].Loc.String())
+
+	format, urls, err = decodeAll(files["sitemap1.xml.gz"])
+	assert.NoError(err)
+	assert.Equal(FormatURLSet, format)
+	assert.Equal(MaxURLs, len(urls))
+	u := urls[0]
+	assert.Equal("http://www.example.com/0?a=1&b=2", u.Loc.String())
+	assert.Equal(lastmod, u.LastModified)
+	assert.Equal(7*24*time.Hour, u.ChangeFreq)
+	assert.Equal(0.8, u.Priority)
+	assert.Equal("http://www.example.com/a.jpg", u.Images[0].Loc)
+
+	_, urls, err = decodeAll(files["sitemap2.xml.gz"])
+	assert.NoError(err)
+	assert.Equal(1, len(urls))
+}
+
+func TestFreqString(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal("", FreqString(0))
+	assert.Equal("always", FreqString(time.Second))
+	assert.Equal("daily", FreqString(24*time.Hour))
+	assert.Equal("monthly", FreqString(20*24*time.Hour))
+	assert.Equal("yearly", FreqString(365*24*time.Hour))
+	assert.Equal("never", FreqString(Never))
+}
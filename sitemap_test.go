@@ -0,0 +1,121 @@
+package crawler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/fanyang01/crawler/sitemap"
+	"github.com/stretchr/testify/assert"
+)
+
+type sitemapController struct {
+	NopController
+	mu      sync.Mutex
+	depth   map[string]int
+	entries map[string]bool
+}
+
+func (c *sitemapController) Handle(r *Response, _ chan<- *url.URL) {
+	c.mu.Lock()
+	c.depth[r.URL.Path] = r.Context().Depth()
+	c.mu.Unlock()
+}
+
+func (c *sitemapController) Add(entry *sitemap.URL) {
+	c.mu.Lock()
+	c.entries[entry.Loc.Path] = true
+	c.mu.Unlock()
+}
+
+func TestSitemapDiscovery(t *testing.T) {
+	assert := assert.New(t)
+	var other int32
+	ots := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&other, 1)
+		fmt.Fprintf(w, `<urlset><url><loc>http://%s/</loc></url></urlset>`, r.Host)
+	}))
+	defer ots.Close()
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nSitemap: %s/index.xml\n", ts.URL)
+		case "/index.xml":
+			fmt.Fprintf(w, `<sitemapindex>
+<sitemap><loc>%s/a.txt</loc></sitemap>
+<sitemap><loc>%s/index.xml</loc></sitemap>
+<sitemap><loc>%s/other.xml</loc></sitemap>
+</sitemapindex>`, ts.URL, ts.URL, ots.URL)
+		case "/a.txt":
+			fmt.Fprintf(w, "%s/orphan1\n%s/private\nhttp://other.example.com/\n", ts.URL, ts.URL)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset><url><loc>%s/orphan2</loc></url></urlset>`, ts.URL)
+		default:
+			fmt.Fprint(w, "<html></html>")
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := &sitemapController{
+		depth:   map[string]int{},
+		entries: map[string]bool{},
+	}
+	opt := *DefaultOption
+	opt.SitemapDiscovery = true
+	opt.ObeyRobots = true
+	cw := New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(cw.Crawl(ts.URL + "/"))
+	cw.Wait()
+
+	assert.Equal(map[string]int{
+		"/":        0,
+		"/orphan1": 1,
+		"/orphan2": 1,
+	}, ctrl.depth)
+	assert.Equal(map[string]bool{
+		"/orphan1": true,
+		"/orphan2": true,
+		"/private": true,
+	}, ctrl.entries)
+	// Sitemaps of other sites listed in the index are not fetched.
+	assert.Equal(int32(0), atomic.LoadInt32(&other))
+}
+
+func TestSitemapDiscoveryNoRobots(t *testing.T) {
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /\nSitemap: %s/a.txt\n", ts.URL)
+		case "/a.txt":
+			fmt.Fprintf(w, "%s/orphan\n", ts.URL)
+		case "/sitemap.xml":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, "<html></html>")
+		}
+	}))
+	defer ts.Close()
+
+	ctrl := &sitemapController{
+		depth:   map[string]int{},
+		entries: map[string]bool{},
+	}
+	opt := *DefaultOption
+	opt.SitemapDiscovery = true
+	opt.ObeyRobots = false
+	cw := New(&Config{Controller: ctrl, Option: &opt})
+	assert.NoError(t, cw.Crawl(ts.URL+"/"))
+	cw.Wait()
+
+	// Sitemaps in robots.txt are used, but its rules are not applied.
+	assert.Equal(t, map[string]int{
+		"/":       0,
+		"/orphan": 1,
+	}, ctrl.depth)
+}
@@ -0,0 +1,103 @@
+package crawler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusClass determines how a response status is treated by StdClient.
+type StatusClass int
+
+const (
+	// StatusOK responses are handled by the controller.
+	StatusOK StatusClass = iota
+	// StatusRetry responses fail with a RetryableError.
+	StatusRetry
+	// StatusFail responses fail with a ResponseStatusError, and are not
+	// retried.
+	StatusFail
+	// StatusHandle responses are handled like StatusOK ones, though the
+	// status is an error, e.g., 404 and 410 for reporting broken links.
+	// Controller.Handle should check r.StatusCode.
+	StatusHandle
+	// StatusThrottle responses are retried after the delay given by
+	// Retry-After. It's the class of 429, and of the soft-block statuses
+	// used by some sites to deny crawlers, e.g., 999.
+	StatusThrottle
+)
+
+// StatusPolicy classifies response statuses. By default, 2xx is OK, 429
+// is throttled, 5xx and 4xx but 404 are retried, and others fail.
+type StatusPolicy struct {
+	// Classes overrides the default classes of statuses.
+	Classes map[int]StatusClass
+	// ThrottleDelay is the delay of throttled responses without
+	// Retry-After. Zero means the delay given by Controller.Retry.
+	ThrottleDelay time.Duration
+	// MaxRetryAfter, if positive, limits the delay given by Retry-After.
+	MaxRetryAfter time.Duration
+}
+
+// DefaultStatusPolicy is used by StdClient if no policy is set.
+var DefaultStatusPolicy = &StatusPolicy{}
+
+// Class returns the class of status code.
+func (p *StatusPolicy) Class(code int) StatusClass {
+	if c, ok := p.Classes[code]; ok {
+		return c
+	}
+	switch {
+	case 200 <= code && code < 300:
+		return StatusOK
+	case code == http.StatusTooManyRequests:
+		return StatusThrottle
+	case code >= 500, code >= 400 && code != 404:
+		return StatusRetry
+	}
+	return StatusFail
+}
+
+// Check returns the error of r according to its status, or nil if r
+// should be handled.
+func (p *StatusPolicy) Check(r *http.Response) error {
+	err := ResponseStatusError(r.StatusCode)
+	switch p.Class(r.StatusCode) {
+	case StatusOK, StatusHandle:
+		return nil
+	case StatusRetry:
+		return RetryableError{Err: err}
+	case StatusThrottle:
+		after, ok := retryAfter(r.Header.Get("Retry-After"), time.Now())
+		if !ok {
+			after = p.ThrottleDelay
+		}
+		if p.MaxRetryAfter > 0 && after > p.MaxRetryAfter {
+			after = p.MaxRetryAfter
+		}
+		return RetryableError{Err: err, After: after}
+	}
+	return err
+}
+
+// retryAfter parses Retry-After, which is either seconds or a date.
+func retryAfter(s string, now time.Time) (time.Duration, bool) {
+	if s = strings.TrimSpace(s); s == "" {
+		return 0, false
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 {
+			return 0, false
+		}
+		return time.Duration(n) * time.Second, true
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
@@ -27,6 +27,12 @@ type wrapper struct {
 	Status   int
 	NumVisit int
 	NumRetry int
+	// Added later; missing in old records and decoded as zero values.
+	ETag         string
+	LastModified time.Time
+	Changes      crawler.Changes
+	Indexable    bool
+	Duplicate    bool
 }
 
 func (w *wrapper) To(url string) (*crawler.URL, error) {
@@ -42,6 +48,11 @@ func (w *wrapper) To(url string) (*crawler.URL, error) {
 	u.Status = w.Status
 	u.NumVisit = w.NumVisit
 	u.NumRetry = w.NumRetry
+	u.ETag = w.ETag
+	u.LastModified = w.LastModified
+	u.Changes = w.Changes
+	u.Indexable = w.Indexable
+	u.Duplicate = w.Duplicate
 	return u, nil
 }
 func (w *wrapper) From(u *crawler.URL) *wrapper {
@@ -51,6 +62,11 @@ func (w *wrapper) From(u *crawler.URL) *wrapper {
 	w.Status = u.Status
 	w.NumVisit = u.NumVisit
 	w.NumRetry = u.NumRetry
+	w.ETag = u.ETag
+	w.LastModified = u.LastModified
+	w.Changes = u.Changes
+	w.Indexable = u.Indexable
+	w.Duplicate = u.Duplicate
 	return w
 }
 
@@ -283,5 +299,22 @@ func (s *BoltStore) Recover(ch chan<- *url.URL) error {
 	})
 }
 
+// Walk implements crawler.WalkableStore. f must not modify the store.
+func (s *BoltStore) Walk(f func(*crawler.URL) error) error {
+	return s.DB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bkURL).ForEach(func(k, v []byte) error {
+			w := &wrapper{}
+			if err := s.codec.Unmarshal(v, w); err != nil {
+				return err
+			}
+			u, err := w.To(string(k))
+			if err != nil {
+				return err
+			}
+			return f(u)
+		})
+	})
+}
+
 // TODO: write the bloom filter to a bucket.
 func (s *BoltStore) Close() error { return s.DB.Close() }
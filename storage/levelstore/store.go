@@ -9,6 +9,7 @@ import (
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/opt"
+	lutil "github.com/syndtr/goleveldb/leveldb/util"
 )
 
 var (
@@ -245,4 +246,20 @@ func (s *LevelStore) IsFinished() (is bool, err error) {
 	return
 }
 
+// Walk implements crawler.WalkableStore.
+func (s *LevelStore) Walk(f func(*crawler.URL) error) error {
+	iter := s.DB.NewIterator(lutil.BytesPrefix([]byte("URL:")), nil)
+	defer iter.Release()
+	for iter.Next() {
+		u := &crawler.URL{}
+		if err := s.codec.Unmarshal(iter.Value(), u); err != nil {
+			return err
+		}
+		if err := f(u); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
 func (s *LevelStore) Close() error { return s.Close() }
@@ -18,16 +18,25 @@ type SQLStore struct {
 }
 
 type wrapper struct {
-	Scheme   string
-	Host     string
-	Path     string
-	Query    string
-	Depth    int
-	Done     bool
-	Status   int
-	Last     time.Time
-	NumVisit int `db:"num_visit"`
-	NumError int `db:"num_error"`
+	Scheme       string
+	Host         string
+	Path         string
+	Query        string
+	Depth        int
+	Done         bool
+	Status       int
+	Last         time.Time
+	NumVisit     int `db:"num_visit"`
+	NumError     int `db:"num_error"`
+	ETag         string
+	LastModified time.Time `db:"last_modified"`
+	// Postgres has no unsigned integers.
+	ChangeHash    int64     `db:"change_hash"`
+	ChangeFirst   time.Time `db:"change_first"`
+	ChangeCount   int       `db:"change_count"`
+	ChangeChanged int       `db:"change_changed"`
+	Indexable     bool
+	Duplicate     bool
 }
 
 func (w *wrapper) ToURL() *crawler.URL {
@@ -38,12 +47,22 @@ func (w *wrapper) ToURL() *crawler.URL {
 			RawPath:  w.Path,
 			RawQuery: w.Query,
 		},
-		Depth:    w.Depth,
-		Done:     w.Done,
-		Status:   w.Status,
-		Last:     w.Last,
-		NumVisit: w.NumVisit,
-		NumRetry: w.NumError,
+		Depth:        w.Depth,
+		Done:         w.Done,
+		Status:       w.Status,
+		Last:         w.Last,
+		NumVisit:     w.NumVisit,
+		NumRetry:     w.NumError,
+		ETag:         w.ETag,
+		LastModified: w.LastModified,
+		Changes: crawler.Changes{
+			Hash:    uint64(w.ChangeHash),
+			First:   w.ChangeFirst,
+			Count:   w.ChangeCount,
+			Changed: w.ChangeChanged,
+		},
+		Indexable: w.Indexable,
+		Duplicate: w.Duplicate,
 	}
 	return u
 }
@@ -59,6 +78,14 @@ func (w *wrapper) fromURL(u *crawler.URL) {
 	w.Last = u.Last
 	w.NumVisit = u.NumVisit
 	w.NumError = u.NumRetry
+	w.ETag = u.ETag
+	w.LastModified = u.LastModified
+	w.ChangeHash = int64(u.Changes.Hash)
+	w.ChangeFirst = u.Changes.First
+	w.ChangeCount = u.Changes.Count
+	w.ChangeChanged = u.Changes.Changed
+	w.Indexable = u.Indexable
+	w.Duplicate = u.Duplicate
 }
 
 const (
@@ -74,8 +101,31 @@ CREATE TABLE IF NOT EXISTS url (
 	last      TIMESTAMP NOT NULL,
 	num_visit INT NOT NULL,
 	num_error INT NOT NULL,
+	etag      TEXT NOT NULL DEFAULT '',
+	last_modified TIMESTAMP NOT NULL DEFAULT '0001-01-01',
+	change_hash    BIGINT NOT NULL DEFAULT 0,
+	change_first   TIMESTAMP NOT NULL DEFAULT '0001-01-01',
+	change_count   INT NOT NULL DEFAULT 0,
+	change_changed INT NOT NULL DEFAULT 0,
+	indexable      BOOLEAN NOT NULL DEFAULT FALSE,
+	duplicate      BOOLEAN NOT NULL DEFAULT FALSE,
 	PRIMARY KEY (scheme, host, path, query)
 )`
+	// URLMigration adds the columns of validators and changes to tables
+	// created by older versions. ADD COLUMN IF NOT EXISTS requires
+	// PostgreSQL 9.6 or later; like the rest of the store, it is not
+	// portable to other databases.
+	URLMigration = `
+ALTER TABLE url
+	ADD COLUMN IF NOT EXISTS etag TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS last_modified TIMESTAMP NOT NULL DEFAULT '0001-01-01',
+	ADD COLUMN IF NOT EXISTS change_hash BIGINT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS change_first TIMESTAMP NOT NULL DEFAULT '0001-01-01',
+	ADD COLUMN IF NOT EXISTS change_count INT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS change_changed INT NOT NULL DEFAULT 0,
+	ADD COLUMN IF NOT EXISTS indexable BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN IF NOT EXISTS duplicate BOOLEAN NOT NULL DEFAULT FALSE
+`
 	CountSchema = `
 CREATE TABLE IF NOT EXISTS count (
 	url_count    INT NOT NULL,
@@ -110,6 +160,9 @@ func New(conn string) (s *SQLStore, err error) {
 	if _, err = tx.Exec(URLSchema); err != nil {
 		return nil, err
 	}
+	if _, err = tx.Exec(URLMigration); err != nil {
+		return nil, err
+	}
 	if _, err = tx.Exec(CountSchema); err != nil {
 		return nil, err
 	}
@@ -192,8 +245,10 @@ func (s *SQLStore) PutNX(u *crawler.URL) (ok bool, err error) {
 	w := &wrapper{}
 	w.fromURL(u)
 	if _, err = tx.NamedExec(`
-	INSERT INTO url(scheme, host, path, query, depth, done, status, last, num_visit, num_error)
-	 VALUES (:scheme, :host, :path, :query, :depth, :done, :status, :last, :num_visit, :num_error)`,
+	INSERT INTO url(scheme, host, path, query, depth, done, status, last, num_visit, num_error, etag, last_modified,
+		change_hash, change_first, change_count, change_changed, indexable, duplicate)
+	 VALUES (:scheme, :host, :path, :query, :depth, :done, :status, :last, :num_visit, :num_error, :etag, :last_modified,
+		:change_hash, :change_first, :change_count, :change_changed, :indexable, :duplicate)`,
 		w); err == nil {
 		done = true
 		_, err = tx.Exec(
@@ -227,7 +282,11 @@ func (s *SQLStore) UpdateFunc(u *url.URL, f func(*crawler.URL)) (err error) {
 	f(uu)
 	w.fromURL(uu)
 	_, err = s.DB.NamedExec(`
-	UPDATE url SET num_error = :num_error, num_visit = :num_visit, last = :last, status = :status
+	UPDATE url SET num_error = :num_error, num_visit = :num_visit, last = :last, status = :status,
+		etag = :etag, last_modified = :last_modified,
+		change_hash = :change_hash, change_first = :change_first,
+		change_count = :change_count, change_changed = :change_changed,
+		indexable = :indexable, duplicate = :duplicate
 	WHERE scheme = :scheme AND host = :host AND path = :path AND query = :query`, w)
 	return
 
@@ -293,4 +352,23 @@ func (s *SQLStore) IsFinished() (is bool, err error) {
 	return
 }
 
+// Walk implements crawler.WalkableStore.
+func (s *SQLStore) Walk(f func(*crawler.URL) error) error {
+	rows, err := s.DB.Queryx(`SELECT * FROM url`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var w wrapper
+		if err = rows.StructScan(&w); err != nil {
+			return err
+		}
+		if err = f(w.ToURL()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
 func (s *SQLStore) Close() error { return s.DB.Close() }
@@ -36,7 +36,15 @@ func StoreTest(t *testing.T, s crawler.Store) {
 			u.Status == uu.Status &&
 			equalTime(u.Last, uu.Last) &&
 			u.NumVisit == uu.NumVisit &&
-			u.NumRetry == uu.NumRetry
+			u.NumRetry == uu.NumRetry &&
+			u.ETag == uu.ETag &&
+			equalTime(u.LastModified, uu.LastModified) &&
+			u.Changes.Hash == uu.Changes.Hash &&
+			equalTime(u.Changes.First, uu.Changes.First) &&
+			u.Changes.Count == uu.Changes.Count &&
+			u.Changes.Changed == uu.Changes.Changed &&
+			u.Indexable == uu.Indexable &&
+			u.Duplicate == uu.Duplicate
 	}
 	tm := time.Now().UTC()
 	assert := assert.New(t)
@@ -64,6 +72,11 @@ func StoreTest(t *testing.T, s crawler.Store) {
 
 	uuu.NumVisit++
 	uuu.Last = time.Now().UTC()
+	uuu.ETag = `"v1"`
+	uuu.LastModified = tm.Add(-time.Hour)
+	uuu.Changes = crawler.Changes{Hash: 1 << 63, First: tm, Count: 2, Changed: 1}
+	uuu.Indexable = true
+	uuu.Duplicate = true
 	assert.NoError(s.Update(uuu))
 	uu, err = s.Get(u)
 	assert.NoError(err)
@@ -101,6 +114,19 @@ func StoreTest(t *testing.T, s crawler.Store) {
 	ok, err = s.IsFinished()
 	assert.NoError(err)
 	assert.True(ok)
+
+	if ws, ok := s.(crawler.WalkableStore); ok {
+		var indexable []string
+		cnt := 0
+		assert.NoError(ws.Walk(func(u *crawler.URL) error {
+			if cnt++; u.Indexable {
+				indexable = append(indexable, u.URL.String())
+			}
+			return nil
+		}))
+		assert.Equal(2, cnt)
+		assert.Equal([]string{"http://localhost:6060"}, indexable)
+	}
 }
 
 func TestBolt(t *testing.T) {
@@ -33,6 +33,14 @@ type PersistableStore interface {
 	Recover(ch chan<- *url.URL) error
 }
 
+// WalkableStore is a store whose URLs can be iterated.
+type WalkableStore interface {
+	Store
+	// Walk calls f for each URL in the store. It stops at the first
+	// error returned by f.
+	Walk(f func(*URL) error) error
+}
+
 type MemStore struct {
 	sync.RWMutex
 	m map[string]*URL
@@ -148,4 +156,16 @@ func (p *MemStore) IsFinished() (bool, error) {
 	return p.NumDone >= p.NumURL, nil
 }
 
+// Walk implements WalkableStore. f must not modify the store.
+func (p *MemStore) Walk(f func(*URL) error) error {
+	p.RLock()
+	defer p.RUnlock()
+	for _, u := range p.m {
+		if err := f(u.clone()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (p *MemStore) Close() error { return nil }
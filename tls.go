@@ -0,0 +1,144 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"time"
+)
+
+// TLSOptions describes the TLS configuration of HTTP clients.
+type TLSOptions struct {
+	// RootCAs are PEM files of certificate authorities that are trusted
+	// in addition to the system pool, or instead of it if NoSystemRoots
+	// is true.
+	RootCAs       []string
+	NoSystemRoots bool
+	// CertFile and KeyFile are the PEM files of the client certificate
+	// presented to servers that require mutual TLS.
+	CertFile, KeyFile string
+	// MinVersion is the minimum TLS version, e.g., tls.VersionTLS12.
+	MinVersion uint16
+	// InsecureHosts are hosts whose certificates are not verified. An
+	// entry beginning with "." matches all subdomains. Hosts are matched
+	// by the server name, which is empty for IP addresses, so servers
+	// requested by IP addresses are always verified.
+	InsecureHosts []string
+}
+
+// Config builds a tls.Config from the options.
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{MinVersion: o.MinVersion}
+
+	if len(o.RootCAs) > 0 {
+		var pool *x509.CertPool
+		if !o.NoSystemRoots {
+			pool, _ = x509.SystemCertPool()
+		}
+		if pool == nil {
+			pool = x509.NewCertPool()
+		}
+		for _, file := range o.RootCAs {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(b) {
+				return nil, fmt.Errorf("crawler: no certificate in %s", file)
+			}
+		}
+		config.RootCAs = pool
+	} else if o.NoSystemRoots {
+		return nil, errors.New("crawler: no root certificate authority")
+	}
+
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(o.InsecureHosts) > 0 {
+		// Verification is done by VerifyConnection instead, so that it
+		// can be skipped for some hosts.
+		insecure := append([]string(nil), o.InsecureHosts...)
+		roots := config.RootCAs
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(cs tls.ConnectionState) error {
+			if matchHost(insecure, cs.ServerName) {
+				return nil
+			}
+			return verifyPeer(cs, roots)
+		}
+	}
+	return config, nil
+}
+
+func matchHost(hosts []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if h == host || (strings.HasPrefix(h, ".") &&
+			(strings.HasSuffix(host, h) || host == h[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyPeer verifies the certificate chain of a connection like the
+// default verification of crypto/tls.
+func verifyPeer(cs tls.ConnectionState, roots *x509.CertPool) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("crawler: no peer certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// NewHTTPClient returns a HTTP client like DefaultHTTPClient, but with its
+// own transport using config and its own cookie jar.
+func NewHTTPClient(config *tls.Config) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: DefaultResolver.Dialer(&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}),
+			TLSHandshakeTimeout: 5 * time.Second,
+			TLSClientConfig:     config,
+			// A custom TLS config disables HTTP/2 unless it's forced.
+			ForceAttemptHTTP2: true,
+		},
+		Jar:     jar,
+		Timeout: 10 * time.Second,
+	}
+}
+
+// initTLS records the TLS state of the connection on r.
+func (r *Response) initTLS(cs *tls.ConnectionState) {
+	if cs == nil {
+		return
+	}
+	r.PeerCertificates = cs.PeerCertificates
+	r.NegotiatedProtocol = cs.NegotiatedProtocol
+	r.TLSVersion = cs.Version
+}
@@ -0,0 +1,143 @@
+package crawler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePEM(t *testing.T, file, typ string, b []byte) {
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{
+		Type: typ, Bytes: b,
+	}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newClientCert writes a self-signed client certificate and its key.
+func newClientCert(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "crawler"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", kb)
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+func TestTLS(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var (
+		caFile   = filepath.Join(dir, "ca.pem")
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile  = filepath.Join(dir, "key.pem")
+	)
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(newClientCert(t, certFile, keyFile))
+	ts.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	ts.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+	writePEM(t, caFile, "CERTIFICATE", ts.Certificate().Raw)
+
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	DefaultResolver.Override("insecure.test", net.ParseIP("127.0.0.1"))
+	defer DefaultResolver.Override("insecure.test")
+	getURL := func(u string, o *TLSOptions) (*Response, error) {
+		config, err := o.Config()
+		if err != nil {
+			return nil, err
+		}
+		hreq, _ := http.NewRequest("GET", u, nil)
+		return NewStdClient(NewHTTPClient(config), nil).Do(&Request{Request: hreq})
+	}
+	get := func(o *TLSOptions) (*Response, error) { return getURL(ts.URL, o) }
+
+	r, err := get(&TLSOptions{
+		RootCAs:    []string{caFile},
+		CertFile:   certFile,
+		KeyFile:    keyFile,
+		MinVersion: tls.VersionTLS12,
+	})
+	if assert.NoError(err) {
+		b, _ := ioutil.ReadAll(r.Body)
+		assert.Equal("crawler", string(b))
+		assert.Equal(ts.Certificate().Raw, r.PeerCertificates[0].Raw)
+		assert.Equal("h2", r.NegotiatedProtocol)
+		assert.Equal(uint16(tls.VersionTLS13), r.TLSVersion)
+	}
+
+	// No client certificate
+	_, err = get(&TLSOptions{RootCAs: []string{caFile}})
+	assert.Error(err)
+	// Unknown authority
+	_, err = get(&TLSOptions{CertFile: certFile, KeyFile: keyFile})
+	assert.Error(err)
+	insecure := &TLSOptions{
+		CertFile: certFile, KeyFile: keyFile,
+		InsecureHosts: []string{"insecure.test"},
+	}
+	_, err = get(insecure)
+	assert.Error(err)
+	// Verification skipped
+	_, err = getURL("https://insecure.test:"+port, insecure)
+	assert.NoError(err)
+
+	_, err = (&TLSOptions{NoSystemRoots: true}).Config()
+	assert.Error(err)
+	_, err = (&TLSOptions{RootCAs: []string{keyFile}}).Config()
+	assert.Error(err)
+	assert.True(matchHost([]string{".Example.com"}, "a.example.com"))
+	assert.True(matchHost([]string{".example.com"}, "example.com"))
+	assert.False(matchHost([]string{".example.com"}, "badexample.com"))
+}
@@ -1,6 +1,7 @@
 package crawler
 
 import (
+	"net/http"
 	"net/url"
 	"time"
 
@@ -31,6 +32,27 @@ type URL struct {
 	Status   int
 	NumVisit int
 	NumRetry int
+	// ETag and LastModified are the validators of the latest response,
+	// which are sent in conditional requests when the URL is revisited.
+	ETag         string
+	LastModified time.Time
+	// Changes tracks how often the content changes. It's maintained by
+	// controllers like revisit.Controller through Context.UpdateURL.
+	Changes Changes
+	// Indexable reports whether the page can be listed in a sitemap. It's
+	// maintained by controllers like sitemapctrl.Recorder.
+	Indexable bool
+	// Duplicate is set if the page has been collapsed into its canonical
+	// URL. See Option.PreferCanonical.
+	Duplicate bool
+}
+
+// Changes is the history of the content of a URL.
+type Changes struct {
+	Hash    uint64    // hash of the latest content
+	First   time.Time // time of the first observation
+	Count   int       // number of observations after the first one
+	Changed int       // number of observations that found a change
 }
 
 func (u *URL) clone() *URL {
@@ -38,9 +60,43 @@ func (u *URL) clone() *URL {
 	return &uu
 }
 
+// setConditional adds the stored validators of u to req, unless req
+// already has its own. It reports whether any validator is added.
+func (u *URL) setConditional(req *http.Request) (ok bool) {
+	if u.ETag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", u.ETag)
+		ok = true
+	}
+	if !u.LastModified.IsZero() && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", u.LastModified.UTC().Format(http.TimeFormat))
+		ok = true
+	}
+	return
+}
+
+// setValidators stores the validators of r. A 304 response may omit
+// them, in which case the old ones are kept.
+func (u *URL) setValidators(r *Response) {
+	if r.Response == nil {
+		return
+	}
+	etag, lastmod := r.Header.Get("ETag"), r.Header.Get("Last-Modified")
+	if etag != "" || !r.NotModified {
+		u.ETag = etag
+	}
+	if lastmod != "" || !r.NotModified {
+		u.LastModified, _ = http.ParseTime(lastmod)
+	}
+}
+
 func (u *URL) Update(uu *URL) {
 	u.NumRetry = uu.NumRetry
 	u.NumVisit = uu.NumVisit
 	u.Last = uu.Last
 	u.Status = uu.Status
+	u.ETag = uu.ETag
+	u.LastModified = uu.LastModified
+	u.Changes = uu.Changes
+	u.Indexable = uu.Indexable
+	u.Duplicate = uu.Duplicate
 }
@@ -9,6 +9,7 @@ import (
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 	"unicode/utf8"
 
 	"golang.org/x/net/idna"
@@ -33,15 +34,41 @@ func validateHost(host string) (string, error) {
 	return "", errors.New("not valid domain name or IP address")
 }
 
+var schemes = struct {
+	sync.RWMutex
+	m map[string]func(*url.URL) error
+}{m: map[string]func(*url.URL) error{
+	"http":  normalizeHTTP,
+	"https": normalizeHTTP,
+}}
+
+// RegisterScheme sets the normalization rules of URLs of scheme, e.g.,
+// NormalizeFile for "file". URLs of schemes other than http, https and
+// the registered ones are rejected by Normalize.
+func RegisterScheme(scheme string, normalize func(*url.URL) error) {
+	schemes.Lock()
+	schemes.m[strings.ToLower(scheme)] = normalize
+	schemes.Unlock()
+}
+
+// Normalize normalizes u by the rules of its scheme.
 func Normalize(u *url.URL) error {
 	if !utf8.ValidString(u.String()) {
 		return fmt.Errorf("normalize URL: invalid UTF-8 string: %q", u.String())
 	}
 
 	u.Scheme = strings.ToLower(u.Scheme)
-	if u.Scheme != "http" && u.Scheme != "https" {
+	schemes.RLock()
+	normalize, ok := schemes.m[u.Scheme]
+	schemes.RUnlock()
+	if !ok {
 		return fmt.Errorf("normalize URL: unsupported scheme: %v", u.Scheme)
 	}
+	return normalize(u)
+}
+
+// normalizeHost validates the host of u and removes the default port.
+func normalizeHost(u *url.URL, defaultPort string) error {
 	host, port, err := net.SplitHostPort(u.Host)
 	if err != nil { // missing port
 		host, port = u.Host, ""
@@ -54,14 +81,16 @@ func Normalize(u *url.URL) error {
 		u.Host = v
 	}
 
-	if (u.Scheme == "http" && port == "80") ||
-		(u.Scheme == "https" && port == "443") {
+	if port == defaultPort {
 		port = ""
 	}
 	if port != "" {
 		u.Host = net.JoinHostPort(u.Host, port)
 	}
+	return nil
+}
 
+func cleanPath(u *url.URL) {
 	clean := func(pth string) string {
 		p := path.Clean(pth)
 		if p == "." {
@@ -74,5 +103,51 @@ func Normalize(u *url.URL) error {
 	u.Path = clean(u.Path)
 	u.RawPath = clean(u.RawPath)
 	u.Fragment = ""
+}
+
+func normalizeHTTP(u *url.URL) error {
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	if err := normalizeHost(u, port); err != nil {
+		return err
+	}
+	cleanPath(u)
+	return nil
+}
+
+// NormalizeFile normalizes file URLs. The host must be empty or
+// "localhost", which is removed.
+func NormalizeFile(u *url.URL) error {
+	if u.Opaque != "" {
+		return fmt.Errorf("normalize URL: opaque file URL: %q", u.String())
+	}
+	if h := strings.ToLower(u.Host); h != "" && h != "localhost" {
+		return fmt.Errorf("normalize URL: non-local file URL: %q", u.String())
+	}
+	u.Host, u.User, u.RawQuery = "", nil, ""
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	cleanPath(u)
+	return nil
+}
+
+// NormalizeFTP normalizes ftp URLs like those of http.
+func NormalizeFTP(u *url.URL) error {
+	if err := normalizeHost(u, "21"); err != nil {
+		return err
+	}
+	cleanPath(u)
+	return nil
+}
+
+// NormalizeData normalizes data URLs, whose content is left untouched.
+func NormalizeData(u *url.URL) error {
+	if u.Opaque == "" || !strings.Contains(u.Opaque, ",") {
+		return fmt.Errorf("normalize URL: invalid data URL: %q", u.String())
+	}
+	u.Fragment = ""
 	return nil
 }